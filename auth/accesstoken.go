@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// AccessTokenPrefix starts every access token, so that they are told apart
+// from the session tokens, and found by secret scanners.
+const AccessTokenPrefix = "fsp_"
+
+// accessTokenLastUsedPeriod is how often the LastUsedAt of an access token
+// is updated, to keep every request from writing to the store.
+const accessTokenLastUsedPeriod = time.Minute
+
+// AccessToken is a long-lived token of a user for scripts and API clients.
+// They are sent as session tokens, but the store only keeps their hashes.
+// ExpiresAt is the zero time for the tokens that do not expire, and
+// LastUsedAt until the token is used.
+type AccessToken struct {
+	Id         string    `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Name       string    `json:"name"`
+	Scopes     []string  `json:"scopes"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+}
+
+// CreateAccessToken returns a new access token of the user of the session.
+// The token is only returned here. The scopes are not interpreted by the
+// service: the apps check them, as RequireScopes of the http package does.
+// Whatever their scopes, access tokens can only read: the methods that
+// change the user, its organizations or its tokens return
+// ErrAccessTokenNotAllowed.
+func (self authImpl) CreateAccessToken(sessionTokenStr, name string, scopes []string, expiresAt time.Time) (accessTokenStr string, err error) {
+	sessionToken, err := self.parseSession(sessionTokenStr)
+	if err != nil {
+		return
+	}
+
+	if sessionToken.accessTokenId != "" {
+		err = ErrAccessTokenNotAllowed
+		return
+	}
+	if sessionToken.impersonationId != "" {
+		err = ErrImpersonating
+		return
+	}
+
+	if strings.TrimSpace(name) == "" {
+		err = invalidArgument("The access token name is empty.")
+		return
+	}
+	if err = checkScopes(scopes); err != nil {
+		return
+	}
+
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	now := time.Now()
+	if !expiresAt.IsZero() && !expiresAt.After(now) {
+		err = invalidArgument("The access token expiration is in the past.")
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+	accessTokenStr = AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	accessToken := AccessToken{
+		Id:        uuid.NewV4().String(),
+		CreatedAt: now,
+		Name:      name,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err = self.store.CreateAccessToken(sessionToken.userId, hashSecret(accessTokenStr), accessToken); err != nil {
+		accessTokenStr = ""
+	}
+	return
+}
+
+func (self authImpl) GetAccessTokens(sessionTokenStr string) ([]AccessToken, error) {
+	sessionToken, err := self.parseSession(sessionTokenStr)
+	if err != nil {
+		return []AccessToken{}, err
+	}
+
+	return self.store.GetAccessTokens(sessionToken.userId)
+}
+
+// RevokeAccessTokens removes access tokens of the user of the session. The
+// ids of other users are skipped.
+func (self authImpl) RevokeAccessTokens(sessionTokenStr string, accessTokenIds ...string) error {
+	sessionToken, err := self.parseSession(sessionTokenStr)
+	if err != nil {
+		return err
+	}
+
+	if sessionToken.accessTokenId != "" {
+		return ErrAccessTokenNotAllowed
+	}
+
+	if len(accessTokenIds) == 0 {
+		return nil
+	}
+
+	return self.store.RemoveAccessTokens(sessionToken.userId, accessTokenIds...)
+}
+
+// parseAccessToken finds the access token by its hash, checks that it has
+// not expired, and returns it as a session token without a session id.
+func (self authImpl) parseAccessToken(accessTokenStr string) (sessionToken privateSessionToken, err error) {
+	accessToken, userId, err := self.store.GetAccessTokenByHash(hashSecret(accessTokenStr))
+	if err == sql.ErrNoRows {
+		err = &Error{CodeInvalidToken, "The access token is not valid."}
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	if !accessToken.ExpiresAt.IsZero() && now.After(accessToken.ExpiresAt) {
+		err = &Error{CodeTokenExpired, "The access token has expired."}
+		return
+	}
+
+	if now.Sub(accessToken.LastUsedAt) >= accessTokenLastUsedPeriod {
+		if err = self.store.SetAccessTokenLastUsedAt(accessToken.Id, now); err != nil {
+			return
+		}
+	}
+
+	sessionToken = privateSessionToken{
+		userId:        userId,
+		createdAt:     accessToken.CreatedAt,
+		accessTokenId: accessToken.Id,
+		scopes:        accessToken.Scopes,
+	}
+	return
+}
+
+// hashSecret is the key of an access token, or of a client secret, in the
+// store. They are random, so a fast hash is enough.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkScopes checks that the scopes can be kept joined by spaces.
+func checkScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\r\n") {
+			return invalidArgument(fmt.Sprintf("The scope %q is not valid.", scope))
+		}
+	}
+	return nil
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// joinScopes and splitScopes convert the scopes to and from the column of
+// the SQL stores.
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func splitScopes(scopes string) []string {
+	return strings.Fields(scopes)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/dfreire/fservices/mailer"
+	"github.com/dfreire/fservices/util"
+)
+
+func (self authImpl) GetUnapprovedUsers(adminKey string) ([]User, error) {
+	if !self.isAdminKey(adminKey) {
+		return []User{}, ErrUnauthorized
+	}
+
+	return self.store.GetUnapprovedUsers(self.cfg.Tenant)
+}
+
+// ApproveUser lets the user sign in when RequireApproval is set, and mails
+// the ApprovalEmail. Approving a user again does nothing.
+func (self authImpl) ApproveUser(adminKey, userId string) error {
+	if !self.isAdminKey(adminKey) {
+		return ErrUnauthorized
+	}
+
+	var user StoredUser
+	approved := false
+
+	err := self.store.WithTx(func(tx Store) error {
+		var err error
+		user, err = lockTenantUser(tx, self.cfg.Tenant, userId)
+		if err != nil || !user.ApprovedAt.IsZero() {
+			return err
+		}
+
+		approved = true
+		return tx.SetUserApprovedAt(userId, time.Now())
+	})
+	if err != nil || !approved {
+		return err
+	}
+
+	return self.sendApprovalEmail(self.cfg.ApprovalEmail, user)
+}
+
+// RejectUser removes a user that is not approved, and mails the
+// RejectionEmail.
+func (self authImpl) RejectUser(adminKey, userId string) error {
+	if !self.isAdminKey(adminKey) {
+		return ErrUnauthorized
+	}
+
+	var user StoredUser
+
+	err := self.store.WithTx(func(tx Store) error {
+		var err error
+		user, err = lockTenantUser(tx, self.cfg.Tenant, userId)
+		if err != nil {
+			return err
+		}
+
+		if !user.ApprovedAt.IsZero() {
+			return invalidArgument("The user has already been approved.")
+		}
+
+		return tx.RemoveUsers(userId)
+	})
+	if err != nil {
+		return err
+	}
+
+	return self.sendApprovalEmail(self.cfg.RejectionEmail, user)
+}
+
+func (self authImpl) sendApprovalEmail(mailConfig AuthMailConfig, user StoredUser) error {
+	templateValues := struct{ Email string }{user.Email}
+	body, err := util.RenderTemplate(mailConfig[user.Lang].Body, templateValues)
+	if err != nil {
+		return err
+	}
+
+	mail := mailer.Mail{
+		From:    self.cfg.FromEmail,
+		To:      []string{user.Email},
+		Subject: mailConfig[user.Lang].Subject,
+		Body:    body,
+	}
+
+	return self.mailer.SendContext(self.ctx, mail)
+}
@@ -1,7 +1,13 @@
 package auth
 
 import (
-	"errors"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dfreire/fservices/mailer"
@@ -11,33 +17,129 @@ import (
 )
 
 type Auth interface {
+	// WithContext returns the service with its store and mailer calls
+	// bound to ctx, so that every method stops when ctx is done.
+	WithContext(ctx context.Context) Auth
+
 	Signup(email, password, lang string) (confirmationTokenStr string, err error)
 	ResendConfirmationMail(email, lang string) (confirmationTokenStr string, err error)
 	ConfirmSignup(confirmationTokenStr string) error
 	Signin(email, password string) (sessionTokenStr string, err error)
+	// Signout removes the session of the token, so that it and the tokens
+	// switched from it stop working before they expire. A session that no
+	// longer exists is not an error.
+	Signout(sessionTokenStr string) error
 	ForgotPasword(email, lang string) (resetTokenStr string, err error)
 	ResetPassword(resetTokenStr, newPassword string) error
 
+	GetSession(sessionTokenStr string) (Session, error)
 	ChangePassword(sessionTokenStr, oldPassword, newPassword string) error
 	ChangeEmail(sessionTokenStr, password, newEmail string) error
+	GetProfile(sessionTokenStr string) (Profile, error)
+	UpdateProfile(sessionTokenStr string, userData interface{}) error
+
+	CreateAccessToken(sessionTokenStr, name string, scopes []string, expiresAt time.Time) (accessTokenStr string, err error)
+	GetAccessTokens(sessionTokenStr string) ([]AccessToken, error)
+	RevokeAccessTokens(sessionTokenStr string, accessTokenIds ...string) error
+
+	IssueServiceToken(clientId, clientSecret string, scopes []string) (ServiceToken, error)
+	GetServiceSession(serviceTokenStr string) (ServiceSession, error)
+
+	CreateOrganization(sessionTokenStr, name string) (organizationId string, err error)
+	GetOrganizations(sessionTokenStr string) ([]Membership, error)
+	SwitchOrganization(sessionTokenStr, organizationId string) (newSessionTokenStr string, err error)
+	GetOrganizationMembers(sessionTokenStr string) ([]Member, error)
+	AddOrganizationMember(sessionTokenStr, email, role string) error
+	SetOrganizationMemberRole(sessionTokenStr, userId, role string) error
+	RemoveOrganizationMembers(sessionTokenStr string, userIds ...string) error
 
+	CheckAdminKey(adminKey string) error
 	GetUsers(adminKey string) ([]User, error)
 	CreateUser(adminKey, email, password, lang string) error
 	ChangeUserPassword(adminKey, userId, newPassword string) error
 	ChangeUserEmail(adminKey, userId, newEmail string) error
 	RemoveUsers(adminKey string, userIds ...string) error
+	GetUserProfile(adminKey, userId string) (Profile, error)
+	UpdateUserProfile(adminKey, userId string, userData, adminData interface{}) error
+
+	ImpersonateUser(adminKey, userId, reason string) (sessionTokenStr string, err error)
+	GetImpersonations(adminKey string) ([]Impersonation, error)
+	GetJobRuns(adminKey string, limit int) ([]JobRun, error)
+
+	RemoveUnconfirmedUsers(adminKey string, dryRun bool) (removedUsers []User, err error)
+
+	GetUnapprovedUsers(adminKey string) ([]User, error)
+	ApproveUser(adminKey, userId string) error
+	RejectUser(adminKey, userId string) error
 
-	RemoveUnconfirmedUsers(adminKey string) error
+	CreateServiceAccount(adminKey, name string, scopes []string) (serviceAccount ServiceAccount, clientSecret string, err error)
+	GetServiceAccounts(adminKey string) ([]ServiceAccount, error)
+	RotateServiceAccountSecret(adminKey, serviceAccountId string) (clientSecret string, err error)
+	DisableServiceAccount(adminKey, serviceAccountId string) error
 }
 
 type AuthConfig struct {
+	// Tenant scopes the users of this service. Emails are unique per tenant,
+	// so apps that share the same tenant (the default is "") share their users.
+	Tenant                 string
 	AdminKey               string
 	JwtKey                 string
 	MaxUnconfirmedUsersAge string
 	MaxResetKeyAge         string
-	FromEmail              string
-	ConfirmationEmail      AuthMailConfig
-	ResetPasswordEmail     AuthMailConfig
+	// MaxImpersonationAge is the lifetime of the sessions opened with
+	// ImpersonateUser. The default is "1h".
+	MaxImpersonationAge string
+	MaxSessionAge       string
+	Jobs                map[string]string
+	FromEmail           string
+	ConfirmationEmail   AuthMailConfig
+	ResetPasswordEmail  AuthMailConfig
+	// UnconfirmedUsersWarningPeriod is how long before their removal the
+	// unconfirmed users get a RemovalWarningEmail. Empty disables the warning.
+	UnconfirmedUsersWarningPeriod string
+	RemovalWarningEmail           AuthMailConfig
+	MaxProfileSize                int
+	UserProfileSchema             string
+	AdminProfileSchema            string
+	// HideAccounts keeps Signin, ForgotPasword and ResendConfirmationMail
+	// from telling whether an email has an account: they fail the same way
+	// and take about the same time. ForgotPasword and ResendConfirmationMail
+	// then return no token, and send their mail in the background, logging
+	// the errors. For an email without an account they send an
+	// UnknownAccountEmail instead, and for an unconfirmed account
+	// ForgotPasword sends the confirmation mail again.
+	HideAccounts        bool
+	UnknownAccountEmail AuthMailConfig
+	// EmailProviderRules reduces the emails of some providers to their
+	// mailbox, see NormalizeEmail. It applies to the emails given from then
+	// on, so it is best set before the first signup.
+	EmailProviderRules bool
+	// AllowedEmailDomains, when not empty, are the only email domains of new
+	// users, as for a tenant that only takes corporate emails, and
+	// DeniedEmailDomains are never taken. "*.example.com" matches the
+	// subdomains of example.com. They also apply to the changed emails, and
+	// may be in Unicode, as "*.münchen.de".
+	AllowedEmailDomains []string
+	DeniedEmailDomains  []string
+	// DenyDisposableEmails refuses the domains of throwaway mail services,
+	// and their subdomains: DisposableEmailDomains or, when nil, a bundled
+	// list.
+	DenyDisposableEmails   bool
+	DisposableEmailDomains []string
+	// RequireApproval makes ConfirmSignup leave the account waiting until
+	// an admin approves it with ApproveUser, or removes it with RejectUser.
+	// The user gets the ApprovalEmail or the RejectionEmail.
+	RequireApproval bool
+	ApprovalEmail   AuthMailConfig
+	RejectionEmail  AuthMailConfig
+	// ServiceTokenAge is the lifetime of the tokens of the service
+	// accounts. The default is "1h".
+	ServiceTokenAge string
+	// DeletedUsersRetention makes RemoveUsers delete the users instead of
+	// removing them: they can no longer sign in and are not listed, but
+	// their records and emails are kept for this long, until the
+	// purgeDeletedUsers job removes them. Empty removes the users at once.
+	DeletedUsersRetention string
 }
 
 type AuthMailConfig map[string]struct {
@@ -47,15 +149,31 @@ type AuthMailConfig map[string]struct {
 
 type authImpl struct {
 	cfg    AuthConfig
-	store  store
+	store  Store
 	mailer mailer.Mailer
+	ctx    context.Context
 }
 
-func NewAuth(cfg AuthConfig, store store, mailer mailer.Mailer) authImpl {
-	return authImpl{cfg, store, mailer}
+func NewAuth(cfg AuthConfig, store Store, mailer mailer.Mailer) authImpl {
+	if cfg.MaxImpersonationAge == "" {
+		cfg.MaxImpersonationAge = defaultMaxImpersonationAge
+	}
+	cfg.AllowedEmailDomains = normalizeEmailDomains(cfg.AllowedEmailDomains)
+	cfg.DeniedEmailDomains = normalizeEmailDomains(cfg.DeniedEmailDomains)
+	cfg.DisposableEmailDomains = normalizeEmailDomains(cfg.DisposableEmailDomains)
+	return authImpl{cfg, store, mailer, context.Background()}
+}
+
+func (self authImpl) WithContext(ctx context.Context) Auth {
+	return authImpl{self.cfg, self.store.WithContext(ctx), self.mailer, ctx}
 }
 
 func (self authImpl) Signup(email, password, lang string) (confirmationTokenStr string, err error) {
+	email, err = self.normalizeEmail(email)
+	if err != nil {
+		return
+	}
+
 	confirmationKey, err := self.createUser(email, password, lang, false)
 	if err != nil {
 		return
@@ -65,93 +183,163 @@ func (self authImpl) Signup(email, password, lang string) (confirmationTokenStr
 }
 
 func (self authImpl) ResendConfirmationMail(email, lang string) (confirmationTokenStr string, err error) {
-	userId, err := self.store.getUserId(email)
+	email, err = self.normalizeEmail(email)
 	if err != nil {
 		return
 	}
 
-	user, err := self.store.getPrivateUser(userId)
-	if err != nil {
+	if self.cfg.HideAccounts {
+		self.inBackground(func(self authImpl) error {
+			_, err := self.resendConfirmationMail(email, lang)
+			return err
+		})
 		return
 	}
 
-	return self.sendConfirmationEmail(email, lang, user.confirmationKey)
+	return self.resendConfirmationMail(email, lang)
 }
 
-func (self authImpl) ConfirmSignup(confirmationTokenStr string) error {
-	confirmationToken, err := parseConfirmationToken(self.cfg.JwtKey, confirmationTokenStr)
+func (self authImpl) resendConfirmationMail(email, lang string) (confirmationTokenStr string, err error) {
+	userId, err := self.store.GetUserId(self.cfg.Tenant, email)
 	if err != nil {
-		return err
+		err = notFound(err, ErrUserNotFound)
+		if err == ErrUserNotFound && self.cfg.HideAccounts {
+			err = self.sendUnknownAccountEmail(email, lang)
+		}
+		return
 	}
 
-	userId, err := self.store.getUserId(confirmationToken.email)
+	user, err := self.store.GetUser(userId)
 	if err != nil {
-		return err
+		err = notFound(err, ErrUserNotFound)
+		return
 	}
 
-	user, err := self.store.getPrivateUser(userId)
+	return self.sendConfirmationEmail(email, lang, user.ConfirmationKey)
+}
+
+func (self authImpl) ConfirmSignup(confirmationTokenStr string) error {
+	confirmationToken, err := parseConfirmationToken(self.cfg.JwtKey, confirmationTokenStr)
 	if err != nil {
 		return err
 	}
 
-	if confirmationToken.key != user.confirmationKey {
-		return errors.New("The confirmation key is not valid.")
-	}
+	return self.store.WithTx(func(tx Store) error {
+		user, err := lockUserByEmail(tx, self.cfg.Tenant, confirmationToken.email)
+		if err != nil {
+			return err
+		}
+
+		if confirmationToken.key != user.ConfirmationKey {
+			return &Error{CodeInvalidToken, "The confirmation key is not valid."}
+		}
 
-	return self.store.setUserConfirmedAt(userId, time.Now())
+		confirmedAt := time.Now()
+		if err := tx.SetUserConfirmedAt(user.Id, confirmedAt); err != nil || self.cfg.RequireApproval {
+			return err
+		}
+		return tx.SetUserApprovedAt(user.Id, confirmedAt)
+	})
 }
 
 func (self authImpl) Signin(email, password string) (sessionTokenStr string, err error) {
-	userId, err := self.store.getUserId(email)
+	email, err = self.normalizeEmail(email)
 	if err != nil {
 		return
 	}
 
-	user, err := self.store.getPrivateUser(userId)
+	sessionId := uuid.NewV4().String()
+	sessionCreatedAt := time.Now()
+	var userId string
+
+	err = self.store.WithTx(func(tx Store) error {
+		var err error
+		userId, err = tx.GetUserId(self.cfg.Tenant, email)
+		if err == sql.ErrNoRows && self.cfg.HideAccounts {
+			compareDummyPassword(password)
+			return ErrInvalidCredentials
+		}
+		if err != nil {
+			return notFound(err, ErrUserNotFound)
+		}
+
+		user, err := tx.GetUser(userId)
+		if err != nil {
+			return notFound(err, ErrUserNotFound)
+		}
+
+		// The password is checked first, so that only who knows it learns
+		// that the account has not been confirmed.
+		if err := checkPassword(user, password); err != nil {
+			return err
+		}
+
+		if user.ConfirmedAt.Equal(time.Time{}) {
+			return ErrNotConfirmed
+		}
+
+		if self.cfg.RequireApproval && user.ApprovedAt.IsZero() {
+			return ErrPendingApproval
+		}
+
+		return tx.CreateSession(sessionId, sessionCreatedAt, userId)
+	})
 	if err != nil {
 		return
 	}
 
-	if user.confirmedAt.Equal(time.Time{}) {
-		err = errors.New("The account has not been confirmed.")
-		return
-	}
-
-	if err = bcrypt.CompareHashAndPassword([]byte(user.hashedPass), []byte(password)); err != nil {
-		return
-	}
-
-	sessionId := uuid.NewV4().String()
-	sessionCreatedAt := time.Now()
-
-	sessionTokenStr, err = privateSessionToken{sessionId, userId, sessionCreatedAt}.toString(self.cfg.JwtKey)
+	sessionToken := privateSessionToken{sessionId: sessionId, userId: userId, createdAt: sessionCreatedAt}
+	sessionTokenStr, err = sessionToken.toString(self.cfg.JwtKey)
 	return
 }
 
-func (self authImpl) ForgotPasword(email, lang string) (resetToken string, err error) {
-	userId, err := self.store.getUserId(email)
+func (self authImpl) ForgotPasword(email, lang string) (resetTokenStr string, err error) {
+	email, err = self.normalizeEmail(email)
 	if err != nil {
 		return
 	}
 
-	user, err := self.store.getPrivateUser(userId)
-	if err != nil {
+	if self.cfg.HideAccounts {
+		self.inBackground(func(self authImpl) error {
+			_, err := self.forgotPasword(email, lang)
+			return err
+		})
 		return
 	}
 
-	if user.confirmedAt.Equal(time.Time{}) {
-		err = errors.New("The account has not been confirmed.")
-		return
-	}
+	return self.forgotPasword(email, lang)
+}
 
+func (self authImpl) forgotPasword(email, lang string) (resetTokenStr string, err error) {
 	resetKey := uuid.NewV4().String()
-
-	err = self.store.setUserResetKey(userId, resetKey)
+	resetKeyCreatedAt := time.Now()
+
+	err = self.store.WithTx(func(tx Store) error {
+		user, err := lockUserByEmail(tx, self.cfg.Tenant, email)
+		if err != nil {
+			return err
+		}
+
+		if user.ConfirmedAt.Equal(time.Time{}) {
+			return ErrNotConfirmed
+		}
+
+		return tx.SetUserResetKey(user.Id, resetKey, resetKeyCreatedAt)
+	})
+	if self.cfg.HideAccounts {
+		switch err {
+		case ErrUserNotFound:
+			return "", self.sendUnknownAccountEmail(email, lang)
+		case ErrNotConfirmed:
+			_, err = self.resendConfirmationMail(email, lang)
+			return "", err
+		}
+	}
 	if err != nil {
 		return
 	}
 
-	return self.sendResetPaswordEmail(privateResetToken{email, lang, resetKey, time.Now()})
+	return self.sendResetPaswordEmail(privateResetToken{email, lang, resetKey, resetKeyCreatedAt})
 }
 
 func (self authImpl) ResetPassword(resetTokenStr, newPassword string) error {
@@ -160,98 +348,207 @@ func (self authImpl) ResetPassword(resetTokenStr, newPassword string) error {
 		return err
 	}
 
-	userId, err := self.store.getUserId(resetToken.email)
+	maxResetKeyAge, err := time.ParseDuration(self.cfg.MaxResetKeyAge)
 	if err != nil {
 		return err
 	}
 
-	user, err := self.store.getPrivateUser(userId)
+	if time.Now().After(resetToken.createdAt.Add(maxResetKeyAge)) {
+		return &Error{CodeTokenExpired, "The reset key has expired."}
+	}
+
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 
-	if resetToken.key != user.resetKey {
-		return errors.New("The reset key is not valid.")
+	// Setting the password clears the reset key, and the lock keeps a
+	// concurrent request from using the same key.
+	return self.store.WithTx(func(tx Store) error {
+		user, err := lockUserByEmail(tx, self.cfg.Tenant, resetToken.email)
+		if err != nil {
+			return err
+		}
+
+		if user.ResetKey == "" || resetToken.key != user.ResetKey {
+			return &Error{CodeInvalidToken, "The reset key is not valid."}
+		}
+
+		return tx.SetUserHashedPass(user.Id, string(hashedPass))
+	})
+}
+
+func (self authImpl) Signout(sessionTokenStr string) error {
+	// An access token is revoked with RevokeAccessTokens.
+	if strings.HasPrefix(sessionTokenStr, AccessTokenPrefix) {
+		return ErrAccessTokenNotAllowed
 	}
 
-	maxResetKeyAge, err := time.ParseDuration(self.cfg.MaxResetKeyAge)
+	sessionToken, err := parseSessionToken(self.cfg.JwtKey, sessionTokenStr)
 	if err != nil {
 		return err
 	}
 
-	if time.Now().After(resetToken.createdAt.Add(maxResetKeyAge)) {
-		return errors.New("The reset key has expired.")
+	return self.store.RemoveSessions(sessionToken.sessionId)
+}
+
+func (self authImpl) GetSession(sessionTokenStr string) (Session, error) {
+	sessionToken, err := self.parseSession(sessionTokenStr)
+	if err != nil {
+		return Session{}, err
 	}
 
-	hashedPass, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	user, err := self.store.GetUser(sessionToken.userId)
 	if err != nil {
-		return err
+		return Session{}, notFound(err, ErrUserNotFound)
+	}
+
+	session := Session{
+		Id:              sessionToken.sessionId,
+		CreatedAt:       sessionToken.createdAt,
+		User:            user.toUser(),
+		OrganizationId:  sessionToken.organizationId,
+		ImpersonationId: sessionToken.impersonationId,
+		AccessTokenId:   sessionToken.accessTokenId,
+		Scopes:          sessionToken.scopes,
+	}
+
+	if session.OrganizationId != "" {
+		session.Role, err = self.store.GetMemberRole(session.OrganizationId, session.User.Id)
+		err = notFound(err, ErrNotFound)
 	}
 
-	return self.store.setUserHashedPass(userId, string(hashedPass))
+	return session, err
 }
 
 func (self authImpl) ChangePassword(sessionTokenStr, oldPassword, newPassword string) error {
-	sessionToken, err := parseSessionToken(self.cfg.JwtKey, sessionTokenStr)
+	sessionToken, err := self.parseSession(sessionTokenStr)
 	if err != nil {
 		return err
 	}
 
-	user, err := self.store.getPrivateUser(sessionToken.userId)
+	if sessionToken.accessTokenId != "" {
+		return ErrAccessTokenNotAllowed
+	}
+	if sessionToken.impersonationId != "" {
+		return ErrImpersonating
+	}
+
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 
-	if err = bcrypt.CompareHashAndPassword([]byte(user.hashedPass), []byte(oldPassword)); err != nil {
+	return self.store.WithTx(func(tx Store) error {
+		user, err := lockUser(tx, sessionToken.userId)
+		if err != nil {
+			return err
+		}
+
+		if err := checkPassword(user, oldPassword); err != nil {
+			return err
+		}
+
+		return tx.SetUserHashedPass(sessionToken.userId, string(hashedPass))
+	})
+}
+
+func (self authImpl) ChangeEmail(sessionTokenStr, password, newEmail string) error {
+	sessionToken, err := self.parseSession(sessionTokenStr)
+	if err != nil {
 		return err
 	}
 
-	hashedPass, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if sessionToken.accessTokenId != "" {
+		return ErrAccessTokenNotAllowed
+	}
+	if sessionToken.impersonationId != "" {
+		return ErrImpersonating
+	}
+
+	newEmail, err = self.normalizeEmail(newEmail)
 	if err != nil {
 		return err
 	}
 
-	return self.store.setUserHashedPass(sessionToken.userId, string(hashedPass))
+	if err := self.checkEmailDomain(newEmail); err != nil {
+		return err
+	}
+
+	return self.store.WithTx(func(tx Store) error {
+		user, err := lockUser(tx, sessionToken.userId)
+		if err != nil {
+			return err
+		}
+
+		if err := checkPassword(user, password); err != nil {
+			return err
+		}
+
+		return alreadyExists(tx.SetUserEmail(sessionToken.userId, newEmail), ErrEmailTaken)
+	})
 }
 
-func (self authImpl) ChangeEmail(sessionTokenStr, password, newEmail string) error {
-	sessionToken, err := parseSessionToken(self.cfg.JwtKey, sessionTokenStr)
+func (self authImpl) GetProfile(sessionTokenStr string) (Profile, error) {
+	sessionToken, err := self.parseSession(sessionTokenStr)
 	if err != nil {
-		return err
+		return Profile{}, err
 	}
 
-	user, err := self.store.getPrivateUser(sessionToken.userId)
+	profile, err := self.store.GetProfile(sessionToken.userId)
+	return profile, notFound(err, ErrUserNotFound)
+}
+
+func (self authImpl) UpdateProfile(sessionTokenStr string, userData interface{}) error {
+	sessionToken, err := self.parseSession(sessionTokenStr)
 	if err != nil {
 		return err
 	}
 
-	if err = bcrypt.CompareHashAndPassword([]byte(user.hashedPass), []byte(password)); err != nil {
+	if sessionToken.accessTokenId != "" {
+		return ErrAccessTokenNotAllowed
+	}
+
+	encoded, err := encodeProfileData(userData, self.cfg.MaxProfileSize, self.cfg.UserProfileSchema)
+	if err != nil {
 		return err
 	}
 
-	return self.store.setUserEmail(sessionToken.userId, newEmail)
+	return self.store.SetUserProfile(sessionToken.userId, encoded)
+}
+
+func (self authImpl) CheckAdminKey(adminKey string) error {
+	if !self.isAdminKey(adminKey) {
+		return ErrUnauthorized
+	}
+	return nil
 }
 
 func (self authImpl) GetUsers(adminKey string) ([]User, error) {
-	if adminKey != self.cfg.AdminKey {
-		return []User{}, errors.New("Unauthorized")
+	if !self.isAdminKey(adminKey) {
+		return []User{}, ErrUnauthorized
 	}
 
-	return self.store.getAllUsers()
+	return self.store.GetAllUsers(self.cfg.Tenant)
 }
 
 func (self authImpl) CreateUser(adminKey, email, password, lang string) error {
-	if adminKey != self.cfg.AdminKey {
-		return errors.New("Unauthorized")
+	if !self.isAdminKey(adminKey) {
+		return ErrUnauthorized
 	}
 
-	_, err := self.createUser(email, password, lang, true)
+	email, err := self.normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	_, err = self.createUser(email, password, lang, true)
 	return err
 }
 
 func (self authImpl) ChangeUserPassword(adminKey, userId, newPassword string) error {
-	if adminKey != self.cfg.AdminKey {
-		return errors.New("Unauthorized")
+	if !self.isAdminKey(adminKey) {
+		return ErrUnauthorized
 	}
 
 	hashedPass, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
@@ -259,28 +556,158 @@ func (self authImpl) ChangeUserPassword(adminKey, userId, newPassword string) er
 		return err
 	}
 
-	return self.store.setUserHashedPass(userId, string(hashedPass))
+	return self.store.WithTx(func(tx Store) error {
+		if _, err := lockTenantUser(tx, self.cfg.Tenant, userId); err != nil {
+			return err
+		}
+		return tx.SetUserHashedPass(userId, string(hashedPass))
+	})
 }
 
 func (self authImpl) ChangeUserEmail(adminKey, userId, newEmail string) error {
-	if adminKey != self.cfg.AdminKey {
-		return errors.New("Unauthorized")
+	if !self.isAdminKey(adminKey) {
+		return ErrUnauthorized
 	}
 
-	return self.store.setUserEmail(userId, newEmail)
+	newEmail, err := self.normalizeEmail(newEmail)
+	if err != nil {
+		return err
+	}
+
+	if err := self.checkEmailDomain(newEmail); err != nil {
+		return err
+	}
+
+	return self.store.WithTx(func(tx Store) error {
+		if _, err := lockTenantUser(tx, self.cfg.Tenant, userId); err != nil {
+			return err
+		}
+		return alreadyExists(tx.SetUserEmail(userId, newEmail), ErrEmailTaken)
+	})
 }
 
+// RemoveUsers skips the ids of the users of other tenants, as it skips
+// those that do not exist. With a DeletedUsersRetention, it only deletes
+// the users, see AuthConfig.
 func (self authImpl) RemoveUsers(adminKey string, userIds ...string) error {
-	if adminKey != self.cfg.AdminKey {
-		return errors.New("Unauthorized")
+	if !self.isAdminKey(adminKey) {
+		return ErrUnauthorized
+	}
+
+	return self.store.WithTx(func(tx Store) error {
+		tenantUserIds := []string{}
+		for _, userId := range userIds {
+			_, err := lockTenantUser(tx, self.cfg.Tenant, userId)
+			if err == ErrUserNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			tenantUserIds = append(tenantUserIds, userId)
+		}
+
+		if len(tenantUserIds) == 0 {
+			return nil
+		}
+		if self.cfg.DeletedUsersRetention != "" {
+			return tx.DeleteUsers(time.Now(), tenantUserIds...)
+		}
+		return tx.RemoveUsers(tenantUserIds...)
+	})
+}
+
+func (self authImpl) GetUserProfile(adminKey, userId string) (Profile, error) {
+	if !self.isAdminKey(adminKey) {
+		return Profile{}, ErrUnauthorized
 	}
 
-	return self.store.removeUsers(userIds...)
+	if _, err := getTenantUser(self.store, self.cfg.Tenant, userId); err != nil {
+		return Profile{}, err
+	}
+
+	profile, err := self.store.GetProfile(userId)
+	return profile, notFound(err, ErrUserNotFound)
+}
+
+func (self authImpl) UpdateUserProfile(adminKey, userId string, userData, adminData interface{}) error {
+	if !self.isAdminKey(adminKey) {
+		return ErrUnauthorized
+	}
+
+	var encodedUserData, encodedAdminData json.RawMessage
+	var err error
+
+	if userData != nil {
+		encodedUserData, err = encodeProfileData(userData, self.cfg.MaxProfileSize, self.cfg.UserProfileSchema)
+		if err != nil {
+			return err
+		}
+	}
+
+	if adminData != nil {
+		encodedAdminData, err = encodeProfileData(adminData, self.cfg.MaxProfileSize, self.cfg.AdminProfileSchema)
+		if err != nil {
+			return err
+		}
+	}
+
+	return self.store.WithTx(func(tx Store) error {
+		if _, err := lockTenantUser(tx, self.cfg.Tenant, userId); err != nil {
+			return err
+		}
+		if encodedUserData != nil {
+			if err := tx.SetUserProfile(userId, encodedUserData); err != nil {
+				return err
+			}
+		}
+		if encodedAdminData != nil {
+			return tx.SetAdminProfile(userId, encodedAdminData)
+		}
+		return nil
+	})
+}
+
+func (self authImpl) RemoveUnconfirmedUsers(adminKey string, dryRun bool) (removedUsers []User, err error) {
+	if !self.isAdminKey(adminKey) {
+		err = ErrUnauthorized
+		return
+	}
+
+	now := time.Now()
+
+	if !dryRun {
+		if err = self.warnUnconfirmedUsers(now); err != nil {
+			return
+		}
+	}
+
+	return self.removeUnconfirmedUsers(now, dryRun)
+}
+
+// removeUnconfirmedUsers removes the users that did not confirm their
+// account within MaxUnconfirmedUsersAge. With dryRun it only returns them.
+func (self authImpl) removeUnconfirmedUsers(now time.Time, dryRun bool) (removedUsers []User, err error) {
+	maxUnconfirmedUsersAge, err := time.ParseDuration(self.cfg.MaxUnconfirmedUsersAge)
+	if err != nil {
+		return
+	}
+
+	date := now.Add(-1 * maxUnconfirmedUsersAge)
+
+	if dryRun {
+		return self.store.GetUnconfirmedUsersCreatedBefore(self.cfg.Tenant, date)
+	}
+	return self.store.RemoveUnconfirmedUsersCreatedBefore(self.cfg.Tenant, date)
 }
 
-func (self authImpl) RemoveUnconfirmedUsers(adminKey string) error {
-	if adminKey != self.cfg.AdminKey {
-		return errors.New("Unauthorized")
+// warnUnconfirmedUsers mails the unconfirmed users that will be removed
+// within UnconfirmedUsersWarningPeriod, once per user. The users already
+// due for removal are not warned, and a failed mail is logged and tried
+// again on the next run, so that it does not hold back the removal.
+func (self authImpl) warnUnconfirmedUsers(now time.Time) error {
+	if self.cfg.UnconfirmedUsersWarningPeriod == "" {
+		return nil
 	}
 
 	maxUnconfirmedUsersAge, err := time.ParseDuration(self.cfg.MaxUnconfirmedUsersAge)
@@ -288,11 +715,42 @@ func (self authImpl) RemoveUnconfirmedUsers(adminKey string) error {
 		return err
 	}
 
-	date := time.Now().Add(-1 * maxUnconfirmedUsersAge)
-	return self.store.removeUnconfirmedUsersCreatedBefore(date)
+	warningPeriod, err := time.ParseDuration(self.cfg.UnconfirmedUsersWarningPeriod)
+	if err != nil {
+		return err
+	}
+
+	date := now.Add(warningPeriod - maxUnconfirmedUsersAge)
+
+	users, err := self.store.GetUnwarnedUnconfirmedUsersCreatedBefore(self.cfg.Tenant, date)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		removalDate := user.CreatedAt.Add(maxUnconfirmedUsersAge)
+		if !removalDate.After(now) {
+			continue
+		}
+
+		if err = self.sendRemovalWarningEmail(user, removalDate); err != nil {
+			log.Printf("auth: removal warning to user %s failed: %s", user.Id, err)
+			continue
+		}
+
+		if err = self.store.SetUserRemovalWarnedAt(user.Id, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (self authImpl) createUser(email, password, lang string, isConfirmed bool) (confirmationKey string, err error) {
+	if err = self.checkEmailDomain(email); err != nil {
+		return
+	}
+
 	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return
@@ -302,13 +760,150 @@ func (self authImpl) createUser(email, password, lang string, isConfirmed bool)
 	createdAt := time.Now()
 	confirmationKey = uuid.NewV4().String()
 
-	err = self.store.createUser(userId, createdAt, email, string(hashedPass), lang, confirmationKey)
+	err = self.store.WithTx(func(tx Store) error {
+		err := tx.CreateUser(userId, createdAt, self.cfg.Tenant, email, string(hashedPass), lang, confirmationKey)
+		if err != nil || !isConfirmed {
+			return alreadyExists(err, ErrEmailTaken)
+		}
+		if err := tx.SetUserConfirmedAt(userId, createdAt); err != nil {
+			return err
+		}
+		return tx.SetUserApprovedAt(userId, createdAt)
+	})
+	return
+}
+
+var dummyHashedPass struct {
+	once  sync.Once
+	value []byte
+}
+
+// compareDummyPassword takes as long as comparing password with the hashed
+// password of a user.
+func compareDummyPassword(password string) {
+	dummyHashedPass.once.Do(func() {
+		dummyHashedPass.value, _ = bcrypt.GenerateFromPassword([]byte(uuid.NewV4().String()), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHashedPass.value, []byte(password))
+}
+
+// inBackground runs work apart from the call, so that the call takes the
+// same time whatever work does. The work outlives the context of the call,
+// and its errors are logged.
+func (self authImpl) inBackground(work func(self authImpl) error) {
+	ctx := context.Background()
+	self = authImpl{self.cfg, self.store.WithContext(ctx), self.mailer, ctx}
+	go func() {
+		if err := work(self); err != nil {
+			log.Printf("auth: %s", err)
+		}
+	}()
+}
+
+// isAdminKey compares adminKey with cfg.AdminKey in constant time, as the
+// API layers expose the check to the network.
+func (self authImpl) isAdminKey(adminKey string) bool {
+	return subtle.ConstantTimeCompare([]byte(adminKey), []byte(self.cfg.AdminKey)) == 1
+}
+
+// lockUser locks the user for the rest of the transaction, and then reads
+// it.
+func lockUser(tx Store, userId string) (user StoredUser, err error) {
+	if err = tx.LockUser(userId); err != nil {
+		err = notFound(err, ErrUserNotFound)
+		return
+	}
+	user, err = tx.GetUser(userId)
+	err = notFound(err, ErrUserNotFound)
+	return
+}
+
+// getTenantUser reads a user of the tenant. The users of the other tenants
+// in the same database are not found.
+func getTenantUser(store Store, tenant, userId string) (user StoredUser, err error) {
+	user, err = store.GetUser(userId)
+	if err == nil && user.Tenant != tenant {
+		user, err = StoredUser{}, sql.ErrNoRows
+	}
+	err = notFound(err, ErrUserNotFound)
+	return
+}
+
+// lockTenantUser is lockUser for the ids given to the admin methods, which
+// only reach the users of the tenant.
+func lockTenantUser(tx Store, tenant, userId string) (user StoredUser, err error) {
+	if err = tx.LockUser(userId); err != nil {
+		err = notFound(err, ErrUserNotFound)
+		return
+	}
+	return getTenantUser(tx, tenant, userId)
+}
+
+func lockUserByEmail(tx Store, tenant, email string) (user StoredUser, err error) {
+	userId, err := tx.GetUserId(tenant, email)
 	if err != nil {
+		err = notFound(err, ErrUserNotFound)
 		return
 	}
+	return lockUser(tx, userId)
+}
+
+// checkPassword compares password with the hashed password of the user.
+func checkPassword(user StoredUser, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(user.HashedPass), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// parseSession parses a session token and checks that the session still
+// exists, is not older than MaxSessionAge and, for impersonation sessions,
+// not older than MaxImpersonationAge. It also takes the access tokens, see
+// parseAccessToken.
+func (self authImpl) parseSession(sessionTokenStr string) (sessionToken privateSessionToken, err error) {
+	if strings.HasPrefix(sessionTokenStr, AccessTokenPrefix) {
+		return self.parseAccessToken(sessionTokenStr)
+	}
+
+	sessionToken, err = parseSessionToken(self.cfg.JwtKey, sessionTokenStr)
+	if err != nil {
+		return
+	}
+
+	userId, err := self.store.GetSessionUserId(sessionToken.sessionId)
+	if err != nil {
+		err = notFound(err, errSessionNotValid)
+		return
+	}
+	if userId != sessionToken.userId {
+		err = errSessionNotValid
+		return
+	}
+
+	if self.cfg.MaxSessionAge != "" {
+		var maxSessionAge time.Duration
+		maxSessionAge, err = time.ParseDuration(self.cfg.MaxSessionAge)
+		if err != nil {
+			return
+		}
+
+		if time.Now().After(sessionToken.createdAt.Add(maxSessionAge)) {
+			err = &Error{CodeTokenExpired, "The session has expired."}
+			return
+		}
+	}
+
+	if sessionToken.impersonationId != "" {
+		var maxImpersonationAge time.Duration
+		maxImpersonationAge, err = time.ParseDuration(self.cfg.MaxImpersonationAge)
+		if err != nil {
+			return
+		}
 
-	if isConfirmed {
-		err = self.store.setUserConfirmedAt(userId, createdAt)
+		if time.Now().After(sessionToken.createdAt.Add(maxImpersonationAge)) {
+			err = &Error{CodeTokenExpired, "The impersonation session has expired."}
+		}
 	}
 
 	return
@@ -334,7 +929,7 @@ func (self authImpl) sendConfirmationEmail(email, lang, confirmationKey string)
 		Body:    body,
 	}
 
-	return confirmationTokenStr, self.mailer.Send(mail)
+	return confirmationTokenStr, self.mailer.SendContext(self.ctx, mail)
 }
 
 func (self authImpl) sendResetPaswordEmail(resetKeyToken privateResetToken) (resetTokenStr string, err error) {
@@ -356,5 +951,48 @@ func (self authImpl) sendResetPaswordEmail(resetKeyToken privateResetToken) (res
 		Body:    body,
 	}
 
-	return resetTokenStr, self.mailer.Send(mail)
+	return resetTokenStr, self.mailer.SendContext(self.ctx, mail)
+}
+
+func (self authImpl) sendUnknownAccountEmail(email, lang string) error {
+	templateValues := struct{ Email string }{email}
+	body, err := util.RenderTemplate(self.cfg.UnknownAccountEmail[lang].Body, templateValues)
+	if err != nil {
+		return err
+	}
+
+	mail := mailer.Mail{
+		From:    self.cfg.FromEmail,
+		To:      []string{email},
+		Subject: self.cfg.UnknownAccountEmail[lang].Subject,
+		Body:    body,
+	}
+
+	return self.mailer.SendContext(self.ctx, mail)
+}
+
+func (self authImpl) sendRemovalWarningEmail(user StoredUser, removalDate time.Time) error {
+	confirmationToken := privateConfirmationToken{user.Email, user.Lang, user.ConfirmationKey}
+	confirmationTokenStr, err := confirmationToken.toString(self.cfg.JwtKey)
+	if err != nil {
+		return err
+	}
+
+	templateValues := struct {
+		ConfirmationTokenStr string
+		RemovalDate          time.Time
+	}{confirmationTokenStr, removalDate}
+	body, err := util.RenderTemplate(self.cfg.RemovalWarningEmail[user.Lang].Body, templateValues)
+	if err != nil {
+		return err
+	}
+
+	mail := mailer.Mail{
+		From:    self.cfg.FromEmail,
+		To:      []string{user.Email},
+		Subject: self.cfg.RemovalWarningEmail[user.Lang].Subject,
+		Body:    body,
+	}
+
+	return self.mailer.SendContext(self.ctx, mail)
 }
@@ -2,11 +2,16 @@ package auth
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/dfreire/fservices/mailer"
 	mailermock "github.com/dfreire/fservices/mailer/mock"
 	"github.com/dfreire/fservices/util"
 	"github.com/stretchr/testify/assert"
@@ -30,26 +35,69 @@ func setup() {
 func teardown() {
 }
 
-func createAuthService() (Auth, store, *mailermock.MailerMock) {
-	db, err := sql.Open("postgres", "postgres://drome:@localhost/fservices_test?sslmode=disable")
-	// db, err := sql.Open("sqlite3", ":memory:")
-	util.PanicIfNotNil(err)
+// OpenTestStore returns an empty store for a test: in the Postgres
+// database of AUTH_TEST_POSTGRES or the MySQL database of AUTH_TEST_MYSQL
+// when they are set, in an in-memory SQLite database when AUTH_TEST_SQLITE
+// is set, else in memory.
+func OpenTestStore() Store {
+	var store Store
+
+	if dataSource := os.Getenv("AUTH_TEST_POSTGRES"); dataSource != "" {
+		db, err := sql.Open("postgres", dataSource)
+		util.PanicIfNotNil(err)
+
+		_, err = db.Exec(`
+			CREATE SCHEMA IF NOT EXISTS auth;
+			DROP SCHEMA auth CASCADE;
+		`)
+		util.PanicIfNotNil(err)
+
+		store = NewStorePg(db)
+	} else if dataSource := os.Getenv("AUTH_TEST_MYSQL"); dataSource != "" {
+		db, err := sql.Open("mysql", dataSource)
+		util.PanicIfNotNil(err)
+
+		// The down steps cannot bring back the unique indexes of the older
+		// versions over the users of the previous test.
+		var hasUsers bool
+		err = db.QueryRow(mysqlMigrations.hasBaseline).Scan(&hasUsers)
+		util.PanicIfNotNil(err)
+		if hasUsers {
+			_, err = db.Exec(`DELETE FROM auth_user`)
+			util.PanicIfNotNil(err)
+		}
+
+		store = NewStoreMysql(db)
+		util.PanicIfNotNil(MigrateTo(store, 0))
+	} else if os.Getenv("AUTH_TEST_SQLITE") != "" {
+		store = OpenTestStoreSqlite()
+	} else {
+		store = NewStoreMemory()
+	}
+
+	util.PanicIfNotNil(Migrate(store))
+	return store
+}
 
-	_, err = db.Exec(`
-		CREATE SCHEMA IF NOT EXISTS auth;
-		DROP SCHEMA auth CASCADE;
-	`)
-	// _, err = db.Exec(`
-	// 	DROP TABLE IF EXISTS auth_user;
-	// `)
+// OpenTestStoreSqlite returns an empty store in an in-memory SQLite
+// database.
+func OpenTestStoreSqlite() Store {
+	db, err := sql.Open("sqlite3", ":memory:")
 	util.PanicIfNotNil(err)
 
-	storePg := NewStorePg(db)
-	util.PanicIfNotNil(storePg.createSchema())
+	// Every connection would get its own in-memory database.
+	db.SetMaxOpenConns(1)
+
+	store := NewStoreSqlite(db)
+	util.PanicIfNotNil(Migrate(store))
+	return store
+}
 
+func createAuthService() (Auth, Store, *mailermock.MailerMock) {
+	store := OpenTestStore()
 	mailer := new(mailermock.MailerMock)
 
-	return NewAuth(cfg, storePg, mailer), storePg, mailer
+	return NewAuth(cfg, store, mailer), store, mailer
 }
 
 func TestSignup(t *testing.T) {
@@ -63,16 +111,16 @@ func TestSignup(t *testing.T) {
 	confirmationToken, err := parseConfirmationToken(cfg.JwtKey, confirmationTokenStr)
 	assert.Nil(t, err)
 
-	userId, err := store.getUserId("dario.freire@gmail.com")
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
 	assert.Nil(t, err)
-	user, err := store.getPrivateUser(userId)
+	user, err := store.GetUser(userId)
 	assert.Nil(t, err)
 
 	assert.Equal(t, "dario.freire@gmail.com", confirmationToken.email)
 	assert.Equal(t, "en_US", confirmationToken.lang)
-	assert.Equal(t, user.confirmationKey, confirmationToken.key)
+	assert.Equal(t, user.ConfirmationKey, confirmationToken.key)
 	assert.NotEmpty(t, confirmationToken.key)
-	assert.True(t, user.confirmedAt.Equal(time.Time{}))
+	assert.True(t, user.ConfirmedAt.Equal(time.Time{}))
 
 	mailerMock.AssertNumberOfCalls(t, "Send", 1)
 }
@@ -104,13 +152,13 @@ func TestConfirmSignup(t *testing.T) {
 
 	t1 := time.Now()
 
-	userId, err := store.getUserId("dario.freire@gmail.com")
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
 	assert.Nil(t, err)
-	user, err := store.getPrivateUser(userId)
+	user, err := store.GetUser(userId)
 	assert.Nil(t, err)
 
-	assert.True(t, user.confirmedAt.After(t0))
-	assert.True(t, user.confirmedAt.Before(t1))
+	assert.True(t, user.ConfirmedAt.After(t0))
+	assert.True(t, user.ConfirmedAt.Before(t1))
 }
 
 func TestSignin(t *testing.T) {
@@ -133,7 +181,7 @@ func TestSignin(t *testing.T) {
 	sessionToken, err := parseSessionToken(cfg.JwtKey, sessionTokenStr)
 	assert.Nil(t, err)
 
-	userId, err := store.getUserId("dario.freire@gmail.com")
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
 	assert.Nil(t, err)
 
 	assert.Equal(t, userId, sessionToken.userId)
@@ -141,6 +189,107 @@ func TestSignin(t *testing.T) {
 	assert.True(t, sessionToken.createdAt.Unix() <= t1.Unix())
 }
 
+func TestErrors(t *testing.T) {
+	auth, store, mailerMock := createAuthService()
+	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(nil)
+
+	confirmationToken, err := auth.Signup("dario.freire@gmail.com", "123", "en_US")
+	assert.Nil(t, err)
+
+	_, err = auth.Signup("dario.freire@gmail.com", "123", "en_US")
+	assert.Equal(t, ErrEmailTaken, err)
+
+	_, err = auth.Signin("dario.freire@gmail.com", "123")
+	assert.Equal(t, ErrNotConfirmed, err)
+
+	assert.Nil(t, auth.ConfirmSignup(confirmationToken))
+
+	_, err = auth.Signin("dario.freire@gmail.com", "abc")
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	_, err = auth.Signin("dario.freire+unknown@gmail.com", "123")
+	assert.Equal(t, ErrUserNotFound, err)
+
+	_, err = auth.GetSession("not-a-token")
+	assert.Equal(t, ErrInvalidToken, err)
+
+	_, err = auth.GetUsers("not-the-admin-key")
+	assert.Equal(t, CodeUnauthorized, ErrorCode(err))
+
+	expired := cfg
+	expired.MaxSessionAge = "-1s"
+	sessionTokenStr, err := auth.Signin("dario.freire@gmail.com", "123")
+	assert.Nil(t, err)
+	_, err = NewAuth(expired, store, mailerMock).GetSession(sessionTokenStr)
+	assert.True(t, errors.Is(err, ErrTokenExpired))
+	assert.Equal(t, "The session has expired.", err.Error())
+
+	assert.Equal(t, "O token expirou.", Message(err, "pt_PT"))
+	assert.Equal(t, "The session has expired.", Message(err, "en_US"))
+	assert.Equal(t, "The password is not valid.", Message(ErrInvalidCredentials, "fr_FR"))
+	assert.Equal(t, "", ErrorCode(sql.ErrNoRows))
+
+	status, message := ErrorStatus(ErrEmailTaken)
+	assert.Equal(t, 409, status)
+	assert.Equal(t, ErrEmailTaken.Message, message)
+	status, _ = ErrorStatus(sql.ErrNoRows)
+	assert.Equal(t, 404, status)
+	status, message = ErrorStatus(errors.New("pq: connection refused"))
+	assert.Equal(t, 500, status)
+	assert.Equal(t, "Internal Server Error", message)
+}
+
+func TestGetSession(t *testing.T) {
+	auth, store, _ := createAuthService()
+
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
+	assert.Nil(t, err)
+
+	sessionTokenStr, err := auth.Signin("dario.freire@gmail.com", "123")
+	assert.Nil(t, err)
+
+	session, err := auth.GetSession(sessionTokenStr)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, session.Id)
+	assert.Equal(t, userId, session.User.Id)
+	assert.Equal(t, "dario.freire@gmail.com", session.User.Email)
+	assert.Equal(t, "", session.OrganizationId)
+	assert.Equal(t, "", session.Role)
+
+	_, err = auth.GetSession("not a token")
+	assert.NotNil(t, err)
+}
+
+func TestSignout(t *testing.T) {
+	auth, _, _ := createAuthService()
+
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+
+	sessionTokenStr, err := auth.Signin("dario.freire@gmail.com", "123")
+	assert.Nil(t, err)
+	otherSessionTokenStr, err := auth.Signin("dario.freire@gmail.com", "123")
+	assert.Nil(t, err)
+
+	organizationId, err := auth.CreateOrganization(sessionTokenStr, "Acme")
+	assert.Nil(t, err)
+	switchedTokenStr, err := auth.SwitchOrganization(sessionTokenStr, organizationId)
+	assert.Nil(t, err)
+
+	assert.Nil(t, auth.Signout(sessionTokenStr))
+
+	_, err = auth.GetSession(sessionTokenStr)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+	_, err = auth.GetSession(switchedTokenStr)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+	_, err = auth.GetSession(otherSessionTokenStr)
+	assert.Nil(t, err)
+
+	assert.Nil(t, auth.Signout(sessionTokenStr))
+	assert.Equal(t, ErrInvalidToken, auth.Signout("not a token"))
+}
+
 func TestForgotPassword(t *testing.T) {
 	auth, store, mailerMock := createAuthService()
 	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(nil)
@@ -160,14 +309,14 @@ func TestForgotPassword(t *testing.T) {
 	resetToken, err := parseResetToken(cfg.JwtKey, resetTokenStr)
 	assert.Nil(t, err)
 
-	userId, err := store.getUserId("dario.freire@gmail.com")
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
 	assert.Nil(t, err)
-	user, err := store.getPrivateUser(userId)
+	user, err := store.GetUser(userId)
 	assert.Nil(t, err)
 
 	assert.Equal(t, "dario.freire@gmail.com", resetToken.email)
 	assert.Equal(t, "en_US", resetToken.lang)
-	assert.Equal(t, user.resetKey, resetToken.key)
+	assert.Equal(t, user.ResetKey, resetToken.key)
 	assert.NotEmpty(t, resetToken.key)
 	assert.True(t, resetToken.createdAt.Unix() >= t0.Unix())
 	assert.True(t, resetToken.createdAt.Unix() <= t1.Unix())
@@ -192,12 +341,12 @@ func TestResetPassword(t *testing.T) {
 
 	assert.Nil(t, auth.ResetPassword(resetToken, "abc"))
 
-	userId, err := store.getUserId("dario.freire@gmail.com")
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
 	assert.Nil(t, err)
-	user, err := store.getPrivateUser(userId)
+	user, err := store.GetUser(userId)
 	assert.Nil(t, err)
 
-	assert.Equal(t, "", user.resetKey)
+	assert.Equal(t, "", user.ResetKey)
 
 	_, err = auth.Signin("dario.freire@gmail.com", "123")
 	assert.NotNil(t, err)
@@ -206,6 +355,34 @@ func TestResetPassword(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestResetPasswordConcurrently(t *testing.T) {
+	auth, _, mailerMock := createAuthService()
+	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(nil)
+
+	_, err := auth.Signup("dario.freire@gmail.com", "123", "en_US")
+	assert.Nil(t, err)
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "other@example.com", "123", "en_US"))
+
+	resetToken, err := auth.ForgotPasword("other@example.com", "en_US")
+	assert.Nil(t, err)
+
+	// The reset key is used once, whatever the concurrent requests.
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			errs <- auth.ResetPassword(resetToken, fmt.Sprintf("new%d", i))
+		}(i)
+	}
+
+	succeeded := 0
+	for i := 0; i < cap(errs); i++ {
+		if <-errs == nil {
+			succeeded++
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+}
+
 func TestChangePassword(t *testing.T) {
 	auth, _, mailerMock := createAuthService()
 	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(nil)
@@ -243,11 +420,207 @@ func TestChangeEmail(t *testing.T) {
 	err = auth.ChangeEmail(sessionTokenStr, "123", "dario.freire+changed@gmail.com")
 	assert.Nil(t, err)
 
-	_, err = store.getUserId("dario.freire@gmail.com")
+	_, err = store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
+	assert.NotNil(t, err)
+
+	_, err = store.GetUserId(cfg.Tenant, "dario.freire+changed@gmail.com")
+	assert.Nil(t, err)
+}
+
+func TestUpdateProfile(t *testing.T) {
+	auth, _, _ := createAuthService()
+
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+
+	sessionTokenStr, err := auth.Signin("dario.freire@gmail.com", "123")
+	assert.Nil(t, err)
+
+	profile, err := auth.GetProfile(sessionTokenStr)
+	assert.Nil(t, err)
+	assert.JSONEq(t, "{}", string(profile.UserData))
+	assert.JSONEq(t, "{}", string(profile.AdminData))
+
+	type userData struct {
+		DisplayName string `json:"displayName"`
+		Locale      string `json:"locale"`
+	}
+
+	err = auth.UpdateProfile(sessionTokenStr, userData{"Dario", "pt_PT"})
+	assert.Nil(t, err)
+
+	profile, err = auth.GetProfile(sessionTokenStr)
+	assert.Nil(t, err)
+
+	var actual userData
+	assert.Nil(t, profile.DecodeUserData(&actual))
+	assert.Equal(t, userData{"Dario", "pt_PT"}, actual)
+
+	err = auth.UpdateProfile(sessionTokenStr, json.RawMessage(`{"locale": "en_US"}`))
+	assert.NotNil(t, err)
+
+	err = auth.UpdateProfile(sessionTokenStr, map[string]string{"displayName": strings.Repeat("x", 2048)})
+	assert.NotNil(t, err)
+}
+
+func TestUpdateUserProfile(t *testing.T) {
+	auth, store, _ := createAuthService()
+
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
+	assert.Nil(t, err)
+
+	err = auth.UpdateUserProfile(cfg.AdminKey, userId, nil, json.RawMessage(`{"plan": "pro"}`))
+	assert.Nil(t, err)
+
+	profile, err := auth.GetUserProfile(cfg.AdminKey, userId)
+	assert.Nil(t, err)
+	assert.JSONEq(t, "{}", string(profile.UserData))
+	assert.JSONEq(t, `{"plan": "pro"}`, string(profile.AdminData))
+
+	_, err = auth.GetUserProfile("", userId)
+	assert.NotNil(t, err)
+}
+
+func TestOrganizations(t *testing.T) {
+	auth, store, _ := createAuthService()
+
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire+1@gmail.com", "123", "en_US"))
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire+2@gmail.com", "abc", "en_US"))
+
+	userId2, err := store.GetUserId(cfg.Tenant, "dario.freire+2@gmail.com")
+	assert.Nil(t, err)
+
+	sessionTokenStr1, err := auth.Signin("dario.freire+1@gmail.com", "123")
+	assert.Nil(t, err)
+
+	sessionTokenStr2, err := auth.Signin("dario.freire+2@gmail.com", "abc")
+	assert.Nil(t, err)
+
+	organizationId, err := auth.CreateOrganization(sessionTokenStr1, "Acme")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, organizationId)
+
+	_, err = auth.GetOrganizationMembers(sessionTokenStr1)
+	assert.NotNil(t, err)
+
+	_, err = auth.SwitchOrganization(sessionTokenStr2, organizationId)
 	assert.NotNil(t, err)
 
-	_, err = store.getUserId("dario.freire+changed@gmail.com")
+	sessionTokenStr1, err = auth.SwitchOrganization(sessionTokenStr1, organizationId)
+	assert.Nil(t, err)
+
+	sessionToken1, err := parseSessionToken(cfg.JwtKey, sessionTokenStr1)
+	assert.Nil(t, err)
+	assert.Equal(t, organizationId, sessionToken1.organizationId)
+
+	err = auth.AddOrganizationMember(sessionTokenStr1, "dario.freire+2@gmail.com", "owner")
+	assert.Equal(t, CodeInvalidArgument, ErrorCode(err))
+	assert.Nil(t, auth.AddOrganizationMember(sessionTokenStr1, "dario.freire+2@gmail.com", OrganizationRoleMember))
+
+	memberships, err := auth.GetOrganizations(sessionTokenStr2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(memberships))
+	assert.Equal(t, organizationId, memberships[0].Organization.Id)
+	assert.Equal(t, "Acme", memberships[0].Organization.Name)
+	assert.Equal(t, OrganizationRoleMember, memberships[0].Role)
+
+	sessionTokenStr2, err = auth.SwitchOrganization(sessionTokenStr2, organizationId)
+	assert.Nil(t, err)
+
+	members, err := auth.GetOrganizationMembers(sessionTokenStr2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(members))
+	assert.Equal(t, "dario.freire+1@gmail.com", members[0].Email)
+	assert.Equal(t, OrganizationRoleAdmin, members[0].Role)
+	assert.Equal(t, "dario.freire+2@gmail.com", members[1].Email)
+
+	assert.NotNil(t, auth.RemoveOrganizationMembers(sessionTokenStr2, members[0].UserId))
+
+	err = auth.SetOrganizationMemberRole(sessionTokenStr1, userId2, "owner")
+	assert.Equal(t, CodeInvalidArgument, ErrorCode(err))
+	err = auth.SetOrganizationMemberRole(sessionTokenStr1, "nobody", OrganizationRoleMember)
+	assert.Equal(t, ErrNotFound, err)
+
+	// The last admin can neither step down nor leave.
+	err = auth.SetOrganizationMemberRole(sessionTokenStr1, members[0].UserId, OrganizationRoleMember)
+	assert.Equal(t, CodeInvalidArgument, ErrorCode(err))
+	err = auth.RemoveOrganizationMembers(sessionTokenStr1, members[0].UserId)
+	assert.Equal(t, CodeInvalidArgument, ErrorCode(err))
+
+	assert.Nil(t, auth.SetOrganizationMemberRole(sessionTokenStr1, userId2, OrganizationRoleAdmin))
+	assert.Nil(t, auth.RemoveOrganizationMembers(sessionTokenStr2, members[0].UserId))
+
+	memberships, err = auth.GetOrganizations(sessionTokenStr1)
+	assert.Nil(t, err)
+	assert.Empty(t, memberships)
+
+	err = auth.RemoveOrganizationMembers(sessionTokenStr2, userId2)
+	assert.Equal(t, CodeInvalidArgument, ErrorCode(err))
+}
+
+func TestTenants(t *testing.T) {
+	auth1, store, mailerMock := createAuthService()
+
+	cfg2 := cfg
+	cfg2.Tenant = "other"
+	auth2 := NewAuth(cfg2, store, mailerMock)
+
+	assert.Nil(t, auth1.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+	assert.NotNil(t, auth1.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+	assert.Nil(t, auth2.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "abc", "en_US"))
+
+	userId1, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
+	assert.Nil(t, err)
+
+	userId2, err := store.GetUserId(cfg2.Tenant, "dario.freire@gmail.com")
+	assert.Nil(t, err)
+	assert.NotEqual(t, userId1, userId2)
+
+	_, err = auth1.Signin("dario.freire@gmail.com", "abc")
+	assert.NotNil(t, err)
+
+	_, err = auth2.Signin("dario.freire@gmail.com", "abc")
+	assert.Nil(t, err)
+
+	users, err := auth2.GetUsers(cfg.AdminKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(users))
+	assert.Equal(t, userId2, users[0].Id)
+}
+
+func TestAdminMethodsOfOtherTenants(t *testing.T) {
+	auth1, store, mailerMock := createAuthService()
+
+	cfg2 := cfg
+	cfg2.Tenant = "other"
+	auth2 := NewAuth(cfg2, store, mailerMock)
+
+	assert.Nil(t, auth1.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
+	assert.Nil(t, err)
+
+	assert.Equal(t, ErrUserNotFound, auth2.ChangeUserPassword(cfg.AdminKey, userId, "abc"))
+	assert.Equal(t, ErrUserNotFound, auth2.ChangeUserEmail(cfg.AdminKey, userId, "joe@example.com"))
+	_, err = auth2.GetUserProfile(cfg.AdminKey, userId)
+	assert.Equal(t, ErrUserNotFound, err)
+	assert.Equal(t, ErrUserNotFound, auth2.UpdateUserProfile(cfg.AdminKey, userId, nil, map[string]interface{}{"plan": "free"}))
+	assert.Nil(t, auth2.RemoveUsers(cfg.AdminKey, userId))
+
+	_, err = auth1.Signin("dario.freire@gmail.com", "123")
 	assert.Nil(t, err)
+	profile, err := auth1.GetUserProfile(cfg.AdminKey, userId)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{}`, string(profile.AdminData))
+}
+
+func TestCheckAdminKey(t *testing.T) {
+	auth, _, _ := createAuthService()
+
+	assert.Nil(t, auth.CheckAdminKey(cfg.AdminKey))
+	assert.Equal(t, ErrUnauthorized, auth.CheckAdminKey(""))
+	assert.Equal(t, ErrUnauthorized, auth.CheckAdminKey(cfg.AdminKey[:8]))
+	assert.Equal(t, ErrUnauthorized, auth.CheckAdminKey(cfg.AdminKey+"0"))
 }
 
 func TestGetUsers(t *testing.T) {
@@ -266,7 +639,7 @@ func TestGetUsers(t *testing.T) {
 
 	t1 := time.Now()
 
-	users, err := store.getAllUsers()
+	users, err := store.GetAllUsers(cfg.Tenant)
 	assert.Nil(t, err)
 
 	assert.NotEmpty(t, users[0].Id)
@@ -294,17 +667,17 @@ func TestCreateUser(t *testing.T) {
 
 	t1 := time.Now()
 
-	userId, err := store.getUserId("dario.freire@gmail.com")
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
 	assert.Nil(t, err)
 
-	user, err := store.getPrivateUser(userId)
+	user, err := store.GetUser(userId)
 	assert.Nil(t, err)
-	assert.NotEmpty(t, user.id)
-	assert.True(t, user.createdAt.After(t0))
-	assert.True(t, user.createdAt.Before(t1))
-	assert.Equal(t, "dario.freire@gmail.com", user.email)
-	assert.Equal(t, "en_US", user.lang)
-	assert.True(t, user.confirmedAt.Equal(user.createdAt))
+	assert.NotEmpty(t, user.Id)
+	assert.True(t, user.CreatedAt.After(t0))
+	assert.True(t, user.CreatedAt.Before(t1))
+	assert.Equal(t, "dario.freire@gmail.com", user.Email)
+	assert.Equal(t, "en_US", user.Lang)
+	assert.True(t, user.ConfirmedAt.Equal(user.CreatedAt))
 
 	sessionTokenStr, err := auth.Signin("dario.freire@gmail.com", "123")
 	assert.Nil(t, err)
@@ -316,7 +689,7 @@ func TestChangeUserPassword(t *testing.T) {
 
 	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
 
-	userId, err := store.getUserId("dario.freire@gmail.com")
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
 	assert.Nil(t, err)
 	assert.NotEmpty(t, userId)
 
@@ -338,17 +711,17 @@ func TestChangeUserEmail(t *testing.T) {
 
 	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
 
-	userId1, err := store.getUserId("dario.freire@gmail.com")
+	userId1, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
 	assert.Nil(t, err)
 	assert.NotEmpty(t, userId1)
 
 	err = auth.ChangeUserEmail(cfg.AdminKey, userId1, "dario.freire+changed@gmail.com")
 	assert.Nil(t, err)
 
-	_, err = store.getUserId("dario.freire@gmail.com")
+	_, err = store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
 	assert.NotNil(t, err)
 
-	userId2, err := store.getUserId("dario.freire+changed@gmail.com")
+	userId2, err := store.GetUserId(cfg.Tenant, "dario.freire+changed@gmail.com")
 	assert.Nil(t, err)
 	assert.Equal(t, userId1, userId2)
 }
@@ -357,17 +730,17 @@ func TestRemoveUsers(t *testing.T) {
 	auth, store, _ := createAuthService()
 
 	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire+1@gmail.com", "123", "en_US"))
-	userId1, err := store.getUserId("dario.freire+1@gmail.com")
+	userId1, err := store.GetUserId(cfg.Tenant, "dario.freire+1@gmail.com")
 	assert.Nil(t, err)
 	assert.NotEmpty(t, userId1)
 
 	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire+2@gmail.com", "abc", "en_US"))
-	userId2, err := store.getUserId("dario.freire+2@gmail.com")
+	userId2, err := store.GetUserId(cfg.Tenant, "dario.freire+2@gmail.com")
 	assert.Nil(t, err)
 	assert.NotEmpty(t, userId2)
 
 	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire+3@gmail.com", "qaz", "en_US"))
-	userId3, err := store.getUserId("dario.freire+3@gmail.com")
+	userId3, err := store.GetUserId(cfg.Tenant, "dario.freire+3@gmail.com")
 	assert.Nil(t, err)
 	assert.NotEmpty(t, userId3)
 
@@ -394,6 +767,272 @@ func TestRemoveUsers(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestDeletedUsersRetention(t *testing.T) {
+	store := OpenTestStore()
+	cfg := cfg
+	cfg.DeletedUsersRetention = "1h"
+	auth := NewAuth(cfg, store, nil)
+
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
+	assert.Nil(t, err)
+
+	sessionTokenStr, err := auth.Signin("dario.freire@gmail.com", "123")
+	assert.Nil(t, err)
+
+	assert.Nil(t, auth.RemoveUsers(cfg.AdminKey, userId))
+
+	_, err = auth.Signin("dario.freire@gmail.com", "123")
+	assert.NotNil(t, err)
+	_, err = auth.GetSession(sessionTokenStr)
+	assert.NotNil(t, err)
+	users, err := auth.GetUsers(cfg.AdminKey)
+	assert.Nil(t, err)
+	assert.Empty(t, users)
+	assert.Equal(t, ErrEmailTaken, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+
+	scheduler, err := NewScheduler(auth)
+	assert.Nil(t, err)
+
+	jobRun, ran, err := scheduler.runJob(JobPurgeDeletedUsers, time.Nanosecond)
+	assert.Nil(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, int64(0), jobRun.Affected)
+
+	// A retention of 0s purges the deleted users at the next run.
+	auth.cfg.DeletedUsersRetention = "0s"
+	scheduler, err = NewScheduler(auth)
+	assert.Nil(t, err)
+
+	time.Sleep(2 * time.Nanosecond)
+
+	jobRun, ran, err = scheduler.runJob(JobPurgeDeletedUsers, time.Nanosecond)
+	assert.Nil(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, int64(1), jobRun.Affected)
+
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+}
+
+func TestImpersonateUser(t *testing.T) {
+	auth, store, _ := createAuthService()
+
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
+	assert.Nil(t, err)
+
+	_, err = auth.ImpersonateUser("", userId, "Support ticket #42")
+	assert.NotNil(t, err)
+
+	_, err = auth.ImpersonateUser(cfg.AdminKey, userId, "")
+	assert.NotNil(t, err)
+
+	sessionTokenStr, err := auth.ImpersonateUser(cfg.AdminKey, userId, "Support ticket #42")
+	assert.Nil(t, err)
+
+	sessionToken, err := parseSessionToken(cfg.JwtKey, sessionTokenStr)
+	assert.Nil(t, err)
+	assert.Equal(t, userId, sessionToken.userId)
+	assert.NotEmpty(t, sessionToken.impersonationId)
+
+	_, err = auth.GetProfile(sessionTokenStr)
+	assert.Nil(t, err)
+
+	assert.NotNil(t, auth.ChangePassword(sessionTokenStr, "123", "abc"))
+	assert.NotNil(t, auth.ChangeEmail(sessionTokenStr, "123", "dario.freire+changed@gmail.com"))
+
+	impersonations, err := auth.GetImpersonations(cfg.AdminKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(impersonations))
+	assert.Equal(t, sessionToken.impersonationId, impersonations[0].Id)
+	assert.Equal(t, userId, impersonations[0].UserId)
+	assert.Equal(t, "Support ticket #42", impersonations[0].Reason)
+
+	sessionToken.createdAt = time.Now().Add(-1 * time.Hour)
+	expiredSessionTokenStr, err := sessionToken.toString(cfg.JwtKey)
+	assert.Nil(t, err)
+
+	_, err = auth.GetProfile(expiredSessionTokenStr)
+	assert.NotNil(t, err)
+
+	// Without MaxImpersonationAge, the impersonation sessions last an hour.
+	cfg2 := cfg
+	cfg2.MaxImpersonationAge = ""
+	auth2 := NewAuth(cfg2, store, nil)
+
+	_, err = auth2.GetProfile(sessionTokenStr)
+	assert.Nil(t, err)
+
+	sessionToken.createdAt = time.Now().Add(-2 * time.Hour)
+	expiredSessionTokenStr, err = sessionToken.toString(cfg.JwtKey)
+	assert.Nil(t, err)
+
+	_, err = auth2.GetProfile(expiredSessionTokenStr)
+	assert.True(t, errors.Is(err, ErrTokenExpired))
+}
+
+func TestImpersonateUserOfOtherTenant(t *testing.T) {
+	auth1, store, mailerMock := createAuthService()
+
+	cfg2 := cfg
+	cfg2.Tenant = "other"
+	auth2 := NewAuth(cfg2, store, mailerMock)
+
+	assert.Nil(t, auth1.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
+	assert.Nil(t, err)
+
+	_, err = auth2.ImpersonateUser(cfg.AdminKey, userId, "Support ticket #42")
+	assert.Equal(t, ErrUserNotFound, err)
+
+	impersonations, err := auth2.GetImpersonations(cfg.AdminKey)
+	assert.Nil(t, err)
+	assert.Empty(t, impersonations)
+}
+
+func TestAccessTokens(t *testing.T) {
+	auth, store, _ := createAuthService()
+
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+
+	sessionTokenStr, err := auth.Signin("dario.freire@gmail.com", "123")
+	assert.Nil(t, err)
+
+	_, err = auth.CreateAccessToken(sessionTokenStr, "", nil, time.Time{})
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = auth.CreateAccessToken(sessionTokenStr, "CI", []string{"read write"}, time.Time{})
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = auth.CreateAccessToken(sessionTokenStr, "CI", nil, time.Now().Add(-time.Hour))
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	accessTokenStr, err := auth.CreateAccessToken(sessionTokenStr, "CI", []string{"read"}, time.Time{})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(accessTokenStr, AccessTokenPrefix))
+
+	// The store only has the hash of the token.
+	_, _, err = store.GetAccessTokenByHash(accessTokenStr)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	session, err := auth.GetSession(accessTokenStr)
+	assert.Nil(t, err)
+	assert.Equal(t, "", session.Id)
+	assert.NotEmpty(t, session.AccessTokenId)
+	assert.Equal(t, []string{"read"}, session.Scopes)
+	assert.Equal(t, "dario.freire@gmail.com", session.User.Email)
+
+	accessTokens, err := auth.GetAccessTokens(accessTokenStr)
+	assert.Nil(t, err)
+	if assert.Len(t, accessTokens, 1) {
+		assert.Equal(t, session.AccessTokenId, accessTokens[0].Id)
+		assert.Equal(t, "CI", accessTokens[0].Name)
+		assert.False(t, accessTokens[0].LastUsedAt.IsZero())
+	}
+
+	_, err = auth.GetProfile(accessTokenStr)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrAccessTokenNotAllowed, auth.ChangePassword(accessTokenStr, "123", "abc"))
+	assert.Equal(t, ErrAccessTokenNotAllowed, auth.ChangeEmail(accessTokenStr, "123", "dario.freire+changed@gmail.com"))
+	_, err = auth.CreateAccessToken(accessTokenStr, "Other", nil, time.Time{})
+	assert.Equal(t, ErrAccessTokenNotAllowed, err)
+	_, err = auth.SwitchOrganization(accessTokenStr, "")
+	assert.Equal(t, ErrAccessTokenNotAllowed, err)
+	assert.Equal(t, ErrAccessTokenNotAllowed, auth.UpdateProfile(accessTokenStr, map[string]string{"name": "Dario"}))
+	_, err = auth.CreateOrganization(accessTokenStr, "Acme")
+	assert.Equal(t, ErrAccessTokenNotAllowed, err)
+	assert.Equal(t, ErrAccessTokenNotAllowed, auth.RevokeAccessTokens(accessTokenStr, session.AccessTokenId))
+	assert.Equal(t, ErrAccessTokenNotAllowed, auth.Signout(accessTokenStr))
+	assert.Equal(t, ErrAccessTokenNotAllowed, auth.AddOrganizationMember(accessTokenStr, "joe@example.com", OrganizationRoleMember))
+	assert.Equal(t, ErrAccessTokenNotAllowed, auth.SetOrganizationMemberRole(accessTokenStr, session.User.Id, OrganizationRoleMember))
+	assert.Equal(t, ErrAccessTokenNotAllowed, auth.RemoveOrganizationMembers(accessTokenStr, session.User.Id))
+
+	_, err = auth.GetSession(AccessTokenPrefix + "unknown")
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+
+	expiredTokenStr := AccessTokenPrefix + "expired"
+	expired := AccessToken{Id: "expired", CreatedAt: time.Now().Add(-2 * time.Hour), Name: "Expired", ExpiresAt: time.Now().Add(-time.Hour)}
+	assert.Nil(t, store.CreateAccessToken(session.User.Id, hashSecret(expiredTokenStr), expired))
+	_, err = auth.GetSession(expiredTokenStr)
+	assert.True(t, errors.Is(err, ErrTokenExpired))
+
+	assert.Nil(t, auth.RevokeAccessTokens(sessionTokenStr, session.AccessTokenId))
+	_, err = auth.GetSession(accessTokenStr)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+
+	accessTokens, err = auth.GetAccessTokens(sessionTokenStr)
+	assert.Nil(t, err)
+	assert.Len(t, accessTokens, 1)
+}
+
+func TestServiceAccounts(t *testing.T) {
+	auth, _, _ := createAuthService()
+
+	_, _, err := auth.CreateServiceAccount("", "Deploy", nil)
+	assert.Equal(t, ErrUnauthorized, err)
+	_, _, err = auth.CreateServiceAccount(cfg.AdminKey, "", nil)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	serviceAccount, clientSecret, err := auth.CreateServiceAccount(cfg.AdminKey, "Deploy", []string{"deploy", "read"})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(clientSecret, ServiceSecretPrefix))
+
+	serviceAccounts, err := auth.GetServiceAccounts(cfg.AdminKey)
+	assert.Nil(t, err)
+	if assert.Len(t, serviceAccounts, 1) {
+		assert.Equal(t, serviceAccount.Id, serviceAccounts[0].Id)
+		assert.Equal(t, []string{"deploy", "read"}, serviceAccounts[0].Scopes)
+	}
+
+	_, err = auth.IssueServiceToken(serviceAccount.Id, "wrong", nil)
+	assert.Equal(t, ErrInvalidClient, err)
+	_, err = auth.IssueServiceToken("unknown", clientSecret, nil)
+	assert.Equal(t, ErrInvalidClient, err)
+	_, err = auth.IssueServiceToken(serviceAccount.Id, clientSecret, []string{"admin"})
+	assert.True(t, errors.Is(err, ErrInvalidScope))
+
+	serviceToken, err := auth.IssueServiceToken(serviceAccount.Id, clientSecret, []string{"read"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"read"}, serviceToken.Scopes)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), serviceToken.ExpiresAt, time.Second)
+
+	serviceSession, err := auth.GetServiceSession(serviceToken.Token)
+	assert.Nil(t, err)
+	assert.Equal(t, serviceAccount.Id, serviceSession.ServiceAccountId)
+	assert.Equal(t, "Deploy", serviceSession.Name)
+	assert.Equal(t, []string{"read"}, serviceSession.Scopes)
+
+	// The service tokens and the session tokens are not interchangeable.
+	_, err = auth.GetSession(serviceToken.Token)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	serviceToken, err = auth.IssueServiceToken(serviceAccount.Id, clientSecret, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"deploy", "read"}, serviceToken.Scopes)
+
+	expired := privateServiceToken{serviceAccount.Id, nil, time.Now().Add(-2 * time.Hour), time.Now().Add(-time.Hour)}
+	expiredTokenStr, err := expired.toString(cfg.JwtKey)
+	assert.Nil(t, err)
+	_, err = auth.GetServiceSession(expiredTokenStr)
+	assert.Equal(t, ErrTokenExpired, err)
+
+	newClientSecret, err := auth.RotateServiceAccountSecret(cfg.AdminKey, serviceAccount.Id)
+	assert.Nil(t, err)
+	_, err = auth.IssueServiceToken(serviceAccount.Id, clientSecret, nil)
+	assert.Equal(t, ErrInvalidClient, err)
+	_, err = auth.IssueServiceToken(serviceAccount.Id, newClientSecret, nil)
+	assert.Nil(t, err)
+
+	_, err = auth.RotateServiceAccountSecret(cfg.AdminKey, "unknown")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.Nil(t, auth.DisableServiceAccount(cfg.AdminKey, serviceAccount.Id))
+	assert.Nil(t, auth.DisableServiceAccount(cfg.AdminKey, serviceAccount.Id))
+	_, err = auth.IssueServiceToken(serviceAccount.Id, newClientSecret, nil)
+	assert.Equal(t, ErrInvalidClient, err)
+	_, err = auth.GetServiceSession(serviceToken.Token)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+}
+
 func TestRemoveUnconfirmedUsers(t *testing.T) {
 	auth, store, mailerMock := createAuthService()
 
@@ -406,23 +1045,447 @@ func TestRemoveUnconfirmedUsers(t *testing.T) {
 
 	t1 := time.Now()
 
-	userId, err := store.getUserId("dario.freire@gmail.com")
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
 	assert.Nil(t, err)
 
-	user, err := store.getPrivateUser(userId)
+	user, err := store.GetUser(userId)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, user.Id)
+	assert.True(t, user.CreatedAt.After(t0))
+	assert.True(t, user.CreatedAt.Before(t1))
+	assert.Equal(t, "dario.freire@gmail.com", user.Email)
+	assert.Equal(t, "en_US", user.Lang)
+	assert.True(t, user.ConfirmedAt.Equal(time.Time{}))
+
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire+confirmed@gmail.com", "123", "en_US"))
+
+	confirmedUserId, err := store.GetUserId(cfg.Tenant, "dario.freire+confirmed@gmail.com")
 	assert.Nil(t, err)
-	assert.NotEmpty(t, user.id)
-	assert.True(t, user.createdAt.After(t0))
-	assert.True(t, user.createdAt.Before(t1))
-	assert.Equal(t, "dario.freire@gmail.com", user.email)
-	assert.Equal(t, "en_US", user.lang)
-	assert.True(t, user.confirmedAt.Equal(time.Time{}))
 
 	time.Sleep(2 * time.Nanosecond)
 
-	err = auth.RemoveUnconfirmedUsers(cfg.AdminKey)
+	removedUsers, err := auth.RemoveUnconfirmedUsers(cfg.AdminKey, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(removedUsers))
+	assert.Equal(t, userId, removedUsers[0].Id)
+
+	_, err = store.GetUser(userId)
+	assert.Nil(t, err)
+
+	removedUsers, err = auth.RemoveUnconfirmedUsers(cfg.AdminKey, false)
 	assert.Nil(t, err)
+	assert.Equal(t, 1, len(removedUsers))
+	assert.Equal(t, userId, removedUsers[0].Id)
 
-	_, err = store.getPrivateUser(userId)
+	_, err = store.GetUser(userId)
 	assert.NotNil(t, err)
+
+	_, err = store.GetUser(confirmedUserId)
+	assert.Nil(t, err)
+}
+
+func TestUnconfirmedUsersRemovalWarning(t *testing.T) {
+	_, store, mailerMock := createAuthService()
+	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(nil)
+
+	cfg2 := cfg
+	cfg2.MaxUnconfirmedUsersAge = "1h"
+	cfg2.UnconfirmedUsersWarningPeriod = "1h"
+	auth := NewAuth(cfg2, store, mailerMock)
+
+	_, err := auth.Signup("dario.freire@gmail.com", "123", "en_US")
+	assert.Nil(t, err)
+
+	time.Sleep(2 * time.Nanosecond)
+
+	removedUsers, err := auth.RemoveUnconfirmedUsers(cfg.AdminKey, false)
+	assert.Nil(t, err)
+	assert.Empty(t, removedUsers)
+
+	removedUsers, err = auth.RemoveUnconfirmedUsers(cfg.AdminKey, false)
+	assert.Nil(t, err)
+	assert.Empty(t, removedUsers)
+
+	mailerMock.AssertNumberOfCalls(t, "Send", 2)
+}
+
+func TestUnconfirmedUsersRemovalWarningOverdue(t *testing.T) {
+	_, store, mailerMock := createAuthService()
+	mailerMock.On("Send", mock.MatchedBy(func(mail mailer.Mail) bool {
+		return mail.To[0] == "failing@example.com"
+	})).Return(errors.New("The mail server is down."))
+	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(nil)
+
+	cfg2 := cfg
+	cfg2.MaxUnconfirmedUsersAge = "1h"
+	cfg2.UnconfirmedUsersWarningPeriod = "1h"
+	auth := NewAuth(cfg2, store, mailerMock)
+
+	now := time.Now()
+	assert.Nil(t, store.CreateUser("overdue", now.Add(-2*time.Hour), cfg.Tenant, "overdue@example.com", "hashedPass", "en_US", "key-1"))
+	assert.Nil(t, store.CreateUser("failing", now.Add(-30*time.Minute), cfg.Tenant, "failing@example.com", "hashedPass", "en_US", "key-2"))
+	assert.Nil(t, store.CreateUser("warned", now.Add(-30*time.Minute), cfg.Tenant, "warned@example.com", "hashedPass", "en_US", "key-3"))
+
+	removedUsers, err := auth.RemoveUnconfirmedUsers(cfg.AdminKey, false)
+	assert.Nil(t, err)
+	if assert.Len(t, removedUsers, 1) {
+		assert.Equal(t, "overdue", removedUsers[0].Id)
+	}
+
+	// The overdue user gets no warning, and the failed one is tried again.
+	mailerMock.AssertNumberOfCalls(t, "Send", 2)
+	for _, call := range mailerMock.Calls {
+		assert.NotEqual(t, []string{"overdue@example.com"}, call.Arguments.Get(0).(mailer.Mail).To)
+	}
+
+	unwarnedUsers, err := store.GetUnwarnedUnconfirmedUsersCreatedBefore(cfg.Tenant, now)
+	assert.Nil(t, err)
+	if assert.Len(t, unwarnedUsers, 1) {
+		assert.Equal(t, "failing", unwarnedUsers[0].Id)
+	}
+}
+
+func TestHideAccounts(t *testing.T) {
+	_, store, mailerMock := createAuthService()
+	sent := make(chan mailer.Mail, 1)
+	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(nil).Run(func(args mock.Arguments) {
+		sent <- args.Get(0).(mailer.Mail)
+	})
+	nextMail := func() mailer.Mail {
+		select {
+		case mail := <-sent:
+			return mail
+		case <-time.After(5 * time.Second):
+			t.Fatal("no mail was sent")
+			return mailer.Mail{}
+		}
+	}
+
+	cfg2 := cfg
+	cfg2.HideAccounts = true
+	auth := NewAuth(cfg2, store, mailerMock)
+
+	_, err := auth.Signup("dario.freire@gmail.com", "123", "en_US")
+	assert.Nil(t, err)
+	nextMail()
+
+	_, err = auth.Signin("dario.freire@gmail.com", "abc")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	_, err = auth.Signin("dario.freire+unknown@gmail.com", "abc")
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	// The unconfirmed account gets the confirmation mail again.
+	resetTokenStr, err := auth.ForgotPasword("dario.freire@gmail.com", "en_US")
+	assert.Nil(t, err)
+	assert.Empty(t, resetTokenStr)
+	assert.Equal(t, cfg.ConfirmationEmail["en_US"].Subject, nextMail().Subject)
+
+	resetTokenStr, err = auth.ForgotPasword("dario.freire+unknown@gmail.com", "en_US")
+	assert.Nil(t, err)
+	assert.Empty(t, resetTokenStr)
+	unknownAccountMail := nextMail()
+	assert.Equal(t, cfg.UnknownAccountEmail["en_US"].Subject, unknownAccountMail.Subject)
+	assert.Equal(t, []string{"dario.freire+unknown@gmail.com"}, unknownAccountMail.To)
+	assert.Contains(t, unknownAccountMail.Body, "unknown@gmail.com")
+
+	confirmationTokenStr, err := auth.ResendConfirmationMail("dario.freire@gmail.com", "en_US")
+	assert.Nil(t, err)
+	assert.Empty(t, confirmationTokenStr)
+	assert.Equal(t, cfg.ConfirmationEmail["en_US"].Subject, nextMail().Subject)
+
+	confirmationTokenStr, err = auth.ResendConfirmationMail("dario.freire+unknown@gmail.com", "en_US")
+	assert.Nil(t, err)
+	assert.Empty(t, confirmationTokenStr)
+	assert.Equal(t, cfg.UnknownAccountEmail["en_US"].Subject, nextMail().Subject)
+
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
+	assert.Nil(t, err)
+	assert.Nil(t, store.SetUserConfirmedAt(userId, time.Now()))
+
+	// The confirmed account gets the reset mail, but its token is not returned.
+	resetTokenStr, err = auth.ForgotPasword("dario.freire@gmail.com", "en_US")
+	assert.Nil(t, err)
+	assert.Empty(t, resetTokenStr)
+	assert.Equal(t, cfg.ResetPasswordEmail["en_US"].Subject, nextMail().Subject)
+
+	// A failed mail is not told either.
+	mailerMock.ExpectedCalls = nil
+	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(errors.New("The mail server is down.")).Run(func(args mock.Arguments) {
+		sent <- args.Get(0).(mailer.Mail)
+	})
+	resetTokenStr, err = auth.ForgotPasword("dario.freire@gmail.com", "en_US")
+	assert.Nil(t, err)
+	assert.Empty(t, resetTokenStr)
+	nextMail()
+}
+
+func TestEmailDomains(t *testing.T) {
+	_, store, mailerMock := createAuthService()
+	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(nil)
+
+	cfg2 := cfg
+	cfg2.AllowedEmailDomains = []string{"acme.com", "*.acme.com"}
+	cfg2.DeniedEmailDomains = []string{"old.acme.com"}
+	auth := NewAuth(cfg2, store, mailerMock)
+
+	_, err := auth.Signup("dario@acme.com", "123", "en_US")
+	assert.Nil(t, err)
+	_, err = auth.Signup("dario@eu.ACME.com", "123", "en_US")
+	assert.Nil(t, err)
+	_, err = auth.Signup("dario@old.acme.com", "123", "en_US")
+	assert.Equal(t, ErrEmailDomainDenied, err)
+	_, err = auth.Signup("dario@notacme.com", "123", "en_US")
+	assert.Equal(t, ErrEmailDomainNotAllowed, err)
+	assert.Equal(t, ErrEmailDomainNotAllowed, auth.CreateUser(cfg.AdminKey, "dario@gmail.com", "123", "en_US"))
+
+	cfg2.AllowedEmailDomains = []string{"*.München.de", "xn--bcher-kva.de"}
+	cfg2.DeniedEmailDomains = []string{"alt.münchen.de"}
+	auth = NewAuth(cfg2, store, mailerMock)
+
+	_, err = auth.Signup("dario@stadt.xn--mnchen-3ya.de", "123", "en_US")
+	assert.Nil(t, err)
+	_, err = auth.Signup("dario@rathaus.münchen.de", "123", "en_US")
+	assert.Nil(t, err)
+	_, err = auth.Signup("dario@bücher.de", "123", "en_US")
+	assert.Nil(t, err)
+	_, err = auth.Signup("dario@alt.xn--mnchen-3ya.de", "123", "en_US")
+	assert.Equal(t, ErrEmailDomainDenied, err)
+
+	cfg2 = cfg
+	cfg2.DenyDisposableEmails = true
+	auth = NewAuth(cfg2, store, mailerMock)
+
+	_, err = auth.Signup("dario@mailinator.com", "123", "en_US")
+	assert.Equal(t, ErrDisposableEmail, err)
+	_, err = auth.Signup("dario@eu.mailinator.com", "123", "en_US")
+	assert.Equal(t, ErrDisposableEmail, err)
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario@gmail.com", "123", "en_US"))
+
+	cfg2.DisposableEmailDomains = []string{"example-throwaway.com"}
+	auth = NewAuth(cfg2, store, mailerMock)
+
+	_, err = auth.Signup("dario@example-throwaway.com", "123", "en_US")
+	assert.Equal(t, ErrDisposableEmail, err)
+	_, err = auth.Signup("dario@mailinator.com", "123", "en_US")
+	assert.Nil(t, err)
+}
+
+func TestApproval(t *testing.T) {
+	_, store, mailerMock := createAuthService()
+	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(nil)
+
+	cfg2 := cfg
+	cfg2.RequireApproval = true
+	auth := NewAuth(cfg2, store, mailerMock)
+
+	for _, email := range []string{"dario.freire@gmail.com", "joe@example.com"} {
+		confirmationToken, err := auth.Signup(email, "123", "en_US")
+		assert.Nil(t, err)
+		assert.Nil(t, auth.ConfirmSignup(confirmationToken))
+	}
+
+	_, err := auth.Signin("dario.freire@gmail.com", "123")
+	assert.Equal(t, ErrPendingApproval, err)
+
+	users, err := auth.GetUnapprovedUsers(cfg.AdminKey)
+	assert.Nil(t, err)
+	assert.Len(t, users, 2)
+
+	assert.Equal(t, ErrUnauthorized, auth.ApproveUser("", users[0].Id))
+
+	// The admins of other tenants do not reach these users.
+	cfg3 := cfg2
+	cfg3.Tenant = "other"
+	otherAuth := NewAuth(cfg3, store, mailerMock)
+	assert.Equal(t, ErrUserNotFound, otherAuth.ApproveUser(cfg.AdminKey, users[0].Id))
+	assert.Equal(t, ErrUserNotFound, otherAuth.RejectUser(cfg.AdminKey, users[1].Id))
+	_, err = store.GetUser(users[1].Id)
+	assert.Nil(t, err)
+
+	assert.Nil(t, auth.ApproveUser(cfg.AdminKey, users[0].Id))
+	assert.Nil(t, auth.ApproveUser(cfg.AdminKey, users[0].Id))
+	assert.Nil(t, auth.RejectUser(cfg.AdminKey, users[1].Id))
+	assert.NotNil(t, auth.RejectUser(cfg.AdminKey, users[0].Id))
+
+	_, err = auth.Signin("dario.freire@gmail.com", "123")
+	assert.Nil(t, err)
+	_, err = store.GetUser(users[1].Id)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// Two confirmations, one approval and one rejection.
+	mailerMock.AssertNumberOfCalls(t, "Send", 4)
+	approvalMail := mailerMock.Calls[2].Arguments.Get(0).(mailer.Mail)
+	assert.Equal(t, cfg.ApprovalEmail["en_US"].Subject, approvalMail.Subject)
+	rejectionMail := mailerMock.Calls[3].Arguments.Get(0).(mailer.Mail)
+	assert.Equal(t, cfg.RejectionEmail["en_US"].Subject, rejectionMail.Subject)
+	assert.Equal(t, []string{"joe@example.com"}, rejectionMail.To)
+
+	// Without approval, the confirmed users are approved.
+	confirmationToken, err := NewAuth(cfg, store, mailerMock).Signup("ann@example.com", "123", "en_US")
+	assert.Nil(t, err)
+	assert.Nil(t, NewAuth(cfg, store, mailerMock).ConfirmSignup(confirmationToken))
+	users, err = auth.GetUnapprovedUsers(cfg.AdminKey)
+	assert.Nil(t, err)
+	assert.Empty(t, users)
+}
+
+func TestScheduler(t *testing.T) {
+	auth, store, mailerMock := createAuthService()
+	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(nil)
+
+	_, err := auth.Signup("dario.freire+unconfirmed@gmail.com", "123", "en_US")
+	assert.Nil(t, err)
+
+	assert.Nil(t, auth.CreateUser(cfg.AdminKey, "dario.freire@gmail.com", "123", "en_US"))
+
+	_, err = auth.ForgotPasword("dario.freire@gmail.com", "en_US")
+	assert.Nil(t, err)
+
+	userId, err := store.GetUserId(cfg.Tenant, "dario.freire@gmail.com")
+	assert.Nil(t, err)
+	assert.Nil(t, store.SetUserResetKey(userId, "stale", time.Now().Add(-1*time.Hour)))
+
+	scheduler1, err := NewScheduler(auth.(authImpl))
+	assert.Nil(t, err)
+
+	scheduler2, err := NewScheduler(auth.(authImpl))
+	assert.Nil(t, err)
+
+	jobRun, ran, err := scheduler1.runJob(JobClearStaleResetKeys, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, int64(1), jobRun.Affected)
+
+	user, err := store.GetUser(userId)
+	assert.Nil(t, err)
+	assert.Equal(t, "", user.ResetKey)
+
+	_, ran, err = scheduler2.runJob(JobClearStaleResetKeys, time.Hour)
+	assert.Nil(t, err)
+	assert.False(t, ran)
+
+	time.Sleep(2 * time.Nanosecond)
+
+	jobRun, ran, err = scheduler2.runJob(JobRemoveUnconfirmedUsers, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, ran)
+	assert.True(t, jobRun.Affected > 0)
+
+	jobRuns, err := auth.GetJobRuns(cfg.AdminKey, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(jobRuns))
+	assert.Equal(t, JobRemoveUnconfirmedUsers, jobRuns[0].Job)
+	assert.Equal(t, scheduler2.owner, jobRuns[0].Owner)
+	assert.Equal(t, JobClearStaleResetKeys, jobRuns[1].Job)
+	assert.Equal(t, "", jobRuns[1].Error)
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.Nil(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	store := NewStoreSqlite(db)
+	latest := sqliteMigrations.latest()
+
+	version, err := SchemaVersion(store)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, version)
+
+	assert.Nil(t, Migrate(store))
+	assert.Nil(t, Migrate(store))
+	version, err = SchemaVersion(store)
+	assert.Nil(t, err)
+	assert.Equal(t, latest, version)
+
+	assert.Nil(t, store.CreateUser("1", time.Now(), "", "dario.freire@gmail.com", "hash", "en_US", "key"))
+
+	assert.Nil(t, MigrateTo(store, 1))
+	version, err = SchemaVersion(store)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, version)
+
+	assert.Nil(t, Migrate(store))
+	userId, err := store.GetUserId("", "dario.freire@gmail.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", userId)
+
+	assert.Nil(t, MigrateTo(store, 0))
+	assert.NotNil(t, MigrateTo(store, latest+1))
+
+	// A database created before the schema had versions is at the baseline.
+	_, err = db.Exec(sqliteMigrations.steps[0].up + `DROP TABLE auth_schema_migration;`)
+	assert.Nil(t, err)
+	version, err = SchemaVersion(store)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, version)
+	assert.Nil(t, Migrate(store))
+
+	// A schema of a newer binary is neither rolled back nor migrated.
+	_, err = db.Exec(`INSERT INTO auth_schema_migration (version, appliedAt) VALUES (?, ?)`, latest+1, time.Now())
+	assert.Nil(t, err)
+	for _, err := range []error{Migrate(store), MigrateTo(store, 0)} {
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "is newer than this binary")
+		}
+	}
+	version, err = SchemaVersion(store)
+	assert.Nil(t, err)
+	assert.Equal(t, latest+1, version)
+}
+
+func TestMigrateEmailConflicts(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.Nil(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	store := NewStoreSqlite(db)
+	assert.Nil(t, MigrateTo(store, 6))
+	assert.Nil(t, store.CreateUser("1", time.Now(), "", "dario.freire@gmail.com", "hash", "en_US", "key"))
+	assert.Nil(t, store.CreateUser("2", time.Now(), "", "Dario.Freire@gmail.com", "hash", "en_US", "key"))
+
+	err = Migrate(store)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "dario.freire@gmail.com")
+		assert.Contains(t, err.Error(), "Dario.Freire@gmail.com")
+	}
+
+	assert.Nil(t, store.SetUserEmail("2", "dario.freire+2@gmail.com"))
+	assert.Nil(t, Migrate(store))
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email, normalized, withProviderRules string
+	}{
+		{" Dario.Freire@Example.COM ", "Dario.Freire@example.com", "Dario.Freire@example.com"},
+		{"dario@bücher.example", "dario@xn--bcher-kva.example", "dario@xn--bcher-kva.example"},
+		{"Dario.Freire+news@googlemail.com", "Dario.Freire+news@googlemail.com", "dariofreire@gmail.com"},
+		{"dario.freire+news@outlook.com", "dario.freire+news@outlook.com", "dario.freire@outlook.com"},
+	}
+	for _, test := range tests {
+		normalized, err := NormalizeEmail(test.email, false)
+		assert.Nil(t, err)
+		assert.Equal(t, test.normalized, normalized)
+
+		normalized, err = NormalizeEmail(test.email, true)
+		assert.Nil(t, err)
+		assert.Equal(t, test.withProviderRules, normalized)
+	}
+
+	for _, email := range []string{"", "dario", "@example.com", "dario@", "dario@localhost", "dario freire@example.com", "Dario <dario@example.com>", "dario@@example.com"} {
+		_, err := NormalizeEmail(email, false)
+		assert.Equal(t, ErrInvalidEmail, err, email)
+	}
+}
+
+func TestMigrationsMysql(t *testing.T) {
+	assert.Equal(t, sqliteMigrations.latest(), mysqlMigrations.latest())
+	assert.Equal(t, "DELETE FROM t WHERE version = ? AND x = ?", mysqlMigrations.bind("DELETE FROM t WHERE version = $1 AND x = $2"))
+
+	statements := mysqlMigrations.statements(mysqlMigrations.steps[2].down)
+	assert.Equal(t, 5, len(statements))
+	assert.Equal(t, "DROP TABLE auth_member", strings.TrimSpace(statements[0]))
 }
@@ -21,9 +21,11 @@ func parseConfirmationToken(jwtKey, confirmationTokenStr string) (confirmationTo
 		return []byte(jwtKey), nil
 	})
 	if err != nil {
+		err = tokenError(err)
 		return
 	}
 	if !token.Valid {
+		err = ErrInvalidToken
 		return
 	}
 
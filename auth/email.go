@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const maxEmailLength = 254
+
+// emailProvider describes the addresses that a provider delivers to the
+// same mailbox.
+type emailProvider struct {
+	domain     string
+	ignoreDots bool
+	plusTags   bool
+}
+
+var emailProviders = map[string]emailProvider{
+	"gmail.com":      {"gmail.com", true, true},
+	"googlemail.com": {"gmail.com", true, true},
+	"outlook.com":    {"outlook.com", false, true},
+	"hotmail.com":    {"hotmail.com", false, true},
+	"icloud.com":     {"icloud.com", false, true},
+	"fastmail.com":   {"fastmail.com", false, true},
+}
+
+// NormalizeEmail checks that email is an address as in RFC 5322, without a
+// display name, and returns it with the domain in lowercase punycode.
+// With providerRules, the addresses of the providers in emailProviders are
+// also reduced to their mailbox: "John.Doe+news@googlemail.com" becomes
+// "johndoe@gmail.com".
+func NormalizeEmail(email string, providerRules bool) (string, error) {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrInvalidEmail
+	}
+	local, domain := email[:at], strings.TrimSuffix(email[at+1:], ".")
+
+	domain, err := idna.Lookup.ToASCII(domain)
+	if err != nil || !strings.Contains(domain, ".") {
+		return "", ErrInvalidEmail
+	}
+
+	if provider, ok := emailProviders[domain]; ok && providerRules {
+		local = strings.ToLower(local)
+		if provider.plusTags {
+			local = strings.SplitN(local, "+", 2)[0]
+		}
+		if provider.ignoreDots {
+			local = strings.Replace(local, ".", "", -1)
+		}
+		domain = provider.domain
+	}
+
+	email = local + "@" + domain
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email || len(email) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+
+	return email, nil
+}
+
+// foldEmail is the key under which the stores without SQL compare emails,
+// which are not case sensitive.
+func foldEmail(email string) string {
+	return strings.ToLower(email)
+}
+
+func (self authImpl) normalizeEmail(email string) (string, error) {
+	return NormalizeEmail(email, self.cfg.EmailProviderRules)
+}
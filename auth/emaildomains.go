@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// bundledDisposableEmailDomains are the domains of throwaway mail services
+// that DenyDisposableEmails refuses, unless AuthConfig.DisposableEmailDomains
+// replaces them with an updated list.
+var bundledDisposableEmailDomains = []string{
+	"10minutemail.com",
+	"10minutemail.net",
+	"burnermail.io",
+	"discard.email",
+	"dispostable.com",
+	"emailondeck.com",
+	"fakeinbox.com",
+	"getairmail.com",
+	"getnada.com",
+	"grr.la",
+	"guerrillamail.biz",
+	"guerrillamail.com",
+	"guerrillamail.de",
+	"guerrillamail.info",
+	"guerrillamail.net",
+	"guerrillamail.org",
+	"guerrillamailblock.com",
+	"mailcatch.com",
+	"maildrop.cc",
+	"mailinator.com",
+	"mailinator.net",
+	"mailnesia.com",
+	"mailpoof.com",
+	"mintemail.com",
+	"moakt.com",
+	"mohmal.com",
+	"mytemp.email",
+	"nada.email",
+	"sharklasers.com",
+	"spamgourmet.com",
+	"temp-mail.org",
+	"tempinbox.com",
+	"tempmail.com",
+	"tempmail.net",
+	"tempr.email",
+	"throwawaymail.com",
+	"trashmail.com",
+	"trashmail.net",
+	"yopmail.com",
+	"yopmail.fr",
+	"yopmail.net",
+}
+
+// ReadEmailDomains reads a list of domains, one per line. Blank lines and
+// the lines that start with # are skipped.
+func ReadEmailDomains(r io.Reader) (domains []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, strings.ToLower(line))
+	}
+	err = scanner.Err()
+	return
+}
+
+// checkEmailDomain applies the domain lists of the config to a normalized
+// email.
+func (self authImpl) checkEmailDomain(email string) error {
+	domain := email[strings.LastIndex(email, "@")+1:]
+
+	if len(self.cfg.AllowedEmailDomains) > 0 && !matchEmailDomain(domain, self.cfg.AllowedEmailDomains) {
+		return ErrEmailDomainNotAllowed
+	}
+
+	if matchEmailDomain(domain, self.cfg.DeniedEmailDomains) {
+		return ErrEmailDomainDenied
+	}
+
+	if self.cfg.DenyDisposableEmails {
+		disposableDomains := self.cfg.DisposableEmailDomains
+		if disposableDomains == nil {
+			disposableDomains = bundledDisposableEmailDomains
+		}
+		for _, disposableDomain := range disposableDomains {
+			if domain == disposableDomain || strings.HasSuffix(domain, "."+disposableDomain) {
+				return ErrDisposableEmail
+			}
+		}
+	}
+
+	return nil
+}
+
+// normalizeEmailDomains returns the domain patterns in lowercase punycode, as
+// NormalizeEmail leaves the domain of the emails, so that "*.münchen.de"
+// matches "xn--mnchen-3ya.de". A pattern that is not a valid domain is only
+// lowercased, and so matches no email. A nil list stays nil.
+func normalizeEmailDomains(patterns []string) []string {
+	if patterns == nil {
+		return nil
+	}
+
+	normalized := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		prefix, domain := "", strings.TrimSuffix(strings.TrimSpace(pattern), ".")
+		if strings.HasPrefix(domain, "*.") {
+			prefix, domain = "*.", domain[2:]
+		}
+
+		if asciiDomain, err := idna.Lookup.ToASCII(domain); err == nil {
+			domain = asciiDomain
+		}
+		normalized[i] = prefix + strings.ToLower(domain)
+	}
+	return normalized
+}
+
+// matchEmailDomain reports whether domain is one of patterns, where
+// "*.example.com" matches the subdomains of example.com. The patterns are
+// normalized by NewAuth.
+func matchEmailDomain(domain string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(domain, pattern[1:]) {
+				return true
+			}
+		} else if domain == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// The codes of the errors returned by Auth. They are stable, so that API
+// layers and clients can tell the errors apart without their messages.
+const (
+	CodeUnauthorized       = "unauthorized"
+	CodeUserNotFound       = "user_not_found"
+	CodeNotFound           = "not_found"
+	CodeNotConfirmed       = "not_confirmed"
+	CodePendingApproval    = "pending_approval"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeInvalidToken       = "invalid_token"
+	CodeTokenExpired       = "token_expired"
+	CodeEmailTaken         = "email_taken"
+	CodeAlreadyExists      = "already_exists"
+	CodeImpersonating      = "impersonating"
+	CodeNoOrganization     = "no_organization"
+	CodeInvalidArgument    = "invalid_argument"
+	CodeInvalidEmail       = "invalid_email"
+
+	CodeAccessTokenNotAllowed = "access_token_not_allowed"
+
+	// The errors of the OAuth2 client credentials grant, as in RFC 6749.
+	CodeInvalidClient = "invalid_client"
+	CodeInvalidScope  = "invalid_scope"
+
+	// The email domain policy of signup.
+	CodeEmailDomainNotAllowed = "email_domain_not_allowed"
+	CodeEmailDomainDenied     = "email_domain_denied"
+	CodeDisposableEmail       = "disposable_email"
+)
+
+// Error is an error with a code. Errors with the same code match each other
+// with errors.Is, whatever their messages, so that
+// errors.Is(err, ErrTokenExpired) holds for every kind of expired token.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (self *Error) Error() string {
+	return self.Message
+}
+
+func (self *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.Code == self.Code
+}
+
+var (
+	ErrUnauthorized       = &Error{CodeUnauthorized, "Unauthorized"}
+	ErrUserNotFound       = &Error{CodeUserNotFound, "The user does not exist."}
+	ErrNotFound           = &Error{CodeNotFound, "Not found."}
+	ErrNotConfirmed       = &Error{CodeNotConfirmed, "The account has not been confirmed."}
+	ErrPendingApproval    = &Error{CodePendingApproval, "The account is waiting for approval."}
+	ErrInvalidCredentials = &Error{CodeInvalidCredentials, "The password is not valid."}
+	ErrInvalidToken       = &Error{CodeInvalidToken, "The token is not valid."}
+	ErrTokenExpired       = &Error{CodeTokenExpired, "The token has expired."}
+	ErrEmailTaken         = &Error{CodeEmailTaken, "The email is already taken."}
+	ErrAlreadyExists      = &Error{CodeAlreadyExists, "Already exists."}
+	ErrImpersonating      = &Error{CodeImpersonating, "This operation is not allowed while impersonating a user."}
+	ErrNoOrganization     = &Error{CodeNoOrganization, "The session has no active organization."}
+	ErrInvalidArgument    = &Error{CodeInvalidArgument, "The request is not valid."}
+	ErrInvalidEmail       = &Error{CodeInvalidEmail, "The email is not valid."}
+
+	ErrAccessTokenNotAllowed = &Error{CodeAccessTokenNotAllowed, "This operation is not allowed with an access token."}
+
+	ErrInvalidClient = &Error{CodeInvalidClient, "The client credentials are not valid."}
+	ErrInvalidScope  = &Error{CodeInvalidScope, "The scope is not allowed for the client."}
+
+	ErrEmailDomainNotAllowed = &Error{CodeEmailDomainNotAllowed, "The email domain is not one of the allowed domains."}
+	ErrEmailDomainDenied     = &Error{CodeEmailDomainDenied, "The email domain is not allowed."}
+	ErrDisposableEmail       = &Error{CodeDisposableEmail, "Disposable emails are not allowed."}
+
+	errSessionNotValid = &Error{CodeInvalidToken, "The session is not valid."}
+)
+
+// ErrorCode returns the code of err, or "" when err is not an *Error.
+func ErrorCode(err error) string {
+	var authErr *Error
+	if errors.As(err, &authErr) {
+		return authErr.Code
+	}
+	return ""
+}
+
+// Messages are the texts of the error codes, by lang, for the API layers to
+// show to the users. Apps can change them or add langs. The codes without a
+// text keep the message of the error, which is more specific.
+var Messages = map[string]map[string]string{
+	"en_US": {
+		CodeUnauthorized:       "Unauthorized",
+		CodeUserNotFound:       "The user does not exist.",
+		CodeNotFound:           "Not found.",
+		CodeNotConfirmed:       "The account has not been confirmed.",
+		CodePendingApproval:    "The account is waiting for approval.",
+		CodeInvalidCredentials: "The password is not valid.",
+		CodeEmailTaken:         "The email is already taken.",
+		CodeAlreadyExists:      "Already exists.",
+		CodeImpersonating:      "This operation is not allowed while impersonating a user.",
+		CodeNoOrganization:     "The session has no active organization.",
+		CodeInvalidEmail:       "The email is not valid.",
+
+		CodeEmailDomainNotAllowed: "The email domain is not one of the allowed domains.",
+		CodeEmailDomainDenied:     "The email domain is not allowed.",
+		CodeDisposableEmail:       "Disposable emails are not allowed.",
+		CodeAccessTokenNotAllowed: "This operation is not allowed with an access token.",
+		CodeInvalidClient:         "The client credentials are not valid.",
+	},
+	"pt_PT": {
+		CodeUnauthorized:       "Não autorizado.",
+		CodeUserNotFound:       "O utilizador não existe.",
+		CodeNotFound:           "Não encontrado.",
+		CodeNotConfirmed:       "A conta ainda não foi confirmada.",
+		CodePendingApproval:    "A conta aguarda aprovação.",
+		CodeInvalidCredentials: "A palavra-passe não é válida.",
+		CodeInvalidToken:       "O token não é válido.",
+		CodeTokenExpired:       "O token expirou.",
+		CodeEmailTaken:         "O email já está a ser usado.",
+		CodeAlreadyExists:      "Já existe.",
+		CodeImpersonating:      "Esta operação não é permitida ao personificar um utilizador.",
+		CodeNoOrganization:     "A sessão não tem uma organização ativa.",
+		CodeInvalidArgument:    "Os dados do pedido não são válidos.",
+		CodeInvalidEmail:       "O email não é válido.",
+
+		CodeEmailDomainNotAllowed: "O domínio do email não é um dos domínios permitidos.",
+		CodeEmailDomainDenied:     "O domínio do email não é permitido.",
+		CodeDisposableEmail:       "Não são permitidos emails descartáveis.",
+		CodeAccessTokenNotAllowed: "Esta operação não é permitida com um token de acesso.",
+		CodeInvalidClient:         "As credenciais do cliente não são válidas.",
+		CodeInvalidScope:          "O âmbito não é permitido para o cliente.",
+	},
+}
+
+// Message returns the text of err in lang, or the message of err when
+// Messages has none.
+func Message(err error, lang string) string {
+	if message, ok := Messages[lang][ErrorCode(err)]; ok {
+		return message
+	}
+	return err.Error()
+}
+
+var errorStatuses = map[string]int{
+	CodeUnauthorized:       http.StatusUnauthorized,
+	CodeUserNotFound:       http.StatusNotFound,
+	CodeNotFound:           http.StatusNotFound,
+	CodeNotConfirmed:       http.StatusForbidden,
+	CodePendingApproval:    http.StatusForbidden,
+	CodeInvalidCredentials: http.StatusUnauthorized,
+	CodeInvalidToken:       http.StatusUnauthorized,
+	CodeTokenExpired:       http.StatusUnauthorized,
+	CodeEmailTaken:         http.StatusConflict,
+	CodeAlreadyExists:      http.StatusConflict,
+	CodeImpersonating:      http.StatusForbidden,
+	CodeNoOrganization:     http.StatusBadRequest,
+	CodeInvalidArgument:    http.StatusBadRequest,
+	CodeInvalidEmail:       http.StatusBadRequest,
+
+	CodeAccessTokenNotAllowed: http.StatusForbidden,
+	CodeInvalidClient:         http.StatusUnauthorized,
+	CodeInvalidScope:          http.StatusBadRequest,
+
+	CodeEmailDomainNotAllowed: http.StatusForbidden,
+	CodeEmailDomainDenied:     http.StatusForbidden,
+	CodeDisposableEmail:       http.StatusForbidden,
+}
+
+// ErrorStatus maps an error returned by Auth to an HTTP status code and the
+// message that is safe to send to the client, for the API layers. The
+// errors without a code are internal errors, and their messages are not
+// sent.
+func ErrorStatus(err error) (status int, message string) {
+	if status, ok := errorStatuses[ErrorCode(err)]; ok {
+		return status, err.Error()
+	}
+
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, "Not found."
+	}
+
+	return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+}
+
+func invalidArgument(message string) error {
+	return &Error{CodeInvalidArgument, message}
+}
+
+// notFound replaces sql.ErrNoRows, returned by the store, with notFoundErr.
+func notFound(err error, notFoundErr *Error) error {
+	if err == sql.ErrNoRows {
+		return notFoundErr
+	}
+	return err
+}
+
+// alreadyExists replaces the unique constraint violations of the stores
+// with existsErr.
+func alreadyExists(err error, existsErr *Error) error {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+	if strings.Contains(message, "duplicate key") || strings.Contains(message, "UNIQUE constraint failed") || strings.Contains(message, "Duplicate entry") {
+		return existsErr
+	}
+	return err
+}
+
+// tokenError replaces the errors of parsing a token.
+func tokenError(err error) error {
+	if validationErr, ok := err.(*jwt.ValidationError); ok && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+		return ErrTokenExpired
+	}
+	return ErrInvalidToken
+}
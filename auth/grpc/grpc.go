@@ -0,0 +1,149 @@
+// Package grpc exposes an auth.Auth as the gRPC service defined in auth.proto.
+package grpc
+
+//go:generate protoc --go_out=authpb --go_opt=paths=source_relative --go-grpc_out=authpb --go-grpc_opt=paths=source_relative auth.proto
+
+import (
+	"context"
+	"log"
+	stdhttp "net/http"
+	"strings"
+
+	"github.com/dfreire/fservices/auth"
+	"github.com/dfreire/fservices/auth/grpc/authpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	AuthorizationMetadataKey = "authorization"
+	AdminKeyMetadataKey      = "x-admin-key"
+)
+
+// GetServiceSession is not a session method: it takes a service token, that
+// it checks itself.
+var sessionMethods = map[string]bool{
+	authpb.Auth_GetSession_FullMethodName:                true,
+	authpb.Auth_ChangePassword_FullMethodName:            true,
+	authpb.Auth_ChangeEmail_FullMethodName:               true,
+	authpb.Auth_GetProfile_FullMethodName:                true,
+	authpb.Auth_UpdateProfile_FullMethodName:             true,
+	authpb.Auth_CreateAccessToken_FullMethodName:         true,
+	authpb.Auth_GetAccessTokens_FullMethodName:           true,
+	authpb.Auth_RevokeAccessTokens_FullMethodName:        true,
+	authpb.Auth_CreateOrganization_FullMethodName:        true,
+	authpb.Auth_GetOrganizations_FullMethodName:          true,
+	authpb.Auth_SwitchOrganization_FullMethodName:        true,
+	authpb.Auth_GetOrganizationMembers_FullMethodName:    true,
+	authpb.Auth_AddOrganizationMember_FullMethodName:     true,
+	authpb.Auth_SetOrganizationMemberRole_FullMethodName: true,
+	authpb.Auth_RemoveOrganizationMembers_FullMethodName: true,
+}
+
+var adminMethods = map[string]bool{
+	authpb.Auth_CheckAdminKey_FullMethodName:              true,
+	authpb.Auth_GetUsers_FullMethodName:                   true,
+	authpb.Auth_CreateUser_FullMethodName:                 true,
+	authpb.Auth_ChangeUserPassword_FullMethodName:         true,
+	authpb.Auth_ChangeUserEmail_FullMethodName:            true,
+	authpb.Auth_RemoveUsers_FullMethodName:                true,
+	authpb.Auth_GetUserProfile_FullMethodName:             true,
+	authpb.Auth_UpdateUserProfile_FullMethodName:          true,
+	authpb.Auth_ImpersonateUser_FullMethodName:            true,
+	authpb.Auth_GetImpersonations_FullMethodName:          true,
+	authpb.Auth_GetJobRuns_FullMethodName:                 true,
+	authpb.Auth_RemoveUnconfirmedUsers_FullMethodName:     true,
+	authpb.Auth_GetUnapprovedUsers_FullMethodName:         true,
+	authpb.Auth_ApproveUser_FullMethodName:                true,
+	authpb.Auth_RejectUser_FullMethodName:                 true,
+	authpb.Auth_CreateServiceAccount_FullMethodName:       true,
+	authpb.Auth_GetServiceAccounts_FullMethodName:         true,
+	authpb.Auth_RotateServiceAccountSecret_FullMethodName: true,
+	authpb.Auth_DisableServiceAccount_FullMethodName:      true,
+}
+
+// WithSessionToken adds the session token to the metadata of the outgoing
+// calls made with ctx.
+func WithSessionToken(ctx context.Context, sessionTokenStr string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, AuthorizationMetadataKey, "Bearer "+sessionTokenStr)
+}
+
+// WithAdminKey adds the admin key to the metadata of the outgoing calls
+// made with ctx.
+func WithAdminKey(ctx context.Context, adminKey string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, AdminKeyMetadataKey, adminKey)
+}
+
+func sessionToken(ctx context.Context) string {
+	authorization := incomingMetadata(ctx, AuthorizationMetadataKey)
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	}
+	return ""
+}
+
+func adminKey(ctx context.Context) string {
+	return incomingMetadata(ctx, AdminKeyMetadataKey)
+}
+
+func incomingMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// UnaryServerInterceptor rejects the calls to the session and admin methods
+// that do not carry a valid session token or admin key, and converts the
+// errors returned by auth.Auth to status errors.
+func UnaryServerInterceptor(a auth.Auth) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		switch {
+		case sessionMethods[info.FullMethod]:
+			if _, err := a.WithContext(ctx).GetSession(sessionToken(ctx)); err != nil {
+				return nil, Error(info.FullMethod, err)
+			}
+		case adminMethods[info.FullMethod]:
+			if err := a.CheckAdminKey(adminKey(ctx)); err != nil {
+				return nil, Error(info.FullMethod, err)
+			}
+		}
+
+		res, err := handler(ctx, req)
+		if err != nil {
+			return nil, Error(info.FullMethod, err)
+		}
+		return res, nil
+	}
+}
+
+var statusCodes = map[int]codes.Code{
+	stdhttp.StatusBadRequest:   codes.InvalidArgument,
+	stdhttp.StatusUnauthorized: codes.Unauthenticated,
+	stdhttp.StatusForbidden:    codes.PermissionDenied,
+	stdhttp.StatusNotFound:     codes.NotFound,
+	stdhttp.StatusConflict:     codes.AlreadyExists,
+}
+
+// Error converts an error returned by auth.Auth to a status error, with the
+// same classification and messages as the JSON API.
+func Error(fullMethod string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	httpStatus, message := auth.ErrorStatus(err)
+	code, ok := statusCodes[httpStatus]
+	if !ok {
+		log.Printf("auth/grpc: %s: %s", fullMethod, err)
+		code = codes.Internal
+	}
+	return status.Error(code, message)
+}
@@ -0,0 +1,380 @@
+package grpc
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"testing"
+
+	"github.com/dfreire/fservices/auth"
+	"github.com/dfreire/fservices/auth/grpc/authpb"
+	"github.com/dfreire/fservices/mailer"
+	mailermock "github.com/dfreire/fservices/mailer/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeAuth implements the few auth.Auth methods used by the tests; calling
+// any other method panics on the nil embedded interface.
+type fakeAuth struct {
+	auth.Auth
+}
+
+func (self fakeAuth) WithContext(ctx context.Context) auth.Auth {
+	return self
+}
+
+func (self fakeAuth) Signin(email, password string) (string, error) {
+	if email == "dario.freire@gmail.com" && password == "123" {
+		return "session-token", nil
+	}
+	return "", auth.ErrNotConfirmed
+}
+
+func (self fakeAuth) GetSession(sessionTokenStr string) (auth.Session, error) {
+	if sessionTokenStr != "session-token" {
+		return auth.Session{}, auth.ErrInvalidToken
+	}
+	return auth.Session{Id: "1", User: auth.User{Id: "2", Email: "dario.freire@gmail.com"}}, nil
+}
+
+func (self fakeAuth) CheckAdminKey(adminKey string) error {
+	if adminKey != "admin-key" {
+		return auth.ErrUnauthorized
+	}
+	return nil
+}
+
+func (self fakeAuth) GetUsers(adminKey string) ([]auth.User, error) {
+	return []auth.User{{Id: "2", Email: "dario.freire@gmail.com"}}, nil
+}
+
+func (self fakeAuth) RemoveUsers(adminKey string, userIds ...string) error {
+	return sql.ErrNoRows
+}
+
+func createClient(t *testing.T) authpb.AuthClient {
+	return dial(t, fakeAuth{})
+}
+
+// authCfg mails the tokens alone, so that the tests can read them.
+var authCfg = auth.AuthConfig{
+	AdminKey:               "admin-key",
+	JwtKey:                 "jwt-key",
+	MaxUnconfirmedUsersAge: "24h",
+	MaxResetKeyAge:         "15m",
+	ConfirmationEmail:      auth.AuthMailConfig{"en_US": {Subject: "Signup Confirmation", Body: "{{.ConfirmationTokenStr}}"}},
+	ResetPasswordEmail:     auth.AuthMailConfig{"en_US": {Subject: "Password Reset", Body: "{{.ResetTokenStr}}"}},
+	ApprovalEmail:          auth.AuthMailConfig{"en_US": {Subject: "Account Approved", Body: "{{.Email}}"}},
+	RejectionEmail:         auth.AuthMailConfig{"en_US": {Subject: "Account Rejected", Body: "{{.Email}}"}},
+}
+
+// createAuthClient serves an auth.Auth with cfg on the memory store, and
+// returns the client and the mailer that gets the tokens.
+func createAuthClient(t *testing.T, cfg auth.AuthConfig) (authpb.AuthClient, *mailermock.MailerMock) {
+	mailerMock := new(mailermock.MailerMock)
+	mailerMock.On("Send", mock.AnythingOfType("mailer.Mail")).Return(nil)
+
+	return dial(t, auth.NewAuth(cfg, auth.NewStoreMemory(), mailerMock)), mailerMock
+}
+
+// lastMail returns the body of the last mail sent, which is the token.
+func lastMail(mailerMock *mailermock.MailerMock) string {
+	return mailerMock.Calls[len(mailerMock.Calls)-1].Arguments.Get(0).(mailer.Mail).Body
+}
+
+func dial(t *testing.T, a auth.Auth) authpb.AuthClient {
+	listener := bufconn.Listen(1024 * 1024)
+
+	s := grpc.NewServer(grpc.UnaryInterceptor(UnaryServerInterceptor(a)))
+	Register(s, a)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return authpb.NewAuthClient(conn)
+}
+
+func TestSignin(t *testing.T) {
+	client := createClient(t)
+	ctx := context.Background()
+
+	res, err := client.Signin(ctx, &authpb.SigninRequest{Email: "dario.freire@gmail.com", Password: "123"})
+	assert.Nil(t, err)
+	assert.Equal(t, "session-token", res.SessionToken)
+
+	_, err = client.Signin(ctx, &authpb.SigninRequest{Email: "dario.freire@gmail.com", Password: "abc"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, "The account has not been confirmed.", status.Convert(err).Message())
+}
+
+func TestSessionToken(t *testing.T) {
+	client := createClient(t)
+	ctx := context.Background()
+
+	session, err := client.GetSession(WithSessionToken(ctx, "session-token"), &authpb.Empty{})
+	assert.Nil(t, err)
+	assert.Equal(t, "dario.freire@gmail.com", session.User.Email)
+	assert.Nil(t, session.User.ConfirmedAt)
+
+	_, err = client.GetSession(ctx, &authpb.Empty{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The interceptor rejects the call before it reaches the server.
+	_, err = client.GetOrganizations(WithSessionToken(ctx, "other-token"), &authpb.Empty{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAdminKey(t *testing.T) {
+	client := createClient(t)
+	ctx := context.Background()
+
+	res, err := client.GetUsers(WithAdminKey(ctx, "admin-key"), &authpb.Empty{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res.Users))
+
+	_, err = client.GetUsers(ctx, &authpb.Empty{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.RemoveUsers(WithAdminKey(ctx, "admin-key"), &authpb.RemoveUsersRequest{UserIds: []string{"3"}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestAuthSignup(t *testing.T) {
+	client, mailerMock := createAuthClient(t, authCfg)
+	ctx := context.Background()
+
+	// The tokens only reach the mailbox.
+	res, err := client.Signup(ctx, &authpb.SignupRequest{Email: "dario.freire@gmail.com", Password: "123", Lang: "en_US"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", res.String())
+
+	_, err = client.Signin(ctx, &authpb.SigninRequest{Email: "dario.freire@gmail.com", Password: "123"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	res, err = client.ResendConfirmationMail(ctx, &authpb.ResendConfirmationMailRequest{Email: "dario.freire@gmail.com", Lang: "en_US"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", res.String())
+
+	_, err = client.ConfirmSignup(ctx, &authpb.ConfirmSignupRequest{ConfirmationToken: lastMail(mailerMock)})
+	assert.Nil(t, err)
+
+	signin, err := client.Signin(ctx, &authpb.SigninRequest{Email: "dario.freire@gmail.com", Password: "123"})
+	assert.Nil(t, err)
+
+	session, err := client.GetSession(WithSessionToken(ctx, signin.SessionToken), &authpb.Empty{})
+	assert.Nil(t, err)
+	assert.Equal(t, "dario.freire@gmail.com", session.User.Email)
+	assert.NotNil(t, session.User.ConfirmedAt)
+}
+
+func TestAuthForgotPassword(t *testing.T) {
+	client, mailerMock := createAuthClient(t, authCfg)
+	ctx := context.Background()
+
+	_, err := client.CreateUser(WithAdminKey(ctx, "admin-key"), &authpb.CreateUserRequest{Email: "dario.freire@gmail.com", Password: "123", Lang: "en_US"})
+	assert.Nil(t, err)
+
+	res, err := client.ForgotPassword(ctx, &authpb.ForgotPasswordRequest{Email: "dario.freire@gmail.com", Lang: "en_US"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", res.String())
+
+	_, err = client.ResetPassword(ctx, &authpb.ResetPasswordRequest{ResetToken: "not-a-token", NewPassword: "abc"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.ResetPassword(ctx, &authpb.ResetPasswordRequest{ResetToken: lastMail(mailerMock), NewPassword: "abc"})
+	assert.Nil(t, err)
+
+	_, err = client.Signin(ctx, &authpb.SigninRequest{Email: "dario.freire@gmail.com", Password: "abc"})
+	assert.Nil(t, err)
+
+	_, err = client.ForgotPassword(ctx, &authpb.ForgotPasswordRequest{Email: "dario.freire+unknown@gmail.com", Lang: "en_US"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestAuthAdminMethods(t *testing.T) {
+	client, _ := createAuthClient(t, authCfg)
+	ctx := context.Background()
+	adminCtx := WithAdminKey(ctx, "admin-key")
+
+	_, err := client.CreateUser(ctx, &authpb.CreateUserRequest{Email: "dario.freire@gmail.com", Password: "123", Lang: "en_US"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.CreateUser(adminCtx, &authpb.CreateUserRequest{Email: "dario.freire@gmail.com", Password: "123", Lang: "en_US"})
+	assert.Nil(t, err)
+	_, err = client.CreateUser(adminCtx, &authpb.CreateUserRequest{Email: "dario.freire@gmail.com", Password: "123", Lang: "en_US"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	users, err := client.GetUsers(adminCtx, &authpb.Empty{})
+	assert.Nil(t, err)
+	if assert.Len(t, users.Users, 1) {
+		_, err = client.ChangeUserPassword(adminCtx, &authpb.ChangeUserPasswordRequest{UserId: "unknown", NewPassword: "abc"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		_, err = client.RemoveUsers(adminCtx, &authpb.RemoveUsersRequest{UserIds: []string{users.Users[0].Id}})
+		assert.Nil(t, err)
+	}
+
+	users, err = client.GetUsers(adminCtx, &authpb.Empty{})
+	assert.Nil(t, err)
+	assert.Empty(t, users.Users)
+}
+
+func TestAuthApproval(t *testing.T) {
+	cfg := authCfg
+	cfg.RequireApproval = true
+	client, mailerMock := createAuthClient(t, cfg)
+	ctx := context.Background()
+	adminCtx := WithAdminKey(ctx, "admin-key")
+
+	for _, email := range []string{"dario.freire@gmail.com", "other@gmail.com"} {
+		_, err := client.Signup(ctx, &authpb.SignupRequest{Email: email, Password: "123", Lang: "en_US"})
+		assert.Nil(t, err)
+		_, err = client.ConfirmSignup(ctx, &authpb.ConfirmSignupRequest{ConfirmationToken: lastMail(mailerMock)})
+		assert.Nil(t, err)
+	}
+
+	_, err := client.GetUnapprovedUsers(ctx, &authpb.Empty{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	unapproved, err := client.GetUnapprovedUsers(adminCtx, &authpb.Empty{})
+	assert.Nil(t, err)
+	if !assert.Len(t, unapproved.Users, 2) {
+		return
+	}
+
+	_, err = client.Signin(ctx, &authpb.SigninRequest{Email: "dario.freire@gmail.com", Password: "123"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	for _, user := range unapproved.Users {
+		if user.Email == "dario.freire@gmail.com" {
+			_, err = client.ApproveUser(adminCtx, &authpb.ApproveUserRequest{UserId: user.Id})
+			assert.Nil(t, err)
+			assert.Equal(t, "dario.freire@gmail.com", lastMail(mailerMock))
+		} else {
+			_, err = client.RejectUser(adminCtx, &authpb.RejectUserRequest{UserId: user.Id})
+			assert.Nil(t, err)
+			assert.Equal(t, "other@gmail.com", lastMail(mailerMock))
+		}
+	}
+
+	_, err = client.Signin(ctx, &authpb.SigninRequest{Email: "dario.freire@gmail.com", Password: "123"})
+	assert.Nil(t, err)
+
+	_, err = client.ApproveUser(adminCtx, &authpb.ApproveUserRequest{UserId: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	unapproved, err = client.GetUnapprovedUsers(adminCtx, &authpb.Empty{})
+	assert.Nil(t, err)
+	assert.Empty(t, unapproved.Users)
+
+	users, err := client.GetUsers(adminCtx, &authpb.Empty{})
+	assert.Nil(t, err)
+	assert.Len(t, users.Users, 1)
+}
+
+func TestAuthAccessTokens(t *testing.T) {
+	client, _ := createAuthClient(t, authCfg)
+	ctx := context.Background()
+
+	_, err := client.CreateUser(WithAdminKey(ctx, "admin-key"), &authpb.CreateUserRequest{Email: "dario.freire@gmail.com", Password: "123", Lang: "en_US"})
+	assert.Nil(t, err)
+	signin, err := client.Signin(ctx, &authpb.SigninRequest{Email: "dario.freire@gmail.com", Password: "123"})
+	assert.Nil(t, err)
+	sessionCtx := WithSessionToken(ctx, signin.SessionToken)
+
+	created, err := client.CreateAccessToken(sessionCtx, &authpb.CreateAccessTokenRequest{Name: "ci", Scopes: []string{"read"}})
+	assert.Nil(t, err)
+	accessCtx := WithSessionToken(ctx, created.AccessToken)
+
+	session, err := client.GetSession(accessCtx, &authpb.Empty{})
+	assert.Nil(t, err)
+	assert.Equal(t, "dario.freire@gmail.com", session.User.Email)
+	assert.NotEmpty(t, session.AccessTokenId)
+	assert.Equal(t, []string{"read"}, session.Scopes)
+
+	_, err = client.CreateAccessToken(accessCtx, &authpb.CreateAccessTokenRequest{Name: "other"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	accessTokens, err := client.GetAccessTokens(sessionCtx, &authpb.Empty{})
+	assert.Nil(t, err)
+	if assert.Len(t, accessTokens.AccessTokens, 1) {
+		assert.Equal(t, session.AccessTokenId, accessTokens.AccessTokens[0].Id)
+		assert.Equal(t, "ci", accessTokens.AccessTokens[0].Name)
+		assert.Nil(t, accessTokens.AccessTokens[0].ExpiresAt)
+	}
+
+	_, err = client.RevokeAccessTokens(sessionCtx, &authpb.RevokeAccessTokensRequest{AccessTokenIds: []string{session.AccessTokenId}})
+	assert.Nil(t, err)
+
+	_, err = client.GetSession(accessCtx, &authpb.Empty{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAuthServiceAccounts(t *testing.T) {
+	client, _ := createAuthClient(t, authCfg)
+	ctx := context.Background()
+	adminCtx := WithAdminKey(ctx, "admin-key")
+
+	_, err := client.CreateServiceAccount(ctx, &authpb.CreateServiceAccountRequest{Name: "billing", Scopes: []string{"read", "write"}})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	created, err := client.CreateServiceAccount(adminCtx, &authpb.CreateServiceAccountRequest{Name: "billing", Scopes: []string{"read", "write"}})
+	assert.Nil(t, err)
+	serviceAccountId := created.ServiceAccount.Id
+	assert.Equal(t, "billing", created.ServiceAccount.Name)
+	assert.Nil(t, created.ServiceAccount.DisabledAt)
+
+	// The client credentials are enough to get a token.
+	serviceToken, err := client.IssueServiceToken(ctx, &authpb.IssueServiceTokenRequest{ClientId: serviceAccountId, ClientSecret: created.ClientSecret, Scopes: []string{"read"}})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, serviceToken.ServiceToken)
+	assert.NotNil(t, serviceToken.ExpiresAt)
+	assert.Equal(t, []string{"read"}, serviceToken.Scopes)
+
+	serviceSession, err := client.GetServiceSession(WithSessionToken(ctx, serviceToken.ServiceToken), &authpb.Empty{})
+	assert.Nil(t, err)
+	assert.Equal(t, serviceAccountId, serviceSession.ServiceAccountId)
+	assert.Equal(t, []string{"read"}, serviceSession.Scopes)
+	assert.NotNil(t, serviceSession.ExpiresAt)
+
+	_, err = client.IssueServiceToken(ctx, &authpb.IssueServiceTokenRequest{ClientId: serviceAccountId, ClientSecret: created.ClientSecret, Scopes: []string{"admin"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	rotated, err := client.RotateServiceAccountSecret(adminCtx, &authpb.RotateServiceAccountSecretRequest{ServiceAccountId: serviceAccountId})
+	assert.Nil(t, err)
+	assert.NotEqual(t, created.ClientSecret, rotated.ClientSecret)
+
+	_, err = client.IssueServiceToken(ctx, &authpb.IssueServiceTokenRequest{ClientId: serviceAccountId, ClientSecret: created.ClientSecret})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.IssueServiceToken(ctx, &authpb.IssueServiceTokenRequest{ClientId: serviceAccountId, ClientSecret: rotated.ClientSecret})
+	assert.Nil(t, err)
+
+	_, err = client.DisableServiceAccount(adminCtx, &authpb.DisableServiceAccountRequest{ServiceAccountId: serviceAccountId})
+	assert.Nil(t, err)
+
+	serviceAccounts, err := client.GetServiceAccounts(adminCtx, &authpb.Empty{})
+	assert.Nil(t, err)
+	if assert.Len(t, serviceAccounts.ServiceAccounts, 1) {
+		assert.Equal(t, []string{"read", "write"}, serviceAccounts.ServiceAccounts[0].Scopes)
+		assert.NotNil(t, serviceAccounts.ServiceAccounts[0].DisabledAt)
+	}
+
+	_, err = client.IssueServiceToken(ctx, &authpb.IssueServiceTokenRequest{ClientId: serviceAccountId, ClientSecret: rotated.ClientSecret})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.GetServiceSession(WithSessionToken(ctx, serviceToken.ServiceToken), &authpb.Empty{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
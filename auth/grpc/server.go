@@ -0,0 +1,430 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dfreire/fservices/auth"
+	"github.com/dfreire/fservices/auth/grpc/authpb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type server struct {
+	authpb.UnimplementedAuthServer
+	auth auth.Auth
+}
+
+func NewServer(a auth.Auth) authpb.AuthServer {
+	return server{auth: a}
+}
+
+// Register registers the Auth service on s. The server should be created
+// with UnaryServerInterceptor so that the errors get proper status codes.
+func Register(s *grpc.Server, a auth.Auth) {
+	authpb.RegisterAuthServer(s, NewServer(a))
+}
+
+var empty = &authpb.Empty{}
+
+// Signup, ResendConfirmationMail and ForgotPassword leave out the tokens,
+// which are only sent by mail: returning them would let any caller confirm
+// an email or reset a password that is not theirs.
+func (self server) Signup(ctx context.Context, in *authpb.SignupRequest) (*authpb.Empty, error) {
+	_, err := self.auth.WithContext(ctx).Signup(in.Email, in.Password, in.Lang)
+	return empty, err
+}
+
+func (self server) ResendConfirmationMail(ctx context.Context, in *authpb.ResendConfirmationMailRequest) (*authpb.Empty, error) {
+	_, err := self.auth.WithContext(ctx).ResendConfirmationMail(in.Email, in.Lang)
+	return empty, err
+}
+
+func (self server) ConfirmSignup(ctx context.Context, in *authpb.ConfirmSignupRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).ConfirmSignup(in.ConfirmationToken)
+}
+
+func (self server) Signin(ctx context.Context, in *authpb.SigninRequest) (*authpb.SigninResponse, error) {
+	sessionTokenStr, err := self.auth.WithContext(ctx).Signin(in.Email, in.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.SigninResponse{SessionToken: sessionTokenStr}, nil
+}
+
+func (self server) ForgotPassword(ctx context.Context, in *authpb.ForgotPasswordRequest) (*authpb.Empty, error) {
+	_, err := self.auth.WithContext(ctx).ForgotPasword(in.Email, in.Lang)
+	return empty, err
+}
+
+func (self server) ResetPassword(ctx context.Context, in *authpb.ResetPasswordRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).ResetPassword(in.ResetToken, in.NewPassword)
+}
+
+func (self server) IssueServiceToken(ctx context.Context, in *authpb.IssueServiceTokenRequest) (*authpb.IssueServiceTokenResponse, error) {
+	serviceToken, err := self.auth.WithContext(ctx).IssueServiceToken(in.ClientId, in.ClientSecret, in.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.IssueServiceTokenResponse{
+		ServiceToken: serviceToken.Token,
+		ExpiresAt:    timestamp(serviceToken.ExpiresAt),
+		Scopes:       serviceToken.Scopes,
+	}, nil
+}
+
+func (self server) GetServiceSession(ctx context.Context, in *authpb.Empty) (*authpb.ServiceSession, error) {
+	serviceSession, err := self.auth.WithContext(ctx).GetServiceSession(sessionToken(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.ServiceSession{
+		ServiceAccountId: serviceSession.ServiceAccountId,
+		Name:             serviceSession.Name,
+		Scopes:           serviceSession.Scopes,
+		IssuedAt:         timestamp(serviceSession.IssuedAt),
+		ExpiresAt:        timestamp(serviceSession.ExpiresAt),
+	}, nil
+}
+
+func (self server) GetSession(ctx context.Context, in *authpb.Empty) (*authpb.Session, error) {
+	session, err := self.auth.WithContext(ctx).GetSession(sessionToken(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.Session{
+		Id:              session.Id,
+		CreatedAt:       timestamp(session.CreatedAt),
+		User:            toUser(session.User),
+		OrganizationId:  session.OrganizationId,
+		Role:            session.Role,
+		ImpersonationId: session.ImpersonationId,
+		AccessTokenId:   session.AccessTokenId,
+		Scopes:          session.Scopes,
+	}, nil
+}
+
+func (self server) ChangePassword(ctx context.Context, in *authpb.ChangePasswordRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).ChangePassword(sessionToken(ctx), in.OldPassword, in.NewPassword)
+}
+
+func (self server) ChangeEmail(ctx context.Context, in *authpb.ChangeEmailRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).ChangeEmail(sessionToken(ctx), in.Password, in.NewEmail)
+}
+
+func (self server) GetProfile(ctx context.Context, in *authpb.Empty) (*authpb.Profile, error) {
+	profile, err := self.auth.WithContext(ctx).GetProfile(sessionToken(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return toProfile(profile), nil
+}
+
+func (self server) UpdateProfile(ctx context.Context, in *authpb.UpdateProfileRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).UpdateProfile(sessionToken(ctx), json.RawMessage(in.UserData))
+}
+
+func (self server) CreateAccessToken(ctx context.Context, in *authpb.CreateAccessTokenRequest) (*authpb.CreateAccessTokenResponse, error) {
+	accessTokenStr, err := self.auth.WithContext(ctx).CreateAccessToken(sessionToken(ctx), in.Name, in.Scopes, toTime(in.ExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.CreateAccessTokenResponse{AccessToken: accessTokenStr}, nil
+}
+
+func (self server) GetAccessTokens(ctx context.Context, in *authpb.Empty) (*authpb.GetAccessTokensResponse, error) {
+	accessTokens, err := self.auth.WithContext(ctx).GetAccessTokens(sessionToken(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &authpb.GetAccessTokensResponse{}
+	for _, accessToken := range accessTokens {
+		res.AccessTokens = append(res.AccessTokens, &authpb.AccessToken{
+			Id:         accessToken.Id,
+			CreatedAt:  timestamp(accessToken.CreatedAt),
+			Name:       accessToken.Name,
+			Scopes:     accessToken.Scopes,
+			ExpiresAt:  timestamp(accessToken.ExpiresAt),
+			LastUsedAt: timestamp(accessToken.LastUsedAt),
+		})
+	}
+	return res, nil
+}
+
+func (self server) RevokeAccessTokens(ctx context.Context, in *authpb.RevokeAccessTokensRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).RevokeAccessTokens(sessionToken(ctx), in.AccessTokenIds...)
+}
+
+func (self server) CreateOrganization(ctx context.Context, in *authpb.CreateOrganizationRequest) (*authpb.CreateOrganizationResponse, error) {
+	organizationId, err := self.auth.WithContext(ctx).CreateOrganization(sessionToken(ctx), in.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.CreateOrganizationResponse{OrganizationId: organizationId}, nil
+}
+
+func (self server) GetOrganizations(ctx context.Context, in *authpb.Empty) (*authpb.GetOrganizationsResponse, error) {
+	memberships, err := self.auth.WithContext(ctx).GetOrganizations(sessionToken(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &authpb.GetOrganizationsResponse{}
+	for _, membership := range memberships {
+		res.Memberships = append(res.Memberships, &authpb.Membership{
+			Organization: &authpb.Organization{
+				Id:        membership.Organization.Id,
+				CreatedAt: timestamp(membership.Organization.CreatedAt),
+				Name:      membership.Organization.Name,
+			},
+			Role: membership.Role,
+		})
+	}
+	return res, nil
+}
+
+func (self server) SwitchOrganization(ctx context.Context, in *authpb.SwitchOrganizationRequest) (*authpb.SwitchOrganizationResponse, error) {
+	sessionTokenStr, err := self.auth.WithContext(ctx).SwitchOrganization(sessionToken(ctx), in.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.SwitchOrganizationResponse{SessionToken: sessionTokenStr}, nil
+}
+
+func (self server) GetOrganizationMembers(ctx context.Context, in *authpb.Empty) (*authpb.GetOrganizationMembersResponse, error) {
+	members, err := self.auth.WithContext(ctx).GetOrganizationMembers(sessionToken(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &authpb.GetOrganizationMembersResponse{}
+	for _, member := range members {
+		res.Members = append(res.Members, &authpb.Member{
+			UserId:    member.UserId,
+			Email:     member.Email,
+			Role:      member.Role,
+			CreatedAt: timestamp(member.CreatedAt),
+		})
+	}
+	return res, nil
+}
+
+func (self server) AddOrganizationMember(ctx context.Context, in *authpb.AddOrganizationMemberRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).AddOrganizationMember(sessionToken(ctx), in.Email, in.Role)
+}
+
+func (self server) SetOrganizationMemberRole(ctx context.Context, in *authpb.SetOrganizationMemberRoleRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).SetOrganizationMemberRole(sessionToken(ctx), in.UserId, in.Role)
+}
+
+func (self server) RemoveOrganizationMembers(ctx context.Context, in *authpb.RemoveOrganizationMembersRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).RemoveOrganizationMembers(sessionToken(ctx), in.UserIds...)
+}
+
+func (self server) CheckAdminKey(ctx context.Context, in *authpb.Empty) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).CheckAdminKey(adminKey(ctx))
+}
+
+func (self server) GetUsers(ctx context.Context, in *authpb.Empty) (*authpb.GetUsersResponse, error) {
+	users, err := self.auth.WithContext(ctx).GetUsers(adminKey(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.GetUsersResponse{Users: toUsers(users)}, nil
+}
+
+func (self server) CreateUser(ctx context.Context, in *authpb.CreateUserRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).CreateUser(adminKey(ctx), in.Email, in.Password, in.Lang)
+}
+
+func (self server) ChangeUserPassword(ctx context.Context, in *authpb.ChangeUserPasswordRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).ChangeUserPassword(adminKey(ctx), in.UserId, in.NewPassword)
+}
+
+func (self server) ChangeUserEmail(ctx context.Context, in *authpb.ChangeUserEmailRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).ChangeUserEmail(adminKey(ctx), in.UserId, in.NewEmail)
+}
+
+func (self server) RemoveUsers(ctx context.Context, in *authpb.RemoveUsersRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).RemoveUsers(adminKey(ctx), in.UserIds...)
+}
+
+func (self server) GetUserProfile(ctx context.Context, in *authpb.GetUserProfileRequest) (*authpb.Profile, error) {
+	profile, err := self.auth.WithContext(ctx).GetUserProfile(adminKey(ctx), in.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return toProfile(profile), nil
+}
+
+func (self server) UpdateUserProfile(ctx context.Context, in *authpb.UpdateUserProfileRequest) (*authpb.Empty, error) {
+	// Leave out the sections that are not in the request.
+	var userData, adminData interface{}
+	if len(in.UserData) > 0 {
+		userData = json.RawMessage(in.UserData)
+	}
+	if len(in.AdminData) > 0 {
+		adminData = json.RawMessage(in.AdminData)
+	}
+
+	return empty, self.auth.WithContext(ctx).UpdateUserProfile(adminKey(ctx), in.UserId, userData, adminData)
+}
+
+func (self server) ImpersonateUser(ctx context.Context, in *authpb.ImpersonateUserRequest) (*authpb.ImpersonateUserResponse, error) {
+	sessionTokenStr, err := self.auth.WithContext(ctx).ImpersonateUser(adminKey(ctx), in.UserId, in.Reason)
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.ImpersonateUserResponse{SessionToken: sessionTokenStr}, nil
+}
+
+func (self server) GetImpersonations(ctx context.Context, in *authpb.Empty) (*authpb.GetImpersonationsResponse, error) {
+	impersonations, err := self.auth.WithContext(ctx).GetImpersonations(adminKey(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &authpb.GetImpersonationsResponse{}
+	for _, impersonation := range impersonations {
+		res.Impersonations = append(res.Impersonations, &authpb.Impersonation{
+			Id:        impersonation.Id,
+			CreatedAt: timestamp(impersonation.CreatedAt),
+			UserId:    impersonation.UserId,
+			Reason:    impersonation.Reason,
+		})
+	}
+	return res, nil
+}
+
+func (self server) GetJobRuns(ctx context.Context, in *authpb.GetJobRunsRequest) (*authpb.GetJobRunsResponse, error) {
+	limit := int(in.Limit)
+	if limit <= 0 {
+		limit = 100
+	}
+
+	jobRuns, err := self.auth.WithContext(ctx).GetJobRuns(adminKey(ctx), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &authpb.GetJobRunsResponse{}
+	for _, jobRun := range jobRuns {
+		res.JobRuns = append(res.JobRuns, &authpb.JobRun{
+			Id:         jobRun.Id,
+			Job:        jobRun.Job,
+			Owner:      jobRun.Owner,
+			StartedAt:  timestamp(jobRun.StartedAt),
+			FinishedAt: timestamp(jobRun.FinishedAt),
+			Affected:   jobRun.Affected,
+			Error:      jobRun.Error,
+		})
+	}
+	return res, nil
+}
+
+func (self server) RemoveUnconfirmedUsers(ctx context.Context, in *authpb.RemoveUnconfirmedUsersRequest) (*authpb.RemoveUnconfirmedUsersResponse, error) {
+	removedUsers, err := self.auth.WithContext(ctx).RemoveUnconfirmedUsers(adminKey(ctx), in.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.RemoveUnconfirmedUsersResponse{RemovedUsers: toUsers(removedUsers)}, nil
+}
+
+func (self server) GetUnapprovedUsers(ctx context.Context, in *authpb.Empty) (*authpb.GetUnapprovedUsersResponse, error) {
+	users, err := self.auth.WithContext(ctx).GetUnapprovedUsers(adminKey(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.GetUnapprovedUsersResponse{Users: toUsers(users)}, nil
+}
+
+func (self server) ApproveUser(ctx context.Context, in *authpb.ApproveUserRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).ApproveUser(adminKey(ctx), in.UserId)
+}
+
+func (self server) RejectUser(ctx context.Context, in *authpb.RejectUserRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).RejectUser(adminKey(ctx), in.UserId)
+}
+
+func (self server) CreateServiceAccount(ctx context.Context, in *authpb.CreateServiceAccountRequest) (*authpb.CreateServiceAccountResponse, error) {
+	serviceAccount, clientSecret, err := self.auth.WithContext(ctx).CreateServiceAccount(adminKey(ctx), in.Name, in.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.CreateServiceAccountResponse{ServiceAccount: toServiceAccount(serviceAccount), ClientSecret: clientSecret}, nil
+}
+
+func (self server) GetServiceAccounts(ctx context.Context, in *authpb.Empty) (*authpb.GetServiceAccountsResponse, error) {
+	serviceAccounts, err := self.auth.WithContext(ctx).GetServiceAccounts(adminKey(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &authpb.GetServiceAccountsResponse{}
+	for _, serviceAccount := range serviceAccounts {
+		res.ServiceAccounts = append(res.ServiceAccounts, toServiceAccount(serviceAccount))
+	}
+	return res, nil
+}
+
+func (self server) RotateServiceAccountSecret(ctx context.Context, in *authpb.RotateServiceAccountSecretRequest) (*authpb.RotateServiceAccountSecretResponse, error) {
+	clientSecret, err := self.auth.WithContext(ctx).RotateServiceAccountSecret(adminKey(ctx), in.ServiceAccountId)
+	if err != nil {
+		return nil, err
+	}
+	return &authpb.RotateServiceAccountSecretResponse{ClientSecret: clientSecret}, nil
+}
+
+func (self server) DisableServiceAccount(ctx context.Context, in *authpb.DisableServiceAccountRequest) (*authpb.Empty, error) {
+	return empty, self.auth.WithContext(ctx).DisableServiceAccount(adminKey(ctx), in.ServiceAccountId)
+}
+
+// timestamp leaves the zero time unset, as in an unconfirmed user.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// toTime reads an unset timestamp as the zero time.
+func toTime(t *timestamppb.Timestamp) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.AsTime()
+}
+
+func toUser(user auth.User) *authpb.User {
+	return &authpb.User{
+		Id:          user.Id,
+		CreatedAt:   timestamp(user.CreatedAt),
+		Email:       user.Email,
+		Lang:        user.Lang,
+		ConfirmedAt: timestamp(user.ConfirmedAt),
+	}
+}
+
+func toUsers(users []auth.User) []*authpb.User {
+	result := make([]*authpb.User, len(users))
+	for i, user := range users {
+		result[i] = toUser(user)
+	}
+	return result
+}
+
+func toProfile(profile auth.Profile) *authpb.Profile {
+	return &authpb.Profile{UserData: profile.UserData, AdminData: profile.AdminData}
+}
+
+func toServiceAccount(serviceAccount auth.ServiceAccount) *authpb.ServiceAccount {
+	return &authpb.ServiceAccount{
+		Id:         serviceAccount.Id,
+		CreatedAt:  timestamp(serviceAccount.CreatedAt),
+		Name:       serviceAccount.Name,
+		Scopes:     serviceAccount.Scopes,
+		DisabledAt: timestamp(serviceAccount.DisabledAt),
+	}
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	stdhttp "net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	CSRFHeader    = "X-CSRF-Token"
+	CSRFFormField = "csrfToken"
+)
+
+var errCSRF = echo.NewHTTPError(stdhttp.StatusForbidden, "The CSRF token is not valid.")
+
+// CSRFToken returns the token that the unsafe requests authenticated by the
+// session cookie must send in the CSRFHeader or the CSRFFormField. Server
+// rendered forms can embed it; scripts can read it from the CSRF cookie.
+// It is empty when the request has no session cookie.
+func CSRFToken(c *echo.Context, cfg Config) string {
+	cfg = cfg.withDefaults()
+
+	cookie, err := c.Request().Cookie(cfg.CookieName)
+	if err != nil {
+		return ""
+	}
+	return csrfToken(cookie.Value)
+}
+
+// csrfToken is derived from the session token, which scripts cannot read
+// from its HttpOnly cookie, so another site cannot forge it or plant it in
+// a cookie of its own.
+func csrfToken(sessionTokenStr string) string {
+	sum := sha256.Sum256([]byte("csrf:" + sessionTokenStr))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// checkCSRF checks the CSRF token of the unsafe requests that are
+// authenticated by the session cookie. Requests with an "Authorization:
+// Bearer" header are not exposed to CSRF and are let through.
+func checkCSRF(c *echo.Context, cfg Config) error {
+	if !cfg.CookieMode {
+		return nil
+	}
+
+	switch c.Request().Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return nil
+	}
+
+	if strings.HasPrefix(c.Request().Header.Get(echo.Authorization), "Bearer ") {
+		return nil
+	}
+
+	expected := CSRFToken(c, cfg)
+	if expected == "" {
+		return nil
+	}
+
+	actual := c.Request().Header.Get(CSRFHeader)
+	if actual == "" {
+		actual = c.Request().FormValue(CSRFFormField)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(actual), []byte(expected)) != 1 {
+		return errCSRF
+	}
+	return nil
+}
+
+func (self handlers) csrf(h echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		if err := checkCSRF(c, self.cfg); err != nil {
+			return err
+		}
+		return h(c)
+	}
+}
+
+// setSessionCookies sets the session token in an HttpOnly cookie and its
+// CSRF token in a cookie that scripts can read.
+func setSessionCookies(c *echo.Context, cfg Config, sessionTokenStr string) {
+	stdhttp.SetCookie(c.Response(), cfg.cookie(cfg.CookieName, sessionTokenStr, true))
+	stdhttp.SetCookie(c.Response(), cfg.cookie(cfg.CSRFCookieName, csrfToken(sessionTokenStr), false))
+}
+
+func clearSessionCookies(c *echo.Context, cfg Config) {
+	for _, name := range []string{cfg.CookieName, cfg.CSRFCookieName} {
+		cookie := cfg.cookie(name, "", name == cfg.CookieName)
+		cookie.MaxAge = -1
+		stdhttp.SetCookie(c.Response(), cookie)
+	}
+}
+
+func (self Config) cookie(name, value string, httpOnly bool) *stdhttp.Cookie {
+	return &stdhttp.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     self.CookiePath,
+		Domain:   self.CookieDomain,
+		Secure:   !self.CookieInsecure,
+		HttpOnly: httpOnly,
+		SameSite: self.CookieSameSite,
+	}
+}
@@ -0,0 +1,518 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	stdhttp "net/http"
+	"time"
+
+	"github.com/dfreire/fservices/auth"
+	"github.com/labstack/echo"
+)
+
+type emailBody struct {
+	Email string `json:"email"`
+	Lang  string `json:"lang"`
+}
+
+type sessionTokenBody struct {
+	SessionToken string `json:"sessionToken"`
+}
+
+func (self handlers) signup(c *echo.Context) error {
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Lang     string `json:"lang"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	// The confirmation token is only sent by mail.
+	if _, err := self.auth(c).Signup(body.Email, body.Password, body.Lang); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusCreated)
+}
+
+func (self handlers) resendConfirmationMail(c *echo.Context) error {
+	var body emailBody
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if _, err := self.auth(c).ResendConfirmationMail(body.Email, body.Lang); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) confirmSignup(c *echo.Context) error {
+	var body struct {
+		ConfirmationToken string `json:"confirmationToken"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if err := self.auth(c).ConfirmSignup(body.ConfirmationToken); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) signin(c *echo.Context) error {
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	sessionTokenStr, err := self.auth(c).Signin(body.Email, body.Password)
+	if err != nil {
+		return err
+	}
+	return self.writeSessionToken(c, sessionTokenStr)
+}
+
+// signout removes the session server-side and then, in the cookie mode,
+// clears the cookies. A token that is no longer valid has nothing left to
+// remove, so the cookies are cleared anyway.
+func (self handlers) signout(c *echo.Context) error {
+	if sessionTokenStr := self.sessionToken(c); sessionTokenStr != "" {
+		err := self.auth(c).Signout(sessionTokenStr)
+		if err != nil && !errors.Is(err, auth.ErrInvalidToken) && !errors.Is(err, auth.ErrTokenExpired) {
+			return err
+		}
+	}
+
+	if self.cfg.CookieMode {
+		clearSessionCookies(c, self.cfg)
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+// writeSessionToken sends a new session token in the body, or in the
+// cookie mode sets it in the cookies and sends only the CSRF token.
+func (self handlers) writeSessionToken(c *echo.Context, sessionTokenStr string) error {
+	if !self.cfg.CookieMode {
+		return c.JSON(stdhttp.StatusOK, sessionTokenBody{sessionTokenStr})
+	}
+
+	setSessionCookies(c, self.cfg, sessionTokenStr)
+	return c.JSON(stdhttp.StatusOK, struct {
+		CSRFToken string `json:"csrfToken"`
+	}{csrfToken(sessionTokenStr)})
+}
+
+func (self handlers) forgotPassword(c *echo.Context) error {
+	var body emailBody
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	// The reset token is only sent by mail.
+	if _, err := self.auth(c).ForgotPasword(body.Email, body.Lang); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) resetPassword(c *echo.Context) error {
+	var body struct {
+		ResetToken  string `json:"resetToken"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if err := self.auth(c).ResetPassword(body.ResetToken, body.NewPassword); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) getSession(c *echo.Context) error {
+	session, err := self.auth(c).GetSession(self.sessionToken(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, session)
+}
+
+func (self handlers) changePassword(c *echo.Context) error {
+	var body struct {
+		OldPassword string `json:"oldPassword"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if err := self.auth(c).ChangePassword(self.sessionToken(c), body.OldPassword, body.NewPassword); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) changeEmail(c *echo.Context) error {
+	var body struct {
+		Password string `json:"password"`
+		NewEmail string `json:"newEmail"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if err := self.auth(c).ChangeEmail(self.sessionToken(c), body.Password, body.NewEmail); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) getProfile(c *echo.Context) error {
+	profile, err := self.auth(c).GetProfile(self.sessionToken(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, profile)
+}
+
+func (self handlers) updateProfile(c *echo.Context) error {
+	var body struct {
+		UserData json.RawMessage `json:"userData"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if err := self.auth(c).UpdateProfile(self.sessionToken(c), body.UserData); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) getAccessTokens(c *echo.Context) error {
+	accessTokens, err := self.auth(c).GetAccessTokens(self.sessionToken(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, accessTokens)
+}
+
+func (self handlers) createAccessToken(c *echo.Context) error {
+	var body struct {
+		Name      string    `json:"name"`
+		Scopes    []string  `json:"scopes"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	accessTokenStr, err := self.auth(c).CreateAccessToken(self.sessionToken(c), body.Name, body.Scopes, body.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusCreated, struct {
+		AccessToken string `json:"accessToken"`
+	}{accessTokenStr})
+}
+
+func (self handlers) revokeAccessToken(c *echo.Context) error {
+	if err := self.auth(c).RevokeAccessTokens(self.sessionToken(c), c.Param("accessTokenId")); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) getOrganizations(c *echo.Context) error {
+	memberships, err := self.auth(c).GetOrganizations(self.sessionToken(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, memberships)
+}
+
+func (self handlers) createOrganization(c *echo.Context) error {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	organizationId, err := self.auth(c).CreateOrganization(self.sessionToken(c), body.Name)
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusCreated, struct {
+		Id string `json:"id"`
+	}{organizationId})
+}
+
+func (self handlers) switchOrganization(c *echo.Context) error {
+	var body struct {
+		OrganizationId string `json:"organizationId"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	sessionTokenStr, err := self.auth(c).SwitchOrganization(self.sessionToken(c), body.OrganizationId)
+	if err != nil {
+		return err
+	}
+	return self.writeSessionToken(c, sessionTokenStr)
+}
+
+func (self handlers) getOrganizationMembers(c *echo.Context) error {
+	members, err := self.auth(c).GetOrganizationMembers(self.sessionToken(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, members)
+}
+
+func (self handlers) addOrganizationMember(c *echo.Context) error {
+	var body struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if err := self.auth(c).AddOrganizationMember(self.sessionToken(c), body.Email, body.Role); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusCreated)
+}
+
+func (self handlers) setOrganizationMemberRole(c *echo.Context) error {
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if err := self.auth(c).SetOrganizationMemberRole(self.sessionToken(c), c.Param("userId"), body.Role); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) removeOrganizationMember(c *echo.Context) error {
+	if err := self.auth(c).RemoveOrganizationMembers(self.sessionToken(c), c.Param("userId")); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) getUsers(c *echo.Context) error {
+	users, err := self.auth(c).GetUsers(adminKey(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, users)
+}
+
+func (self handlers) createUser(c *echo.Context) error {
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Lang     string `json:"lang"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if err := self.auth(c).CreateUser(adminKey(c), body.Email, body.Password, body.Lang); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusCreated)
+}
+
+func (self handlers) removeUser(c *echo.Context) error {
+	if err := self.auth(c).RemoveUsers(adminKey(c), c.Param("userId")); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) changeUserPassword(c *echo.Context) error {
+	var body struct {
+		NewPassword string `json:"newPassword"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if err := self.auth(c).ChangeUserPassword(adminKey(c), c.Param("userId"), body.NewPassword); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) changeUserEmail(c *echo.Context) error {
+	var body struct {
+		NewEmail string `json:"newEmail"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if err := self.auth(c).ChangeUserEmail(adminKey(c), c.Param("userId"), body.NewEmail); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) getUserProfile(c *echo.Context) error {
+	profile, err := self.auth(c).GetUserProfile(adminKey(c), c.Param("userId"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, profile)
+}
+
+func (self handlers) updateUserProfile(c *echo.Context) error {
+	var body struct {
+		UserData  json.RawMessage `json:"userData"`
+		AdminData json.RawMessage `json:"adminData"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	// Leave out the sections that are not in the body.
+	var userData, adminData interface{}
+	if body.UserData != nil {
+		userData = body.UserData
+	}
+	if body.AdminData != nil {
+		adminData = body.AdminData
+	}
+
+	if err := self.auth(c).UpdateUserProfile(adminKey(c), c.Param("userId"), userData, adminData); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) impersonateUser(c *echo.Context) error {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	sessionTokenStr, err := self.auth(c).ImpersonateUser(adminKey(c), c.Param("userId"), body.Reason)
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, sessionTokenBody{sessionTokenStr})
+}
+
+func (self handlers) removeUnconfirmedUsers(c *echo.Context) error {
+	dryRun := c.Query("dryRun") == "true"
+
+	removedUsers, err := self.auth(c).RemoveUnconfirmedUsers(adminKey(c), dryRun)
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, removedUsers)
+}
+
+func (self handlers) getImpersonations(c *echo.Context) error {
+	impersonations, err := self.auth(c).GetImpersonations(adminKey(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, impersonations)
+}
+
+func (self handlers) getJobRuns(c *echo.Context) error {
+	limit, err := queryInt(c, "limit", 100)
+	if err != nil {
+		return err
+	}
+
+	jobRuns, err := self.auth(c).GetJobRuns(adminKey(c), limit)
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, jobRuns)
+}
+
+func (self handlers) getUnapprovedUsers(c *echo.Context) error {
+	users, err := self.auth(c).GetUnapprovedUsers(adminKey(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, users)
+}
+
+func (self handlers) approveUser(c *echo.Context) error {
+	if err := self.auth(c).ApproveUser(adminKey(c), c.Param("userId")); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) rejectUser(c *echo.Context) error {
+	if err := self.auth(c).RejectUser(adminKey(c), c.Param("userId")); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
+
+func (self handlers) getServiceAccounts(c *echo.Context) error {
+	serviceAccounts, err := self.auth(c).GetServiceAccounts(adminKey(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, serviceAccounts)
+}
+
+func (self handlers) createServiceAccount(c *echo.Context) error {
+	var body struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	serviceAccount, clientSecret, err := self.auth(c).CreateServiceAccount(adminKey(c), body.Name, body.Scopes)
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusCreated, struct {
+		ServiceAccount auth.ServiceAccount `json:"serviceAccount"`
+		ClientSecret   string              `json:"clientSecret"`
+	}{serviceAccount, clientSecret})
+}
+
+func (self handlers) rotateServiceAccountSecret(c *echo.Context) error {
+	clientSecret, err := self.auth(c).RotateServiceAccountSecret(adminKey(c), c.Param("serviceAccountId"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stdhttp.StatusOK, struct {
+		ClientSecret string `json:"clientSecret"`
+	}{clientSecret})
+}
+
+func (self handlers) disableServiceAccount(c *echo.Context) error {
+	if err := self.auth(c).DisableServiceAccount(adminKey(c), c.Param("serviceAccountId")); err != nil {
+		return err
+	}
+	return c.NoContent(stdhttp.StatusNoContent)
+}
@@ -0,0 +1,209 @@
+// Package http exposes an auth.Auth as a JSON API on an echo router.
+package http
+
+import (
+	"log"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dfreire/fservices/auth"
+	"github.com/labstack/echo"
+)
+
+const AdminKeyHeader = "X-Admin-Key"
+
+// Router is implemented by both *echo.Echo and *echo.Group.
+type Router interface {
+	Get(path string, h echo.Handler)
+	Post(path string, h echo.Handler)
+	Put(path string, h echo.Handler)
+	Delete(path string, h echo.Handler)
+}
+
+type Config struct {
+	// CookieName is the cookie read for the session token when the request
+	// has no "Authorization: Bearer" header. The default is "session".
+	CookieName string
+	// CookieMode makes signin set the session token in an HttpOnly cookie
+	// instead of returning it, and requires a CSRF token (see CSRFToken) on
+	// the unsafe requests authenticated by that cookie.
+	CookieMode   bool
+	CookieDomain string
+	// CookiePath defaults to "/".
+	CookiePath string
+	// CookieInsecure drops the Secure attribute, for development over http.
+	CookieInsecure bool
+	// CookieSameSite defaults to http.SameSiteLaxMode.
+	CookieSameSite stdhttp.SameSite
+	// CSRFCookieName is the cookie, readable by scripts, with the CSRF
+	// token. The default is "csrf".
+	CSRFCookieName string
+}
+
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail has the code of the auth.Error, if the error is one.
+type ErrorDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+type handlers struct {
+	a   auth.Auth
+	cfg Config
+}
+
+// auth is the service bound to the context of the request.
+func (self handlers) auth(c *echo.Context) auth.Auth {
+	return self.a.WithContext(c.Request().Context())
+}
+
+func (self Config) withDefaults() Config {
+	if self.CookieName == "" {
+		self.CookieName = "session"
+	}
+	if self.CookiePath == "" {
+		self.CookiePath = "/"
+	}
+	if self.CookieSameSite == 0 {
+		self.CookieSameSite = stdhttp.SameSiteLaxMode
+	}
+	if self.CSRFCookieName == "" {
+		self.CSRFCookieName = "csrf"
+	}
+	return self
+}
+
+func Mount(router Router, a auth.Auth, cfg Config) {
+	self := handlers{a, cfg.withDefaults()}
+
+	router.Post("/signup", wrap(self.signup))
+	router.Post("/signup/resend", wrap(self.resendConfirmationMail))
+	router.Post("/signup/confirm", wrap(self.confirmSignup))
+	router.Post("/signin", wrap(self.signin))
+	router.Post("/signout", wrap(self.signout))
+	router.Post("/password/forgot", wrap(self.forgotPassword))
+	router.Post("/password/reset", wrap(self.resetPassword))
+	router.Post("/oauth/token", self.issueToken)
+
+	router.Get("/session", wrap(self.getSession))
+	router.Post("/password/change", wrap(self.csrf(self.changePassword)))
+	router.Post("/email/change", wrap(self.csrf(self.changeEmail)))
+	router.Get("/profile", wrap(self.getProfile))
+	router.Put("/profile", wrap(self.csrf(self.updateProfile)))
+
+	router.Get("/access-tokens", wrap(self.getAccessTokens))
+	router.Post("/access-tokens", wrap(self.csrf(self.createAccessToken)))
+	router.Delete("/access-tokens/:accessTokenId", wrap(self.csrf(self.revokeAccessToken)))
+
+	router.Get("/organizations", wrap(self.getOrganizations))
+	router.Post("/organizations", wrap(self.csrf(self.createOrganization)))
+	router.Post("/organizations/switch", wrap(self.csrf(self.switchOrganization)))
+	router.Get("/organization/members", wrap(self.getOrganizationMembers))
+	router.Post("/organization/members", wrap(self.csrf(self.addOrganizationMember)))
+	router.Put("/organization/members/:userId", wrap(self.csrf(self.setOrganizationMemberRole)))
+	router.Delete("/organization/members/:userId", wrap(self.csrf(self.removeOrganizationMember)))
+
+	router.Get("/admin/users", wrap(self.getUsers))
+	router.Post("/admin/users", wrap(self.createUser))
+	router.Delete("/admin/users/:userId", wrap(self.removeUser))
+	router.Put("/admin/users/:userId/password", wrap(self.changeUserPassword))
+	router.Put("/admin/users/:userId/email", wrap(self.changeUserEmail))
+	router.Get("/admin/users/:userId/profile", wrap(self.getUserProfile))
+	router.Put("/admin/users/:userId/profile", wrap(self.updateUserProfile))
+	router.Post("/admin/users/:userId/impersonate", wrap(self.impersonateUser))
+	router.Post("/admin/unconfirmed-users/remove", wrap(self.removeUnconfirmedUsers))
+	router.Get("/admin/impersonations", wrap(self.getImpersonations))
+	router.Get("/admin/job-runs", wrap(self.getJobRuns))
+	router.Get("/admin/unapproved-users", wrap(self.getUnapprovedUsers))
+	router.Post("/admin/users/:userId/approve", wrap(self.approveUser))
+	router.Post("/admin/users/:userId/reject", wrap(self.rejectUser))
+	router.Get("/admin/service-accounts", wrap(self.getServiceAccounts))
+	router.Post("/admin/service-accounts", wrap(self.createServiceAccount))
+	router.Post("/admin/service-accounts/:serviceAccountId/rotate", wrap(self.rotateServiceAccountSecret))
+	router.Post("/admin/service-accounts/:serviceAccountId/disable", wrap(self.disableServiceAccount))
+}
+
+// SessionToken reads the session token from the "Authorization: Bearer"
+// header, or else from the session cookie.
+func SessionToken(c *echo.Context, cookieName string) string {
+	authorization := c.Request().Header.Get(echo.Authorization)
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	}
+
+	cookie, err := c.Request().Cookie(cookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func (self handlers) sessionToken(c *echo.Context) string {
+	return SessionToken(c, self.cfg.CookieName)
+}
+
+func adminKey(c *echo.Context) string {
+	return c.Request().Header.Get(AdminKeyHeader)
+}
+
+func wrap(h echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		if err := h(c); err != nil {
+			return WriteError(c, err)
+		}
+		return nil
+	}
+}
+
+// WriteError writes err as an ErrorBody with the matching status code. The
+// message is in the lang of the Accept-Language header, when auth.Messages
+// has it.
+func WriteError(c *echo.Context, err error) error {
+	status, message := ErrorStatus(err)
+	if status == stdhttp.StatusInternalServerError {
+		log.Printf("auth/http: %s %s: %s", c.Request().Method, c.Request().URL.Path, err)
+	}
+
+	code := auth.ErrorCode(err)
+	if code != "" {
+		message = auth.Message(err, requestLang(c))
+	}
+	return c.JSON(status, ErrorBody{ErrorDetail{status, code, message}})
+}
+
+// requestLang returns the first lang of the Accept-Language header, as in
+// "pt_PT".
+func requestLang(c *echo.Context) string {
+	lang := c.Request().Header.Get("Accept-Language")
+	if i := strings.IndexAny(lang, ",;"); i >= 0 {
+		lang = lang[:i]
+	}
+	return strings.Replace(strings.TrimSpace(lang), "-", "_", 1)
+}
+
+// ErrorStatus is auth.ErrorStatus, which also takes the *echo.HTTPError of
+// the handlers.
+func ErrorStatus(err error) (status int, message string) {
+	if httpError, ok := err.(*echo.HTTPError); ok {
+		return httpError.Code(), httpError.Error()
+	}
+	return auth.ErrorStatus(err)
+}
+
+func queryInt(c *echo.Context, name string, defaultValue int) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, echo.NewHTTPError(stdhttp.StatusBadRequest, "The "+name+" parameter is not a number.")
+	}
+	return i, nil
+}
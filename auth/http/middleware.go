@@ -0,0 +1,185 @@
+package http
+
+import (
+	stdhttp "net/http"
+	"strings"
+
+	"github.com/dfreire/fservices/auth"
+	"github.com/labstack/echo"
+)
+
+const (
+	SessionContextKey        = "auth.session"
+	UserContextKey           = "auth.user"
+	ServiceSessionContextKey = "auth.serviceSession"
+)
+
+// RequireSession validates the session token of the request and puts the
+// session and its user in the context (see GetSession and GetUser).
+// Requests without a valid session get 401. In the cookie mode it also
+// checks the CSRF token of the unsafe requests.
+//
+// The middleware that must come after RequireSession goes in the same
+// Group call, as an echo group does not keep the middleware of its parent:
+// e.Group("/admin", RequireSession(a, cfg), RequireRoles("admin")).
+func RequireSession(a auth.Auth, cfg Config) echo.MiddlewareFunc {
+	cfg = cfg.withDefaults()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			sessionTokenStr := SessionToken(c, cfg.CookieName)
+			if sessionTokenStr == "" {
+				return WriteError(c, echo.NewHTTPError(stdhttp.StatusUnauthorized, "The session token is missing."))
+			}
+
+			session, err := a.WithContext(c.Request().Context()).GetSession(sessionTokenStr)
+			if err != nil {
+				if status, message := ErrorStatus(err); status != stdhttp.StatusInternalServerError {
+					if status != stdhttp.StatusUnauthorized {
+						message = "The session is not valid."
+					}
+					err = echo.NewHTTPError(stdhttp.StatusUnauthorized, message)
+				}
+				return WriteError(c, err)
+			}
+
+			if err := checkCSRF(c, cfg); err != nil {
+				return WriteError(c, err)
+			}
+
+			c.Set(SessionContextKey, session)
+			c.Set(UserContextKey, session.User)
+			return next(c)
+		}
+	}
+}
+
+// RequireConfirmed only lets through the users that have confirmed their
+// account. It must come after RequireSession.
+func RequireConfirmed() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			user, ok := GetUser(c)
+			if !ok {
+				return WriteError(c, echo.NewHTTPError(stdhttp.StatusUnauthorized, "Unauthorized"))
+			}
+			if user.ConfirmedAt.IsZero() {
+				return WriteError(c, echo.NewHTTPError(stdhttp.StatusForbidden, "The account has not been confirmed."))
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireRoles only lets through the users that have one of the roles in
+// the active organization of their session. It must come after
+// RequireSession.
+func RequireRoles(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			session, ok := GetSession(c)
+			if !ok {
+				return WriteError(c, echo.NewHTTPError(stdhttp.StatusUnauthorized, "Unauthorized"))
+			}
+			for _, role := range roles {
+				if session.Role == role {
+					return next(c)
+				}
+			}
+			return WriteError(c, echo.NewHTTPError(stdhttp.StatusForbidden, "Forbidden"))
+		}
+	}
+}
+
+// RequireScopes only lets through the access tokens that have all the
+// scopes, and the sessions, which are not limited by scopes. It must come
+// after RequireSession.
+func RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			session, ok := GetSession(c)
+			if !ok {
+				return WriteError(c, echo.NewHTTPError(stdhttp.StatusUnauthorized, "Unauthorized"))
+			}
+			if session.AccessTokenId == "" {
+				return next(c)
+			}
+			for _, scope := range scopes {
+				if !hasScope(session.Scopes, scope) {
+					return WriteError(c, echo.NewHTTPError(stdhttp.StatusForbidden, "The access token does not have the scope "+scope+"."))
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireAdminKey only lets through the requests with the admin key in the
+// AdminKeyHeader.
+func RequireAdminKey(a auth.Auth) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			if err := a.CheckAdminKey(adminKey(c)); err != nil {
+				return WriteError(c, err)
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireServiceToken only lets through the requests with a service token,
+// from the client credentials grant, that has all the scopes. It puts the
+// service session in the context (see GetServiceSession).
+func RequireServiceToken(a auth.Auth, scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			authorization := c.Request().Header.Get(echo.Authorization)
+			if !strings.HasPrefix(authorization, "Bearer ") {
+				return WriteError(c, echo.NewHTTPError(stdhttp.StatusUnauthorized, "The service token is missing."))
+			}
+
+			serviceTokenStr := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+			serviceSession, err := a.WithContext(c.Request().Context()).GetServiceSession(serviceTokenStr)
+			if err != nil {
+				return WriteError(c, err)
+			}
+
+			for _, scope := range scopes {
+				if !hasScope(serviceSession.Scopes, scope) {
+					return WriteError(c, echo.NewHTTPError(stdhttp.StatusForbidden, "The service token does not have the scope "+scope+"."))
+				}
+			}
+
+			c.Set(ServiceSessionContextKey, serviceSession)
+			return next(c)
+		}
+	}
+}
+
+// GetSession returns the session put in the context by RequireSession.
+func GetSession(c *echo.Context) (session auth.Session, ok bool) {
+	session, ok = c.Get(SessionContextKey).(auth.Session)
+	return
+}
+
+// GetUser returns the user put in the context by RequireSession.
+func GetUser(c *echo.Context) (user auth.User, ok bool) {
+	user, ok = c.Get(UserContextKey).(auth.User)
+	return
+}
+
+// GetServiceSession returns the service session put in the context by
+// RequireServiceToken.
+func GetServiceSession(c *echo.Context) (serviceSession auth.ServiceSession, ok bool) {
+	serviceSession, ok = c.Get(ServiceSessionContextKey).(auth.ServiceSession)
+	return
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"log"
+	stdhttp "net/http"
+	"strings"
+	"time"
+
+	"github.com/dfreire/fservices/auth"
+	"github.com/labstack/echo"
+)
+
+// OAuthErrorBody is the error of the token endpoint, as in RFC 6749.
+type OAuthErrorBody struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type oauthTokenBody struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// issueToken is the token endpoint of the OAuth2 client credentials grant.
+// The client authenticates with HTTP Basic or with the client_id and
+// client_secret form fields.
+func (self handlers) issueToken(c *echo.Context) error {
+	if grantType := c.Form("grant_type"); grantType != "client_credentials" {
+		return writeOAuthError(c, stdhttp.StatusBadRequest, "unsupported_grant_type", "The grant type is not supported.")
+	}
+
+	clientId, clientSecret, ok := c.Request().BasicAuth()
+	if !ok {
+		clientId, clientSecret = c.Form("client_id"), c.Form("client_secret")
+	}
+	if clientId == "" || clientSecret == "" {
+		return writeOAuthError(c, stdhttp.StatusBadRequest, "invalid_request", "The client credentials are missing.")
+	}
+
+	serviceToken, err := self.auth(c).IssueServiceToken(clientId, clientSecret, strings.Fields(c.Form("scope")))
+	if err != nil {
+		switch auth.ErrorCode(err) {
+		case auth.CodeInvalidClient:
+			c.Response().Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+			return writeOAuthError(c, stdhttp.StatusUnauthorized, auth.CodeInvalidClient, err.Error())
+		case auth.CodeInvalidScope:
+			return writeOAuthError(c, stdhttp.StatusBadRequest, auth.CodeInvalidScope, err.Error())
+		}
+		log.Printf("auth/http: %s %s: %s", c.Request().Method, c.Request().URL.Path, err)
+		return writeOAuthError(c, stdhttp.StatusInternalServerError, "server_error", "")
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(stdhttp.StatusOK, oauthTokenBody{
+		AccessToken: serviceToken.Token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(serviceToken.ExpiresAt).Round(time.Second) / time.Second),
+		Scope:       strings.Join(serviceToken.Scopes, " "),
+	})
+}
+
+func writeOAuthError(c *echo.Context, status int, code, description string) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(status, OAuthErrorBody{code, description})
+}
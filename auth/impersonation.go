@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// defaultMaxImpersonationAge is the lifetime of the impersonation sessions
+// when AuthConfig.MaxImpersonationAge is empty.
+const defaultMaxImpersonationAge = "1h"
+
+// Impersonation is the audit record kept for every session that an admin
+// opens on behalf of a user.
+type Impersonation struct {
+	Id        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UserId    string    `json:"userId"`
+	Reason    string    `json:"reason"`
+}
+
+func (self authImpl) ImpersonateUser(adminKey, userId, reason string) (sessionTokenStr string, err error) {
+	if !self.isAdminKey(adminKey) {
+		err = ErrUnauthorized
+		return
+	}
+
+	if reason == "" {
+		err = invalidArgument("The impersonation reason is empty.")
+		return
+	}
+
+	impersonationId := uuid.NewV4().String()
+	sessionId := uuid.NewV4().String()
+	createdAt := time.Now()
+
+	err = self.store.WithTx(func(tx Store) error {
+		if _, err := getTenantUser(tx, self.cfg.Tenant, userId); err != nil {
+			return err
+		}
+		if err := tx.CreateImpersonation(impersonationId, createdAt, self.cfg.Tenant, userId, reason); err != nil {
+			return err
+		}
+		return tx.CreateSession(sessionId, createdAt, userId)
+	})
+	if err != nil {
+		return
+	}
+
+	sessionToken := privateSessionToken{
+		sessionId:       sessionId,
+		userId:          userId,
+		impersonationId: impersonationId,
+		createdAt:       createdAt,
+	}
+	return sessionToken.toString(self.cfg.JwtKey)
+}
+
+func (self authImpl) GetImpersonations(adminKey string) ([]Impersonation, error) {
+	if !self.isAdminKey(adminKey) {
+		return []Impersonation{}, ErrUnauthorized
+	}
+
+	return self.store.GetImpersonations(self.cfg.Tenant)
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var placeholderRegexp = regexp.MustCompile(`\$[0-9]+`)
+
+// migration is a numbered step of the schema of a SQL store. Step 1 is the
+// baseline schema that was created before the schema had versions.
+type migration struct {
+	version int
+	// conflicts, if set, selects the rows that keep the step from going up,
+	// described in one text column.
+	conflicts string
+	up        string
+	down      string
+}
+
+// migrations describes the schema of a SQL dialect.
+type migrations struct {
+	// versionTable records the applied versions, one row each.
+	versionTable string
+	// createVersionTable must not fail when the table already exists.
+	createVersionTable string
+	// hasBaseline reports whether the baseline user table exists.
+	hasBaseline string
+	// questionMarks is set for dialects whose placeholders are ? instead
+	// of $1.
+	questionMarks bool
+	// splitStatements is set for drivers that run one statement per Exec.
+	splitStatements bool
+	// lock, if set, waits for the lock of the migrations of the database
+	// and selects 1 once it is taken; unlock releases it. Both run on the
+	// same connection.
+	lock   string
+	unlock string
+	steps  []migration
+}
+
+// Migrate brings the schema of the store to the latest version. It does
+// nothing when the schema is up to date, so it can run on every start.
+func Migrate(store Store) error {
+	return store.Migrate(-1)
+}
+
+// MigrateTo moves the schema of the store up or down to version. Version 0
+// removes the schema.
+func MigrateTo(store Store, version int) error {
+	return store.Migrate(version)
+}
+
+func SchemaVersion(store Store) (int, error) {
+	return store.SchemaVersion()
+}
+
+func (self migrations) latest() int {
+	return len(self.steps)
+}
+
+func (self migrations) version(db *sql.DB) (version int, err error) {
+	if _, err = db.Exec(self.createVersionTable); err != nil {
+		return
+	}
+
+	var applied int
+	err = db.QueryRow(`SELECT COUNT(*), COALESCE(MAX(version), 0) FROM `+self.versionTable).Scan(&applied, &version)
+	if err != nil || applied > 0 {
+		return
+	}
+
+	// A database that was created before the schema had versions is at
+	// the baseline.
+	var hasBaseline bool
+	if err = db.QueryRow(self.hasBaseline).Scan(&hasBaseline); err != nil || !hasBaseline {
+		return
+	}
+
+	_, err = db.Exec(self.bind(`INSERT INTO `+self.versionTable+` (version, appliedAt) VALUES ($1, $2)`), 1, time.Now())
+	return 1, err
+}
+
+func (self migrations) migrate(db *sql.DB, target int) (err error) {
+	if target < 0 {
+		target = self.latest()
+	}
+	if target > self.latest() {
+		return fmt.Errorf("The schema version %d does not exist.", target)
+	}
+
+	// The instances that start together migrate one at a time.
+	unlock, err := self.takeLock(db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	current, err := self.version(db)
+	if err != nil {
+		return err
+	}
+	if current > self.latest() {
+		return fmt.Errorf("The schema version %d is newer than this binary (%d).", current, self.latest())
+	}
+
+	for current < target {
+		step := self.steps[current]
+		if err := checkConflicts(db, step); err != nil {
+			return err
+		}
+		if err := self.apply(db, step.up, self.bind(`INSERT INTO `+self.versionTable+` (version, appliedAt) VALUES ($1, $2)`), step.version, time.Now()); err != nil {
+			return fmt.Errorf("Migration %d up: %s", step.version, err)
+		}
+		current++
+	}
+
+	for current > target {
+		step := self.steps[current-1]
+		if err := self.apply(db, step.down, self.bind(`DELETE FROM `+self.versionTable+` WHERE version = $1`), step.version); err != nil {
+			return fmt.Errorf("Migration %d down: %s", step.version, err)
+		}
+		current--
+	}
+
+	return nil
+}
+
+// takeLock takes the lock of the dialect, if any, on a connection of its
+// own, and returns the function that releases it.
+func (self migrations) takeLock(db *sql.DB) (unlock func() error, err error) {
+	if self.lock == "" {
+		return func() error { return nil }, nil
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked sql.NullInt64
+	if err = conn.QueryRowContext(ctx, self.lock).Scan(&locked); err == nil && locked.Int64 != 1 {
+		err = errors.New("The lock of the schema migrations was not taken.")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(ctx, self.unlock)
+		return err
+	}, nil
+}
+
+func checkConflicts(db *sql.DB, step migration) error {
+	if step.conflicts == "" {
+		return nil
+	}
+
+	rows, err := db.Query(step.conflicts)
+	if err != nil {
+		return fmt.Errorf("Migration %d up: %s", step.version, err)
+	}
+	defer rows.Close()
+
+	conflicts := []string{}
+	for rows.Next() {
+		var conflict string
+		if err := rows.Scan(&conflict); err != nil {
+			return err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return errConflicts(step.version, conflicts)
+}
+
+// errConflicts is the error of a step that cannot go up until the
+// conflicts are resolved by hand, or nil when there are none.
+func errConflicts(version int, conflicts []string) error {
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return fmt.Errorf("Migration %d up: Resolve these conflicts first: %s.", version, strings.Join(conflicts, "; "))
+}
+
+// apply runs a step and records it in the version table, in a transaction.
+// Dialects where DDL commits implicitly, as MySQL, may be left half way.
+func (self migrations) apply(db *sql.DB, schema, record string, args ...interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range self.statements(schema) {
+		if _, err = tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// bind rewrites the $1 placeholders of a version table query for the
+// dialect.
+func (self migrations) bind(query string) string {
+	if !self.questionMarks {
+		return query
+	}
+	return placeholderRegexp.ReplaceAllString(query, "?")
+}
+
+func (self migrations) statements(schema string) []string {
+	if strings.TrimSpace(schema) == "" {
+		return []string{}
+	}
+	if !self.splitStatements {
+		return []string{schema}
+	}
+
+	statements := []string{}
+	for _, statement := range strings.Split(schema, ";") {
+		if strings.TrimSpace(statement) != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+const (
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+type Organization struct {
+	Id        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Name      string    `json:"name"`
+}
+
+// Membership is an organization as seen by one of its members.
+type Membership struct {
+	Organization Organization `json:"organization"`
+	Role         string       `json:"role"`
+}
+
+type Member struct {
+	UserId    string    `json:"userId"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (self authImpl) CreateOrganization(sessionTokenStr, name string) (organizationId string, err error) {
+	sessionToken, err := self.parseSession(sessionTokenStr)
+	if err != nil {
+		return
+	}
+
+	if sessionToken.accessTokenId != "" {
+		err = ErrAccessTokenNotAllowed
+		return
+	}
+
+	if name == "" {
+		err = invalidArgument("The organization name is empty.")
+		return
+	}
+
+	organizationId = uuid.NewV4().String()
+	createdAt := time.Now()
+
+	err = self.store.WithTx(func(tx Store) error {
+		if err := tx.CreateOrganization(organizationId, createdAt, self.cfg.Tenant, name); err != nil {
+			return err
+		}
+		return tx.AddMember(organizationId, sessionToken.userId, OrganizationRoleAdmin, createdAt)
+	})
+	return
+}
+
+func (self authImpl) GetOrganizations(sessionTokenStr string) ([]Membership, error) {
+	sessionToken, err := self.parseSession(sessionTokenStr)
+	if err != nil {
+		return []Membership{}, err
+	}
+
+	return self.store.GetMemberships(sessionToken.userId)
+}
+
+func (self authImpl) SwitchOrganization(sessionTokenStr, organizationId string) (newSessionTokenStr string, err error) {
+	sessionToken, err := self.parseSession(sessionTokenStr)
+	if err != nil {
+		return
+	}
+
+	// An access token has no claims to replace.
+	if sessionToken.accessTokenId != "" {
+		err = ErrAccessTokenNotAllowed
+		return
+	}
+
+	if organizationId != "" {
+		if _, err = self.store.GetMemberRole(organizationId, sessionToken.userId); err != nil {
+			err = notFound(err, ErrNotFound)
+			return
+		}
+	}
+
+	sessionToken.organizationId = organizationId
+	return sessionToken.toString(self.cfg.JwtKey)
+}
+
+func (self authImpl) GetOrganizationMembers(sessionTokenStr string) ([]Member, error) {
+	sessionToken, _, err := self.parseOrganizationSession(sessionTokenStr)
+	if err != nil {
+		return []Member{}, err
+	}
+
+	return self.store.GetMembers(sessionToken.organizationId)
+}
+
+func (self authImpl) AddOrganizationMember(sessionTokenStr, email, role string) error {
+	sessionToken, err := self.parseOrganizationAdminSession(sessionTokenStr)
+	if err != nil {
+		return err
+	}
+
+	if err = checkRole(role); err != nil {
+		return err
+	}
+
+	email, err = self.normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	return self.store.WithTx(func(tx Store) error {
+		userId, err := tx.GetUserId(self.cfg.Tenant, email)
+		if err != nil {
+			return notFound(err, ErrUserNotFound)
+		}
+		return alreadyExists(tx.AddMember(sessionToken.organizationId, userId, role, time.Now()), ErrAlreadyExists)
+	})
+}
+
+func (self authImpl) SetOrganizationMemberRole(sessionTokenStr, userId, role string) error {
+	sessionToken, err := self.parseOrganizationAdminSession(sessionTokenStr)
+	if err != nil {
+		return err
+	}
+
+	if err = checkRole(role); err != nil {
+		return err
+	}
+
+	return self.store.WithTx(func(tx Store) error {
+		if role != OrganizationRoleAdmin {
+			if err := checkAdminLeft(tx, sessionToken.organizationId, userId); err != nil {
+				return err
+			}
+		}
+		return notFound(tx.SetMemberRole(sessionToken.organizationId, userId, role), ErrNotFound)
+	})
+}
+
+func (self authImpl) RemoveOrganizationMembers(sessionTokenStr string, userIds ...string) error {
+	sessionToken, err := self.parseOrganizationAdminSession(sessionTokenStr)
+	if err != nil {
+		return err
+	}
+
+	return self.store.WithTx(func(tx Store) error {
+		if err := checkAdminLeft(tx, sessionToken.organizationId, userIds...); err != nil {
+			return err
+		}
+		return tx.RemoveMembers(sessionToken.organizationId, userIds...)
+	})
+}
+
+func checkRole(role string) error {
+	switch role {
+	case OrganizationRoleAdmin, OrganizationRoleMember:
+		return nil
+	case "":
+		return invalidArgument("The role is empty.")
+	default:
+		return invalidArgument("The role is not valid.")
+	}
+}
+
+// checkAdminLeft locks the organization and fails when it would have no admin
+// without the given users.
+func checkAdminLeft(tx Store, organizationId string, userIds ...string) error {
+	if err := tx.LockOrganization(organizationId); err != nil {
+		return notFound(err, ErrNotFound)
+	}
+
+	members, err := tx.GetMembers(organizationId)
+	if err != nil {
+		return err
+	}
+
+	leaving := map[string]bool{}
+	for _, userId := range userIds {
+		leaving[userId] = true
+	}
+	for _, member := range members {
+		if member.Role == OrganizationRoleAdmin && !leaving[member.UserId] {
+			return nil
+		}
+	}
+	return invalidArgument("The organization must keep an admin.")
+}
+
+// parseOrganizationSession parses a session token that has an active
+// organization and returns the role of the user in that organization.
+func (self authImpl) parseOrganizationSession(sessionTokenStr string) (sessionToken privateSessionToken, role string, err error) {
+	sessionToken, err = self.parseSession(sessionTokenStr)
+	if err != nil {
+		return
+	}
+
+	role, err = self.getOrganizationRole(sessionToken)
+	return
+}
+
+// parseOrganizationAdminSession is parseOrganizationSession for the methods
+// that change the organization, which only its admins can call, and not with
+// access tokens.
+func (self authImpl) parseOrganizationAdminSession(sessionTokenStr string) (sessionToken privateSessionToken, err error) {
+	sessionToken, err = self.parseSession(sessionTokenStr)
+	if err != nil {
+		return
+	}
+
+	if sessionToken.accessTokenId != "" {
+		err = ErrAccessTokenNotAllowed
+		return
+	}
+
+	role, err := self.getOrganizationRole(sessionToken)
+	if err != nil {
+		return
+	}
+
+	if role != OrganizationRoleAdmin {
+		err = ErrUnauthorized
+	}
+	return
+}
+
+func (self authImpl) getOrganizationRole(sessionToken privateSessionToken) (role string, err error) {
+	if sessionToken.organizationId == "" {
+		err = ErrNoOrganization
+		return
+	}
+
+	role, err = self.store.GetMemberRole(sessionToken.organizationId, sessionToken.userId)
+	err = notFound(err, ErrNotFound)
+	return
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const defaultMaxProfileSize = 16 * 1024
+
+// Profile holds the application data attached to a user.
+// UserData can be changed by the user, AdminData only with the admin key.
+type Profile struct {
+	UserData  json.RawMessage `json:"userData"`
+	AdminData json.RawMessage `json:"adminData"`
+}
+
+func (self Profile) DecodeUserData(v interface{}) error {
+	return json.Unmarshal(self.UserData, v)
+}
+
+func (self Profile) DecodeAdminData(v interface{}) error {
+	return json.Unmarshal(self.AdminData, v)
+}
+
+// encodeProfileData accepts either raw JSON (json.RawMessage or []byte) or
+// any value that can be marshalled to JSON, and checks it against the size
+// limit and the optional JSON Schema.
+func encodeProfileData(data interface{}, maxSize int, schema string) (json.RawMessage, error) {
+	var encoded []byte
+	switch value := data.(type) {
+	case json.RawMessage:
+		encoded = value
+	case []byte:
+		encoded = value
+	default:
+		var err error
+		if encoded, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+
+	if maxSize <= 0 {
+		maxSize = defaultMaxProfileSize
+	}
+	if len(encoded) > maxSize {
+		return nil, invalidArgument(fmt.Sprintf("The profile data exceeds the maximum size of %d bytes.", maxSize))
+	}
+
+	if !json.Valid(encoded) {
+		return nil, invalidArgument("The profile data is not valid JSON.")
+	}
+
+	if schema == "" {
+		return encoded, nil
+	}
+
+	result, err := gojsonschema.Validate(
+		gojsonschema.NewStringLoader(schema),
+		gojsonschema.NewStringLoader(string(encoded)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid() {
+		descriptions := make([]string, len(result.Errors()))
+		for i, resultError := range result.Errors() {
+			descriptions[i] = resultError.String()
+		}
+		return nil, invalidArgument(fmt.Sprintf("The profile data is not valid: %s", strings.Join(descriptions, "; ")))
+	}
+
+	return encoded, nil
+}
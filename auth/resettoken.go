@@ -27,9 +27,11 @@ func parseResetToken(jwtKey, resetTokenStr string) (resetToken privateResetToken
 		return []byte(jwtKey), nil
 	})
 	if err != nil {
+		err = tokenError(err)
 		return
 	}
 	if !token.Valid {
+		err = ErrInvalidToken
 		return
 	}
 
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+const (
+	JobRemoveUnconfirmedUsers = "removeUnconfirmedUsers"
+	JobClearStaleResetKeys    = "clearStaleResetKeys"
+	JobExpireSessions         = "expireSessions"
+	JobPurgeDeletedUsers      = "purgeDeletedUsers"
+)
+
+// JobRun records the outcome of one run of a maintenance job.
+type JobRun struct {
+	Id         string    `json:"id"`
+	Job        string    `json:"job"`
+	Owner      string    `json:"owner"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Affected   int64     `json:"affected"`
+	Error      string    `json:"error"`
+}
+
+type job func(self authImpl, now time.Time) (affected int64, err error)
+
+var jobs = map[string]job{
+	JobRemoveUnconfirmedUsers: func(self authImpl, now time.Time) (int64, error) {
+		if err := self.warnUnconfirmedUsers(now); err != nil {
+			return 0, err
+		}
+		removedUsers, err := self.removeUnconfirmedUsers(now, false)
+		return int64(len(removedUsers)), err
+	},
+	JobClearStaleResetKeys: func(self authImpl, now time.Time) (int64, error) {
+		maxResetKeyAge, err := time.ParseDuration(self.cfg.MaxResetKeyAge)
+		if err != nil {
+			return 0, err
+		}
+		return self.store.ClearResetKeysCreatedBefore(self.cfg.Tenant, now.Add(-1*maxResetKeyAge))
+	},
+	JobExpireSessions: func(self authImpl, now time.Time) (int64, error) {
+		if self.cfg.MaxSessionAge == "" {
+			return 0, nil
+		}
+		maxSessionAge, err := time.ParseDuration(self.cfg.MaxSessionAge)
+		if err != nil {
+			return 0, err
+		}
+		return self.store.RemoveSessionsCreatedBefore(self.cfg.Tenant, now.Add(-1*maxSessionAge))
+	},
+	JobPurgeDeletedUsers: func(self authImpl, now time.Time) (int64, error) {
+		if self.cfg.DeletedUsersRetention == "" {
+			return 0, nil
+		}
+		deletedUsersRetention, err := time.ParseDuration(self.cfg.DeletedUsersRetention)
+		if err != nil {
+			return 0, err
+		}
+		return self.store.RemoveUsersDeletedBefore(self.cfg.Tenant, now.Add(-1*deletedUsersRetention))
+	},
+}
+
+// Scheduler runs the maintenance jobs configured in AuthConfig.Jobs, a map
+// from job name to run interval. Several instances can share a database:
+// each run takes a lock for the length of the interval, so a job runs at
+// most once per interval across all of them.
+type Scheduler struct {
+	auth      authImpl
+	owner     string
+	intervals map[string]time.Duration
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewScheduler(auth authImpl) (*Scheduler, error) {
+	intervals := make(map[string]time.Duration, len(auth.cfg.Jobs))
+	for name, intervalStr := range auth.cfg.Jobs {
+		if _, ok := jobs[name]; !ok {
+			return nil, fmt.Errorf("Unknown job %q.", name)
+		}
+
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil {
+			return nil, err
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("The interval of job %q must be positive.", name)
+		}
+		intervals[name] = interval
+	}
+
+	return &Scheduler{
+		auth:      auth,
+		owner:     uuid.NewV4().String(),
+		intervals: intervals,
+	}, nil
+}
+
+func (self *Scheduler) Start() {
+	self.stop = make(chan struct{})
+
+	for name, interval := range self.intervals {
+		self.wg.Add(1)
+		go self.loop(name, interval)
+	}
+}
+
+func (self *Scheduler) Stop() {
+	close(self.stop)
+	self.wg.Wait()
+}
+
+func (self *Scheduler) loop(name string, interval time.Duration) {
+	defer self.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, _, err := self.runJob(name, interval); err != nil {
+			log.Printf("auth: job %s failed: %s", name, err)
+		}
+
+		select {
+		case <-self.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runJob runs a job if no other instance has run it within the interval,
+// and records the outcome.
+func (self *Scheduler) runJob(name string, interval time.Duration) (jobRun JobRun, ran bool, err error) {
+	run, ok := jobs[name]
+	if !ok {
+		err = fmt.Errorf("Unknown job %q.", name)
+		return
+	}
+
+	now := time.Now()
+
+	ran, err = self.auth.store.AcquireJobLock(self.auth.cfg.Tenant, name, self.owner, now, now.Add(interval))
+	if err != nil || !ran {
+		return
+	}
+
+	jobRun = JobRun{
+		Id:        uuid.NewV4().String(),
+		Job:       name,
+		Owner:     self.owner,
+		StartedAt: now,
+	}
+
+	affected, runErr := run(self.auth, now)
+
+	jobRun.FinishedAt = time.Now()
+	jobRun.Affected = affected
+	if runErr != nil {
+		jobRun.Error = runErr.Error()
+	}
+
+	if err = self.auth.store.CreateJobRun(self.auth.cfg.Tenant, jobRun); err != nil {
+		return
+	}
+
+	err = runErr
+	return
+}
+
+func (self authImpl) GetJobRuns(adminKey string, limit int) ([]JobRun, error) {
+	if !self.isAdminKey(adminKey) {
+		return []JobRun{}, ErrUnauthorized
+	}
+
+	return self.store.GetJobRuns(self.cfg.Tenant, limit)
+}
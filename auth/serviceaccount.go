@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// ServiceSecretPrefix starts every client secret of a service account.
+const ServiceSecretPrefix = "fss_"
+
+// defaultServiceTokenAge is the lifetime of the service tokens when
+// AuthConfig.ServiceTokenAge is empty.
+const defaultServiceTokenAge = time.Hour
+
+// ServiceAccount is a client of the OAuth2 client credentials grant, for
+// the machine-to-machine callers that would otherwise use the admin key.
+// Its Id is the client id, and the store only keeps the hash of its secret.
+// Scopes are those that its tokens may have. DisabledAt is the zero time
+// until the account is disabled.
+type ServiceAccount struct {
+	Id         string    `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Name       string    `json:"name"`
+	Scopes     []string  `json:"scopes"`
+	DisabledAt time.Time `json:"disabledAt"`
+}
+
+// ServiceToken is a short-lived token issued to a service account, sent as
+// a bearer token and checked with GetServiceSession.
+type ServiceToken struct {
+	Token     string
+	ExpiresAt time.Time
+	Scopes    []string
+}
+
+// CreateServiceAccount returns the new service account and its client
+// secret, which is only returned here and by RotateServiceAccountSecret.
+func (self authImpl) CreateServiceAccount(adminKey, name string, scopes []string) (serviceAccount ServiceAccount, clientSecret string, err error) {
+	if !self.isAdminKey(adminKey) {
+		err = ErrUnauthorized
+		return
+	}
+
+	if strings.TrimSpace(name) == "" {
+		err = invalidArgument("The service account name is empty.")
+		return
+	}
+	if err = checkScopes(scopes); err != nil {
+		return
+	}
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	clientSecret, err = newServiceSecret()
+	if err != nil {
+		return
+	}
+
+	serviceAccount = ServiceAccount{
+		Id:        uuid.NewV4().String(),
+		CreatedAt: time.Now(),
+		Name:      name,
+		Scopes:    scopes,
+	}
+	err = self.store.CreateServiceAccount(self.cfg.Tenant, hashSecret(clientSecret), serviceAccount)
+	if err != nil {
+		return ServiceAccount{}, "", err
+	}
+	return
+}
+
+func (self authImpl) GetServiceAccounts(adminKey string) ([]ServiceAccount, error) {
+	if !self.isAdminKey(adminKey) {
+		return []ServiceAccount{}, ErrUnauthorized
+	}
+
+	return self.store.GetServiceAccounts(self.cfg.Tenant)
+}
+
+// RotateServiceAccountSecret replaces the client secret of the service
+// account. The tokens issued with the old secret last until they expire.
+func (self authImpl) RotateServiceAccountSecret(adminKey, serviceAccountId string) (clientSecret string, err error) {
+	if !self.isAdminKey(adminKey) {
+		err = ErrUnauthorized
+		return
+	}
+
+	if _, _, err = self.store.GetServiceAccount(self.cfg.Tenant, serviceAccountId); err != nil {
+		err = notFound(err, ErrNotFound)
+		return
+	}
+
+	clientSecret, err = newServiceSecret()
+	if err != nil {
+		return
+	}
+
+	if err = self.store.SetServiceAccountHashedSecret(serviceAccountId, hashSecret(clientSecret)); err != nil {
+		clientSecret = ""
+	}
+	return
+}
+
+// DisableServiceAccount keeps the service account from getting tokens, and
+// its tokens from being valid. Disabling it again does nothing.
+func (self authImpl) DisableServiceAccount(adminKey, serviceAccountId string) error {
+	if !self.isAdminKey(adminKey) {
+		return ErrUnauthorized
+	}
+
+	serviceAccount, _, err := self.store.GetServiceAccount(self.cfg.Tenant, serviceAccountId)
+	if err != nil {
+		return notFound(err, ErrNotFound)
+	}
+	if !serviceAccount.DisabledAt.IsZero() {
+		return nil
+	}
+
+	return self.store.SetServiceAccountDisabledAt(serviceAccountId, time.Now())
+}
+
+// IssueServiceToken is the OAuth2 client credentials grant: it returns a
+// token with the scopes, or with all the scopes of the service account when
+// scopes is empty.
+func (self authImpl) IssueServiceToken(clientId, clientSecret string, scopes []string) (serviceToken ServiceToken, err error) {
+	serviceAccount, hashedSecret, err := self.store.GetServiceAccount(self.cfg.Tenant, clientId)
+	if err == sql.ErrNoRows {
+		err = ErrInvalidClient
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	hashedClientSecret := hashSecret(clientSecret)
+	if subtle.ConstantTimeCompare([]byte(hashedSecret), []byte(hashedClientSecret)) != 1 || !serviceAccount.DisabledAt.IsZero() {
+		err = ErrInvalidClient
+		return
+	}
+
+	if len(scopes) == 0 {
+		scopes = serviceAccount.Scopes
+	}
+	for _, scope := range scopes {
+		if !containsScope(serviceAccount.Scopes, scope) {
+			err = &Error{CodeInvalidScope, fmt.Sprintf("The scope %q is not allowed for the client.", scope)}
+			return
+		}
+	}
+
+	serviceTokenAge := defaultServiceTokenAge
+	if self.cfg.ServiceTokenAge != "" {
+		if serviceTokenAge, err = time.ParseDuration(self.cfg.ServiceTokenAge); err != nil {
+			return
+		}
+	}
+
+	issuedAt := time.Now()
+	token := privateServiceToken{serviceAccount.Id, scopes, issuedAt, issuedAt.Add(serviceTokenAge)}
+	tokenStr, err := token.toString(self.cfg.JwtKey)
+	if err != nil {
+		return
+	}
+
+	return ServiceToken{tokenStr, token.expiresAt, scopes}, nil
+}
+
+// GetServiceSession parses a service token and checks that its service
+// account still exists and is not disabled.
+func (self authImpl) GetServiceSession(serviceTokenStr string) (ServiceSession, error) {
+	serviceToken, err := parseServiceToken(self.cfg.JwtKey, serviceTokenStr)
+	if err != nil {
+		return ServiceSession{}, err
+	}
+
+	serviceAccount, _, err := self.store.GetServiceAccount(self.cfg.Tenant, serviceToken.serviceAccountId)
+	if err == sql.ErrNoRows {
+		return ServiceSession{}, &Error{CodeInvalidToken, "The service account does not exist."}
+	}
+	if err != nil {
+		return ServiceSession{}, err
+	}
+	if !serviceAccount.DisabledAt.IsZero() {
+		return ServiceSession{}, &Error{CodeInvalidToken, "The service account is disabled."}
+	}
+
+	return ServiceSession{
+		ServiceAccountId: serviceAccount.Id,
+		Name:             serviceAccount.Name,
+		Scopes:           serviceToken.scopes,
+		IssuedAt:         serviceToken.issuedAt,
+		ExpiresAt:        serviceToken.expiresAt,
+	}, nil
+}
+
+func newServiceSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return ServiceSecretPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ServiceSession describes a valid service token.
+type ServiceSession struct {
+	ServiceAccountId string    `json:"serviceAccountId"`
+	Name             string    `json:"name"`
+	Scopes           []string  `json:"scopes"`
+	IssuedAt         time.Time `json:"issuedAt"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+}
+
+type privateServiceToken struct {
+	serviceAccountId string
+	scopes           []string
+	issuedAt         time.Time
+	expiresAt        time.Time
+}
+
+func (self privateServiceToken) toString(jwtKey string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Claims["serviceAccountId"] = self.serviceAccountId
+	token.Claims["scope"] = joinScopes(self.scopes)
+	token.Claims["iat"] = self.issuedAt.Unix()
+	token.Claims["exp"] = self.expiresAt.Unix()
+	return token.SignedString([]byte(jwtKey))
+}
+
+func parseServiceToken(jwtKey, serviceTokenStr string) (serviceToken privateServiceToken, err error) {
+	token, err := jwt.Parse(serviceTokenStr, func(token *jwt.Token) (interface{}, error) {
+		return []byte(jwtKey), nil
+	})
+	if err != nil {
+		err = tokenError(err)
+		return
+	}
+	if !token.Valid {
+		err = ErrInvalidToken
+		return
+	}
+
+	// The session tokens, signed with the same key, lack these claims.
+	serviceToken.serviceAccountId, _ = token.Claims["serviceAccountId"].(string)
+	issuedAt, _ := token.Claims["iat"].(float64)
+	expiresAt, ok := token.Claims["exp"].(float64)
+	if serviceToken.serviceAccountId == "" || !ok {
+		err = ErrInvalidToken
+		return
+	}
+
+	scope, _ := token.Claims["scope"].(string)
+	serviceToken.scopes = splitScopes(scope)
+	serviceToken.issuedAt = time.Unix(int64(issuedAt), 0)
+	serviceToken.expiresAt = time.Unix(int64(expiresAt), 0)
+	return
+}
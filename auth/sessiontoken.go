@@ -6,16 +6,40 @@ import (
 	"github.com/dgrijalva/jwt-go"
 )
 
+// Session describes a valid session token. Role is the role of the user in
+// the active organization, if any. For an access token, Id is empty and
+// AccessTokenId and Scopes are those of the token.
+type Session struct {
+	Id              string    `json:"id"`
+	CreatedAt       time.Time `json:"createdAt"`
+	User            User      `json:"user"`
+	OrganizationId  string    `json:"organizationId"`
+	Role            string    `json:"role"`
+	ImpersonationId string    `json:"impersonationId"`
+	AccessTokenId   string    `json:"accessTokenId"`
+	Scopes          []string  `json:"scopes"`
+}
+
+// privateSessionToken is the content of a session token, or of an access
+// token, which only sets userId, createdAt, accessTokenId and scopes.
 type privateSessionToken struct {
-	sessionId string
-	userId    string
-	createdAt time.Time
+	sessionId       string
+	userId          string
+	organizationId  string
+	impersonationId string
+	createdAt       time.Time
+	accessTokenId   string
+	scopes          []string
 }
 
 func (self privateSessionToken) toString(jwtKey string) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 	token.Claims["sessionId"] = self.sessionId
 	token.Claims["userId"] = self.userId
+	token.Claims["organizationId"] = self.organizationId
+	if self.impersonationId != "" {
+		token.Claims["impersonationId"] = self.impersonationId
+	}
 	token.Claims["createdAt"] = self.createdAt.Unix()
 	return token.SignedString([]byte(jwtKey))
 }
@@ -25,14 +49,26 @@ func parseSessionToken(jwtKey, sessionTokenStr string) (sessionToken privateSess
 		return []byte(jwtKey), nil
 	})
 	if err != nil {
+		err = tokenError(err)
 		return
 	}
 	if !token.Valid {
+		err = ErrInvalidToken
+		return
+	}
+
+	// The other tokens signed with the same key, as the service tokens, lack
+	// these claims.
+	sessionToken.sessionId, _ = token.Claims["sessionId"].(string)
+	sessionToken.userId, _ = token.Claims["userId"].(string)
+	createdAt, _ := token.Claims["createdAt"].(float64)
+	if sessionToken.sessionId == "" || sessionToken.userId == "" {
+		err = ErrInvalidToken
 		return
 	}
 
-	sessionToken.sessionId = token.Claims["sessionId"].(string)
-	sessionToken.userId = token.Claims["userId"].(string)
-	sessionToken.createdAt = time.Unix(int64(token.Claims["createdAt"].(float64)), 0)
+	sessionToken.organizationId, _ = token.Claims["organizationId"].(string)
+	sessionToken.impersonationId, _ = token.Claims["impersonationId"].(string)
+	sessionToken.createdAt = time.Unix(int64(createdAt), 0)
 	return
 }
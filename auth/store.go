@@ -1,38 +1,298 @@
 package auth
 
-import "time"
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The errors of the stores that are not SQL databases read as the ones of
+// Postgres, so that they map to the same responses.
+var (
+	errDuplicateUser   = errors.New(`duplicate key value violates unique constraint "pk_auth_user"`)
+	errDuplicateEmail  = errors.New(`duplicate key value violates unique constraint "idx_auth_user_email"`)
+	errDuplicateMember = errors.New(`duplicate key value violates unique constraint "pk_auth_member"`)
+	errForeignKey      = errors.New("insert violates foreign key constraint")
+
+	errDuplicateAccessToken    = errors.New(`duplicate key value violates unique constraint "idx_auth_access_token_hashedToken"`)
+	errDuplicateServiceAccount = errors.New(`duplicate key value violates unique constraint "pk_auth_service_account"`)
+)
 
 type User struct {
-	Id          string
-	CreatedAt   time.Time
-	Email       string
-	Lang        string
-	ConfirmedAt time.Time
-}
-
-type privateUser struct {
-	id              string
-	createdAt       time.Time
-	email           string
-	hashedPass      string
-	lang            string
-	confirmationKey string
-	confirmedAt     time.Time
-	resetKey        string
-}
-
-type store interface {
-	createSchema() error
-
-	createUser(userId string, createdAt time.Time, email, hashedPass, lang, confirmationKey string) error
-	removeUsers(userIds ...string) error
-	setUserConfirmedAt(userId string, confirmedAt time.Time) error
-	setUserResetKey(userId, resetKey string) error
-	setUserHashedPass(userId, hashedPass string) error
-	setUserEmail(userId, email string) error
-	getUserId(email string) (userId string, err error)
-	getPrivateUser(userId string) (user privateUser, err error)
-	getAllUsers() (users []User, err error)
-
-	removeUnconfirmedUsersCreatedBefore(date time.Time) error
+	Id          string    `json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Email       string    `json:"email"`
+	Lang        string    `json:"lang"`
+	ConfirmedAt time.Time `json:"confirmedAt"`
+}
+
+// StoredUser is a user as kept by a Store. ConfirmedAt is the zero time
+// until the user confirms the account, ApprovedAt until an admin approves
+// it, and ResetKey is empty when there is no pending password reset.
+type StoredUser struct {
+	Id              string
+	CreatedAt       time.Time
+	Tenant          string
+	Email           string
+	HashedPass      string
+	Lang            string
+	ConfirmationKey string
+	ConfirmedAt     time.Time
+	ResetKey        string
+	ApprovedAt      time.Time
+}
+
+func (self StoredUser) toUser() User {
+	return User{
+		Id:          self.Id,
+		CreatedAt:   self.CreatedAt,
+		Email:       self.Email,
+		Lang:        self.Lang,
+		ConfirmedAt: self.ConfirmedAt,
+	}
+}
+
+// Store keeps the data of the auth service; NewStorePg, NewStoreMysql,
+// NewStoreSqlite, NewStoreBolt and NewStoreMemory are the built-in
+// implementations. The storetest package checks that an implementation
+// behaves as the service expects:
+//
+// Getting a single record that does not exist returns sql.ErrNoRows.
+// Creating a user with an email that is taken in the tenant fails, and so
+// does changing a user's email to one that is taken. Emails are compared
+// without case.
+// Removing records that do not exist is not an error. Removing users also
+// removes their memberships, sessions and access tokens. Deleting users does
+// too, but keeps the users, which are then neither found nor listed, and
+// whose emails stay taken, until RemoveUsersDeletedBefore removes them.
+//
+// Stores without a schema can implement Migrate as a no-op and report
+// version 0.
+type Store interface {
+	// Migrate moves the schema up or down to version; a negative version
+	// means the latest one. It does not run within WithTx.
+	Migrate(version int) error
+	SchemaVersion() (version int, err error)
+
+	// WithContext returns the store with its operations bound to ctx, so
+	// that they stop when ctx is done.
+	WithContext(ctx context.Context) Store
+	// WithTx runs fn with a store whose changes are committed when fn
+	// returns nil, and rolled back when it returns an error. Calling WithTx
+	// on that store runs within the same transaction.
+	WithTx(fn func(tx Store) error) error
+	// LockUser keeps other transactions from changing the user until this
+	// one ends, or returns sql.ErrNoRows.
+	LockUser(userId string) error
+	// LockOrganization keeps other transactions from changing the members
+	// of the organization until this one ends, or returns sql.ErrNoRows.
+	LockOrganization(organizationId string) error
+
+	CreateUser(userId string, createdAt time.Time, tenant, email, hashedPass, lang, confirmationKey string) error
+	RemoveUsers(userIds ...string) error
+	DeleteUsers(deletedAt time.Time, userIds ...string) error
+	SetUserConfirmedAt(userId string, confirmedAt time.Time) error
+	SetUserApprovedAt(userId string, approvedAt time.Time) error
+	SetUserResetKey(userId, resetKey string, resetKeyCreatedAt time.Time) error
+	SetUserHashedPass(userId, hashedPass string) error
+	SetUserEmail(userId, email string) error
+	GetUserId(tenant, email string) (userId string, err error)
+	GetUser(userId string) (user StoredUser, err error)
+	GetAllUsers(tenant string) (users []User, err error)
+	// GetUnapprovedUsers returns the confirmed users that are not approved.
+	GetUnapprovedUsers(tenant string) (users []User, err error)
+	GetProfile(userId string) (profile Profile, err error)
+	SetUserProfile(userId string, userData json.RawMessage) error
+	SetAdminProfile(userId string, adminData json.RawMessage) error
+
+	CreateOrganization(organizationId string, createdAt time.Time, tenant, name string) error
+	AddMember(organizationId, userId, role string, createdAt time.Time) error
+	// SetMemberRole returns sql.ErrNoRows when the user is not a member.
+	SetMemberRole(organizationId, userId, role string) error
+	RemoveMembers(organizationId string, userIds ...string) error
+	GetMemberRole(organizationId, userId string) (role string, err error)
+	GetMembers(organizationId string) (members []Member, err error)
+	GetMemberships(userId string) (memberships []Membership, err error)
+
+	CreateImpersonation(impersonationId string, createdAt time.Time, tenant, userId, reason string) error
+	GetImpersonations(tenant string) (impersonations []Impersonation, err error)
+
+	CreateSession(sessionId string, createdAt time.Time, userId string) error
+	GetSessionUserId(sessionId string) (userId string, err error)
+	RemoveSessions(sessionIds ...string) error
+
+	// CreateAccessToken fails when hashedToken is taken.
+	CreateAccessToken(userId, hashedToken string, accessToken AccessToken) error
+	GetAccessTokens(userId string) (accessTokens []AccessToken, err error)
+	GetAccessTokenByHash(hashedToken string) (accessToken AccessToken, userId string, err error)
+	SetAccessTokenLastUsedAt(accessTokenId string, lastUsedAt time.Time) error
+	RemoveAccessTokens(userId string, accessTokenIds ...string) error
+
+	CreateServiceAccount(tenant, hashedSecret string, serviceAccount ServiceAccount) error
+	GetServiceAccounts(tenant string) (serviceAccounts []ServiceAccount, err error)
+	GetServiceAccount(tenant, serviceAccountId string) (serviceAccount ServiceAccount, hashedSecret string, err error)
+	SetServiceAccountHashedSecret(serviceAccountId, hashedSecret string) error
+	SetServiceAccountDisabledAt(serviceAccountId string, disabledAt time.Time) error
+
+	AcquireJobLock(tenant, job, owner string, now, lockedUntil time.Time) (acquired bool, err error)
+	CreateJobRun(tenant string, jobRun JobRun) error
+	GetJobRuns(tenant string, limit int) (jobRuns []JobRun, err error)
+
+	GetUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []User, err error)
+	GetUnwarnedUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []StoredUser, err error)
+	SetUserRemovalWarnedAt(userId string, removalWarnedAt time.Time) error
+	RemoveUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (removedUsers []User, err error)
+	ClearResetKeysCreatedBefore(tenant string, date time.Time) (cleared int64, err error)
+	RemoveSessionsCreatedBefore(tenant string, date time.Time) (removed int64, err error)
+	RemoveUsersDeletedBefore(tenant string, date time.Time) (removed int64, err error)
+}
+
+// NewStore returns the store for a database opened with the "postgres", the
+// "mysql" or the "sqlite3" driver.
+func NewStore(driver string, db *sql.DB) (Store, error) {
+	switch driver {
+	case "postgres":
+		return NewStorePg(db), nil
+	case "mysql":
+		return NewStoreMysql(db), nil
+	case "sqlite3":
+		return NewStoreSqlite(db), nil
+	}
+	return nil, fmt.Errorf("The database driver %q is not supported.", driver)
+}
+
+// sqlConn is a *sql.DB or, within WithTx, a *sql.Tx.
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func withSqlTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func scanUsers(rows *sql.Rows) (users []User, err error) {
+	defer rows.Close()
+
+	var scanConfirmedAt pq.NullTime
+
+	for rows.Next() {
+		user := User{}
+		err = rows.Scan(&user.Id, &user.CreatedAt, &user.Email, &user.Lang, &scanConfirmedAt)
+		if err != nil {
+			return
+		}
+		if scanConfirmedAt.Valid {
+			user.ConfirmedAt = scanConfirmedAt.Time
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+// nullTime keeps the zero time as NULL.
+func nullTime(t time.Time) pq.NullTime {
+	return pq.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAccessToken scans the columns id, createdAt, name, scopes, expiresAt
+// and lastUsedAt of an access token, and then the columns of dest.
+func scanAccessToken(row rowScanner, dest ...interface{}) (accessToken AccessToken, err error) {
+	var scopes string
+	var scanExpiresAt, scanLastUsedAt pq.NullTime
+
+	columns := []interface{}{
+		&accessToken.Id,
+		&accessToken.CreatedAt,
+		&accessToken.Name,
+		&scopes,
+		&scanExpiresAt,
+		&scanLastUsedAt,
+	}
+	if err = row.Scan(append(columns, dest...)...); err != nil {
+		return
+	}
+
+	accessToken.Scopes = splitScopes(scopes)
+	if scanExpiresAt.Valid {
+		accessToken.ExpiresAt = scanExpiresAt.Time
+	}
+	if scanLastUsedAt.Valid {
+		accessToken.LastUsedAt = scanLastUsedAt.Time
+	}
+	return
+}
+
+func scanAccessTokens(rows *sql.Rows) (accessTokens []AccessToken, err error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		var accessToken AccessToken
+		if accessToken, err = scanAccessToken(rows); err != nil {
+			return
+		}
+		accessTokens = append(accessTokens, accessToken)
+	}
+	err = rows.Err()
+	return
+}
+
+// scanServiceAccount scans the columns id, createdAt, name, scopes and
+// disabledAt of a service account, and then the columns of dest.
+func scanServiceAccount(row rowScanner, dest ...interface{}) (serviceAccount ServiceAccount, err error) {
+	var scopes string
+	var scanDisabledAt pq.NullTime
+
+	columns := []interface{}{
+		&serviceAccount.Id,
+		&serviceAccount.CreatedAt,
+		&serviceAccount.Name,
+		&scopes,
+		&scanDisabledAt,
+	}
+	if err = row.Scan(append(columns, dest...)...); err != nil {
+		return
+	}
+
+	serviceAccount.Scopes = splitScopes(scopes)
+	if scanDisabledAt.Valid {
+		serviceAccount.DisabledAt = scanDisabledAt.Time
+	}
+	return
+}
+
+func scanServiceAccounts(rows *sql.Rows) (serviceAccounts []ServiceAccount, err error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		var serviceAccount ServiceAccount
+		if serviceAccount, err = scanServiceAccount(rows); err != nil {
+			return
+		}
+		serviceAccounts = append(serviceAccounts, serviceAccount)
+	}
+	err = rows.Err()
+	return
 }
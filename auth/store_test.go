@@ -0,0 +1,136 @@
+package auth_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dfreire/fservices/auth"
+	"github.com/dfreire/fservices/auth/storetest"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) auth.Store {
+		return auth.OpenTestStore()
+	})
+}
+
+func TestStoreSqlite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) auth.Store {
+		return auth.OpenTestStoreSqlite()
+	})
+}
+
+func TestStoreMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) auth.Store {
+		return auth.NewStoreMemory()
+	})
+}
+
+func TestStoreMemorySnapshot(t *testing.T) {
+	store := auth.NewStoreMemory()
+	now := time.Now()
+
+	assert.Nil(t, store.CreateUser("u1", now, "", "u1@example.com", "hash", "en_US", "key"))
+	snapshot := store.Snapshot()
+
+	assert.Nil(t, store.SetUserEmail("u1", "changed@example.com"))
+	assert.Nil(t, store.CreateUser("u2", now, "", "u2@example.com", "hash", "en_US", "key"))
+
+	store.Restore(snapshot)
+
+	user, err := store.GetUser("u1")
+	assert.Nil(t, err)
+	assert.Equal(t, "u1@example.com", user.Email)
+
+	_, err = store.GetUser("u2")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// The snapshot is not changed by the restored store.
+	assert.Nil(t, store.RemoveUsers("u1"))
+	store.Restore(snapshot)
+	_, err = store.GetUserId("", "u1@example.com")
+	assert.Nil(t, err)
+}
+
+func openTestStoreBolt(t *testing.T) auth.Store {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "auth.db"), 0600, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store := auth.NewStoreBolt(db)
+	assert.Nil(t, auth.Migrate(store))
+	return store
+}
+
+func TestStoreBolt(t *testing.T) {
+	storetest.Run(t, openTestStoreBolt)
+}
+
+func TestStoreBoltMigrate(t *testing.T) {
+	store := openTestStoreBolt(t)
+	assert.Nil(t, store.CreateUser("u1", time.Now(), "", "Joe@example.com", "hash", "en_US", "key"))
+
+	assert.Nil(t, auth.MigrateTo(store, 1))
+	version, err := auth.SchemaVersion(store)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, version)
+
+	assert.Nil(t, auth.Migrate(store))
+	version, err = auth.SchemaVersion(store)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, version)
+
+	userId, err := store.GetUserId("", "joe@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "u1", userId)
+}
+
+func TestStoreBoltBackup(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "auth.db"), 0600, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	store := auth.NewStoreBolt(db)
+	assert.Nil(t, auth.Migrate(store))
+	assert.Nil(t, store.CreateUser("u1", time.Now(), "", "u1@example.com", "hash", "en_US", "key"))
+
+	backupPath := filepath.Join(t.TempDir(), "backup.db")
+	backup, err := os.Create(backupPath)
+	assert.Nil(t, err)
+	written, err := store.Backup(backup)
+	assert.Nil(t, err)
+	assert.True(t, written > 0)
+	assert.Nil(t, backup.Close())
+
+	backupDb, err := bolt.Open(backupPath, 0600, nil)
+	assert.Nil(t, err)
+	defer backupDb.Close()
+
+	userId, err := auth.NewStoreBolt(backupDb).GetUserId("", "u1@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "u1", userId)
+}
+
+func TestStoreWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for name, store := range map[string]auth.Store{
+		"sqlite": auth.OpenTestStoreSqlite(),
+		"bolt":   openTestStoreBolt(t),
+	} {
+		assert.Nil(t, store.CreateUser("u1", time.Now(), "", "u1@example.com", "hash", "en_US", "key"), name)
+
+		_, err := store.WithContext(ctx).GetUser("u1")
+		assert.Equal(t, context.Canceled, err, name)
+
+		_, err = store.GetUser("u1")
+		assert.Nil(t, err, name)
+	}
+}
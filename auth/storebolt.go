@@ -0,0 +1,1283 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// storeBolt keeps the users in an embedded bbolt file. Every method runs in
+// one bolt transaction, so the records and their indexes change together.
+type storeBolt struct {
+	db  *bolt.DB
+	tx  *bolt.Tx
+	ctx context.Context
+}
+
+func NewStoreBolt(db *bolt.DB) storeBolt {
+	return storeBolt{db, nil, context.Background()}
+}
+
+// boltVersion is the latest schema version. At version 1 the buckets
+// exist, from version 2 on the emails are indexed without case, from
+// version 3 on the users have ApprovedAt, version 4 adds the buckets of the
+// access tokens, version 5 those of the service accounts and version 6 that
+// of the deleted users.
+const boltVersion = 6
+
+// The keys of the indexes are joined with \x00, and their times sort as
+// big-endian integers.
+var (
+	// id -> user
+	boltUsers = []byte("users")
+	// tenant, email -> id
+	boltUserEmails = []byte("userEmails")
+	// tenant, createdAt, id
+	boltUsersByCreatedAt = []byte("usersByCreatedAt")
+	// tenant, createdAt, id of the users that are not confirmed
+	boltUnconfirmedUsers = []byte("unconfirmedUsers")
+	// tenant, deletedAt, id of the deleted users, which are in neither of
+	// the indexes above
+	boltDeletedUsers = []byte("deletedUsers")
+	// id -> organization
+	boltOrganizations = []byte("organizations")
+	// organizationId, userId -> member
+	boltMembers = []byte("members")
+	// userId, organizationId
+	boltMemberships = []byte("memberships")
+	// tenant, createdAt, id -> impersonation
+	boltImpersonations = []byte("impersonations")
+	// id -> session
+	boltSessions = []byte("sessions")
+	// userId, sessionId
+	boltUserSessions = []byte("userSessions")
+	// id -> access token
+	boltAccessTokens = []byte("accessTokens")
+	// hashedToken -> id
+	boltAccessTokenHashes = []byte("accessTokenHashes")
+	// userId, accessTokenId
+	boltUserAccessTokens = []byte("userAccessTokens")
+	// id -> service account
+	boltServiceAccounts = []byte("serviceAccounts")
+	// tenant, createdAt, id
+	boltTenantServiceAccounts = []byte("tenantServiceAccounts")
+	// tenant, job -> job lock
+	boltJobLocks = []byte("jobLocks")
+	// tenant, startedAt, id -> job run
+	boltJobRuns = []byte("jobRuns")
+	// "version" -> schema version, from version 2 on
+	boltMeta       = []byte("meta")
+	boltVersionKey = []byte("version")
+
+	boltBuckets = [][]byte{
+		boltUsers, boltUserEmails, boltUsersByCreatedAt, boltUnconfirmedUsers,
+		boltOrganizations, boltMembers, boltMemberships, boltImpersonations,
+		boltSessions, boltUserSessions, boltJobLocks, boltJobRuns, boltMeta,
+		boltAccessTokens, boltAccessTokenHashes, boltUserAccessTokens,
+		boltServiceAccounts, boltTenantServiceAccounts, boltDeletedUsers,
+	}
+)
+
+var errBoltNoSchema = errors.New("The bolt store has no buckets, migrate it first.")
+
+type boltUser struct {
+	StoredUser
+	Tenant            string
+	ResetKeyCreatedAt time.Time
+	RemovalWarnedAt   time.Time
+	DeletedAt         time.Time
+	UserProfile       json.RawMessage
+	AdminProfile      json.RawMessage
+}
+
+type boltOrganization struct {
+	Organization
+	Tenant string
+}
+
+type boltSession struct {
+	CreatedAt time.Time
+	UserId    string
+}
+
+type boltAccessToken struct {
+	AccessToken
+	UserId      string
+	HashedToken string
+}
+
+type boltServiceAccount struct {
+	ServiceAccount
+	Tenant       string
+	HashedSecret string
+}
+
+type boltJobLock struct {
+	Owner       string
+	LockedUntil time.Time
+}
+
+type boltDelete struct {
+	bucket, key []byte
+}
+
+func boltKey(parts ...string) []byte {
+	return []byte(strings.Join(parts, "\x00"))
+}
+
+func boltEmailKey(tenant, email string) []byte {
+	return boltKey(tenant, foldEmail(email))
+}
+
+// boltTimeKey is prefix, \x00, the time and the id.
+func boltTimeKey(prefix string, t time.Time, id string) []byte {
+	var encoded [8]byte
+	// Flipping the sign bit makes the times before 1970 sort first.
+	binary.BigEndian.PutUint64(encoded[:], uint64(t.UnixNano())^(1<<63))
+
+	key := append([]byte(prefix), 0)
+	key = append(key, encoded[:]...)
+	return append(key, id...)
+}
+
+func boltTimeKeyId(prefix string, key []byte) string {
+	return string(key[len(prefix)+1+8:])
+}
+
+// scanPrefix calls fn with the keys of the bucket that start with prefix
+// and \x00, in order, until fn returns false.
+func scanPrefix(bucket *bolt.Bucket, prefix string, fn func(k, v []byte) bool) {
+	start := append([]byte(prefix), 0)
+	c := bucket.Cursor()
+	for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, start); k, v = c.Next() {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// scanBefore calls fn with the time keys of the bucket under prefix whose
+// time is before date, in time order.
+func scanBefore(bucket *bolt.Bucket, prefix string, date time.Time, fn func(k, v []byte)) {
+	end := boltTimeKey(prefix, date, "")
+	scanPrefix(bucket, prefix, func(k, v []byte) bool {
+		if bytes.Compare(k, end) >= 0 {
+			return false
+		}
+		fn(k, v)
+		return true
+	})
+}
+
+func boltGet(bucket *bolt.Bucket, key []byte, v interface{}) error {
+	data := bucket.Get(key)
+	if data == nil {
+		return sql.ErrNoRows
+	}
+	return json.Unmarshal(data, v)
+}
+
+func boltPut(bucket *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+func (self storeBolt) view(fn func(tx *bolt.Tx) error) error {
+	if err := self.ctx.Err(); err != nil {
+		return err
+	}
+	if self.tx != nil {
+		return fn(self.tx)
+	}
+	return self.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltUsers) == nil {
+			return errBoltNoSchema
+		}
+		return fn(tx)
+	})
+}
+
+func (self storeBolt) update(fn func(tx *bolt.Tx) error) error {
+	if err := self.ctx.Err(); err != nil {
+		return err
+	}
+	if self.tx != nil {
+		return fn(self.tx)
+	}
+	return self.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltUsers) == nil {
+			return errBoltNoSchema
+		}
+		return fn(tx)
+	})
+}
+
+// WithTx runs fn in a bolt read-write transaction. Bolt runs one of them
+// at a time, so LockUser only checks that the user exists.
+func (self storeBolt) WithTx(fn func(tx Store) error) error {
+	return self.update(func(tx *bolt.Tx) error {
+		return fn(storeBolt{self.db, tx, self.ctx})
+	})
+}
+
+// WithContext returns the store with ctx, which is checked before each
+// operation: bolt transactions cannot be interrupted.
+func (self storeBolt) WithContext(ctx context.Context) Store {
+	self.ctx = ctx
+	return self
+}
+
+func (self storeBolt) LockUser(userId string) error {
+	return self.view(func(tx *bolt.Tx) error {
+		_, err := boltGetUser(tx, userId)
+		return err
+	})
+}
+
+func (self storeBolt) LockOrganization(organizationId string) error {
+	return self.view(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltOrganizations).Get([]byte(organizationId)) == nil {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+func (self storeBolt) Migrate(version int) error {
+	if version < 0 {
+		version = boltVersion
+	}
+	if version > boltVersion {
+		return fmt.Errorf("The schema version %d does not exist.", version)
+	}
+
+	return self.db.Update(func(tx *bolt.Tx) error {
+		current, err := boltSchemaVersion(tx)
+		if err != nil || current == version {
+			return err
+		}
+
+		for _, name := range boltBuckets {
+			if version == 0 {
+				if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+					return err
+				}
+			} else if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if version == 0 {
+			return nil
+		}
+
+		if err := boltIndexEmails(tx, version); err != nil {
+			return err
+		}
+		if current < 3 && version >= 3 {
+			if err := boltApproveConfirmedUsers(tx); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(boltMeta).Put(boltVersionKey, []byte(strconv.Itoa(version)))
+	})
+}
+
+func (self storeBolt) SchemaVersion() (version int, err error) {
+	err = self.db.View(func(tx *bolt.Tx) error {
+		version, err = boltSchemaVersion(tx)
+		return err
+	})
+	return
+}
+
+// boltSchemaVersion is 1 for the files that have the buckets but not the
+// version, which were created before version 2.
+func boltSchemaVersion(tx *bolt.Tx) (int, error) {
+	if tx.Bucket(boltUsers) == nil {
+		return 0, nil
+	}
+	meta := tx.Bucket(boltMeta)
+	if meta == nil || meta.Get(boltVersionKey) == nil {
+		return 1, nil
+	}
+	return strconv.Atoi(string(meta.Get(boltVersionKey)))
+}
+
+// boltApproveConfirmedUsers approves the users that were confirmed before
+// there was approval, as the SQL stores do.
+func boltApproveConfirmedUsers(tx *bolt.Tx) error {
+	users := tx.Bucket(boltUsers)
+
+	updated := map[string]boltUser{}
+	err := users.ForEach(func(k, v []byte) error {
+		user := boltUser{}
+		if err := json.Unmarshal(v, &user); err != nil {
+			return err
+		}
+		if !user.ConfirmedAt.IsZero() && user.ApprovedAt.IsZero() {
+			user.ApprovedAt = user.ConfirmedAt
+			updated[string(k)] = user
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for userId, user := range updated {
+		if err := boltPut(users, []byte(userId), user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boltIndexEmails rebuilds the index of the emails as version has it, and
+// fails if two users would have the same key.
+func boltIndexEmails(tx *bolt.Tx, version int) error {
+	if err := tx.DeleteBucket(boltUserEmails); err != nil {
+		return err
+	}
+	emails, err := tx.CreateBucket(boltUserEmails)
+	if err != nil {
+		return err
+	}
+
+	indexed := map[string]string{}
+	conflicts := []string{}
+	err = tx.Bucket(boltUsers).ForEach(func(k, v []byte) error {
+		user := boltUser{}
+		if err := json.Unmarshal(v, &user); err != nil {
+			return err
+		}
+
+		emailKey := boltKey(user.Tenant, user.Email)
+		if version >= 2 {
+			emailKey = boltEmailKey(user.Tenant, user.Email)
+		}
+
+		if email, ok := indexed[string(emailKey)]; ok {
+			conflicts = append(conflicts, email+" = "+user.Email)
+			return nil
+		}
+		indexed[string(emailKey)] = user.Email
+		return emails.Put(emailKey, k)
+	})
+	if err != nil {
+		return err
+	}
+
+	return errConflicts(version, conflicts)
+}
+
+// Backup writes a consistent copy of the bolt file to w, while the store
+// is in use.
+func (self storeBolt) Backup(w io.Writer) (written int64, err error) {
+	err = self.db.View(func(tx *bolt.Tx) error {
+		written, err = tx.WriteTo(w)
+		return err
+	})
+	return
+}
+
+func (self storeBolt) CreateUser(userId string, createdAt time.Time, tenant, email, hashedPass, lang, confirmationKey string) error {
+	return self.update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltUsers).Get([]byte(userId)) != nil {
+			return errDuplicateUser
+		}
+		emailKey := boltEmailKey(tenant, email)
+		if tx.Bucket(boltUserEmails).Get(emailKey) != nil {
+			return errDuplicateEmail
+		}
+
+		user := boltUser{
+			StoredUser: StoredUser{
+				Id:              userId,
+				CreatedAt:       createdAt,
+				Email:           email,
+				HashedPass:      hashedPass,
+				Lang:            lang,
+				ConfirmationKey: confirmationKey,
+			},
+			Tenant:       tenant,
+			UserProfile:  json.RawMessage(`{}`),
+			AdminProfile: json.RawMessage(`{}`),
+		}
+		if err := boltPut(tx.Bucket(boltUsers), []byte(userId), user); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltUserEmails).Put(emailKey, []byte(userId)); err != nil {
+			return err
+		}
+
+		createdAtKey := boltTimeKey(tenant, createdAt, userId)
+		if err := tx.Bucket(boltUsersByCreatedAt).Put(createdAtKey, []byte{}); err != nil {
+			return err
+		}
+		return tx.Bucket(boltUnconfirmedUsers).Put(createdAtKey, []byte{})
+	})
+}
+
+func (self storeBolt) RemoveUsers(userIds ...string) error {
+	return self.update(func(tx *bolt.Tx) error {
+		for _, userId := range userIds {
+			if err := boltRemoveUser(tx, userId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (self storeBolt) DeleteUsers(deletedAt time.Time, userIds ...string) error {
+	return self.update(func(tx *bolt.Tx) error {
+		for _, userId := range userIds {
+			user, err := boltGetUser(tx, userId)
+			if err == sql.ErrNoRows {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			user.DeletedAt = deletedAt
+			if err := boltPut(tx.Bucket(boltUsers), []byte(userId), user); err != nil {
+				return err
+			}
+
+			createdAtKey := boltTimeKey(user.Tenant, user.CreatedAt, userId)
+			if err := tx.Bucket(boltUsersByCreatedAt).Delete(createdAtKey); err != nil {
+				return err
+			}
+			if err := tx.Bucket(boltUnconfirmedUsers).Delete(createdAtKey); err != nil {
+				return err
+			}
+			if err := tx.Bucket(boltDeletedUsers).Put(boltTimeKey(user.Tenant, deletedAt, userId), []byte{}); err != nil {
+				return err
+			}
+
+			if err := boltRemoveUserRecords(tx, userId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// boltRemoveUser also removes the memberships, sessions and access tokens of
+// the user, as the ON DELETE CASCADE of the SQL stores.
+func boltRemoveUser(tx *bolt.Tx, userId string) error {
+	user := boltUser{}
+	if err := boltGet(tx.Bucket(boltUsers), []byte(userId), &user); err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	createdAtKey := boltTimeKey(user.Tenant, user.CreatedAt, userId)
+	deletes := []boltDelete{
+		{boltUsers, []byte(userId)},
+		{boltUserEmails, boltEmailKey(user.Tenant, user.Email)},
+		{boltUsersByCreatedAt, createdAtKey},
+		{boltUnconfirmedUsers, createdAtKey},
+	}
+	if !user.DeletedAt.IsZero() {
+		deletes = append(deletes, boltDelete{boltDeletedUsers, boltTimeKey(user.Tenant, user.DeletedAt, userId)})
+	}
+
+	for _, d := range deletes {
+		if err := tx.Bucket(d.bucket).Delete(d.key); err != nil {
+			return err
+		}
+	}
+	return boltRemoveUserRecords(tx, userId)
+}
+
+// boltRemoveUserRecords removes the memberships, sessions and access tokens
+// of the user.
+func boltRemoveUserRecords(tx *bolt.Tx, userId string) error {
+	deletes := []boltDelete{}
+
+	// The keys are collected first, a cursor may skip keys when its bucket
+	// changes.
+	scanPrefix(tx.Bucket(boltMemberships), userId, func(k, v []byte) bool {
+		organizationId := string(k[len(userId)+1:])
+		deletes = append(deletes,
+			boltDelete{boltMemberships, boltKey(userId, organizationId)},
+			boltDelete{boltMembers, boltKey(organizationId, userId)},
+		)
+		return true
+	})
+	scanPrefix(tx.Bucket(boltUserSessions), userId, func(k, v []byte) bool {
+		sessionId := string(k[len(userId)+1:])
+		deletes = append(deletes,
+			boltDelete{boltUserSessions, boltKey(userId, sessionId)},
+			boltDelete{boltSessions, []byte(sessionId)},
+		)
+		return true
+	})
+
+	var accessTokenIds []string
+	scanPrefix(tx.Bucket(boltUserAccessTokens), userId, func(k, v []byte) bool {
+		accessTokenIds = append(accessTokenIds, string(k[len(userId)+1:]))
+		return true
+	})
+	if err := boltRemoveAccessTokens(tx, userId, accessTokenIds...); err != nil {
+		return err
+	}
+
+	for _, d := range deletes {
+		if err := tx.Bucket(d.bucket).Delete(d.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateUser applies update to the user, if it exists.
+func (self storeBolt) updateUser(userId string, update func(tx *bolt.Tx, user *boltUser) error) error {
+	return self.update(func(tx *bolt.Tx) error {
+		user := boltUser{}
+		if err := boltGet(tx.Bucket(boltUsers), []byte(userId), &user); err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := update(tx, &user); err != nil {
+			return err
+		}
+		return boltPut(tx.Bucket(boltUsers), []byte(userId), user)
+	})
+}
+
+func (self storeBolt) SetUserConfirmedAt(userId string, confirmedAt time.Time) error {
+	return self.updateUser(userId, func(tx *bolt.Tx, user *boltUser) error {
+		user.ConfirmedAt = confirmedAt
+
+		createdAtKey := boltTimeKey(user.Tenant, user.CreatedAt, userId)
+		if confirmedAt.IsZero() {
+			return tx.Bucket(boltUnconfirmedUsers).Put(createdAtKey, []byte{})
+		}
+		return tx.Bucket(boltUnconfirmedUsers).Delete(createdAtKey)
+	})
+}
+
+func (self storeBolt) SetUserApprovedAt(userId string, approvedAt time.Time) error {
+	return self.updateUser(userId, func(tx *bolt.Tx, user *boltUser) error {
+		user.ApprovedAt = approvedAt
+		return nil
+	})
+}
+
+func (self storeBolt) SetUserResetKey(userId, resetKey string, resetKeyCreatedAt time.Time) error {
+	return self.updateUser(userId, func(tx *bolt.Tx, user *boltUser) error {
+		user.ResetKey = resetKey
+		user.ResetKeyCreatedAt = resetKeyCreatedAt
+		return nil
+	})
+}
+
+func (self storeBolt) SetUserHashedPass(userId, hashedPass string) error {
+	return self.updateUser(userId, func(tx *bolt.Tx, user *boltUser) error {
+		user.HashedPass = hashedPass
+		user.ResetKey = ""
+		user.ResetKeyCreatedAt = time.Time{}
+		return nil
+	})
+}
+
+func (self storeBolt) SetUserEmail(userId, email string) error {
+	return self.updateUser(userId, func(tx *bolt.Tx, user *boltUser) error {
+		emails := tx.Bucket(boltUserEmails)
+		emailKey := boltEmailKey(user.Tenant, email)
+		if otherUserId := emails.Get(emailKey); otherUserId != nil && string(otherUserId) != userId {
+			return errDuplicateEmail
+		}
+
+		if err := emails.Delete(boltEmailKey(user.Tenant, user.Email)); err != nil {
+			return err
+		}
+		user.Email = email
+		return emails.Put(emailKey, []byte(userId))
+	})
+}
+
+func (self storeBolt) GetUserId(tenant, email string) (userId string, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		id := tx.Bucket(boltUserEmails).Get(boltEmailKey(tenant, email))
+		if id == nil {
+			return sql.ErrNoRows
+		}
+		if _, err := boltGetUser(tx, string(id)); err != nil {
+			return err
+		}
+		userId = string(id)
+		return nil
+	})
+	return
+}
+
+// boltGetUser returns sql.ErrNoRows for the deleted users too.
+func boltGetUser(tx *bolt.Tx, userId string) (user boltUser, err error) {
+	if err = boltGet(tx.Bucket(boltUsers), []byte(userId), &user); err != nil {
+		return
+	}
+	if !user.DeletedAt.IsZero() {
+		err = sql.ErrNoRows
+	}
+	return
+}
+
+func (self storeBolt) GetUser(userId string) (user StoredUser, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		stored, err := boltGetUser(tx, userId)
+		if err != nil {
+			return err
+		}
+		user = stored.StoredUser
+		user.Tenant = stored.Tenant
+		return nil
+	})
+	return
+}
+
+// boltGetUsers loads the users of the time keys of an index.
+func boltGetUsers(tx *bolt.Tx, tenant string, keys [][]byte) (users []boltUser, err error) {
+	for _, key := range keys {
+		user := boltUser{}
+		if err = boltGet(tx.Bucket(boltUsers), []byte(boltTimeKeyId(tenant, key)), &user); err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	return
+}
+
+func boltAllUsers(tx *bolt.Tx, tenant string) ([]boltUser, error) {
+	keys := [][]byte{}
+	scanPrefix(tx.Bucket(boltUsersByCreatedAt), tenant, func(k, v []byte) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return boltGetUsers(tx, tenant, keys)
+}
+
+func boltUnconfirmedUsersBefore(tx *bolt.Tx, tenant string, date time.Time) ([]boltUser, error) {
+	keys := [][]byte{}
+	scanBefore(tx.Bucket(boltUnconfirmedUsers), tenant, date, func(k, v []byte) {
+		keys = append(keys, k)
+	})
+	return boltGetUsers(tx, tenant, keys)
+}
+
+func boltToUsers(boltUsers []boltUser) []User {
+	users := make([]User, len(boltUsers))
+	for i, user := range boltUsers {
+		users[i] = user.toUser()
+	}
+	return users
+}
+
+func (self storeBolt) GetAllUsers(tenant string) (users []User, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		stored, err := boltAllUsers(tx, tenant)
+		users = boltToUsers(stored)
+		return err
+	})
+	return
+}
+
+func (self storeBolt) GetProfile(userId string) (profile Profile, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		user := boltUser{}
+		if err := boltGet(tx.Bucket(boltUsers), []byte(userId), &user); err != nil {
+			return err
+		}
+		profile = Profile{UserData: user.UserProfile, AdminData: user.AdminProfile}
+		return nil
+	})
+	return
+}
+
+func (self storeBolt) SetUserProfile(userId string, userData json.RawMessage) error {
+	return self.updateUser(userId, func(tx *bolt.Tx, user *boltUser) error {
+		user.UserProfile = userData
+		return nil
+	})
+}
+
+func (self storeBolt) SetAdminProfile(userId string, adminData json.RawMessage) error {
+	return self.updateUser(userId, func(tx *bolt.Tx, user *boltUser) error {
+		user.AdminProfile = adminData
+		return nil
+	})
+}
+
+func (self storeBolt) CreateOrganization(organizationId string, createdAt time.Time, tenant, name string) error {
+	return self.update(func(tx *bolt.Tx) error {
+		organization := boltOrganization{Organization{organizationId, createdAt, name}, tenant}
+		return boltPut(tx.Bucket(boltOrganizations), []byte(organizationId), organization)
+	})
+}
+
+func (self storeBolt) AddMember(organizationId, userId, role string, createdAt time.Time) error {
+	return self.update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltUsers).Get([]byte(userId)) == nil || tx.Bucket(boltOrganizations).Get([]byte(organizationId)) == nil {
+			return errForeignKey
+		}
+
+		key := boltKey(organizationId, userId)
+		if tx.Bucket(boltMembers).Get(key) != nil {
+			return errDuplicateMember
+		}
+
+		if err := boltPut(tx.Bucket(boltMembers), key, Member{UserId: userId, Role: role, CreatedAt: createdAt}); err != nil {
+			return err
+		}
+		return tx.Bucket(boltMemberships).Put(boltKey(userId, organizationId), []byte{})
+	})
+}
+
+func (self storeBolt) SetMemberRole(organizationId, userId, role string) error {
+	return self.update(func(tx *bolt.Tx) error {
+		key := boltKey(organizationId, userId)
+		member := Member{}
+		if err := boltGet(tx.Bucket(boltMembers), key, &member); err != nil {
+			return err
+		}
+
+		member.Role = role
+		return boltPut(tx.Bucket(boltMembers), key, member)
+	})
+}
+
+func (self storeBolt) RemoveMembers(organizationId string, userIds ...string) error {
+	return self.update(func(tx *bolt.Tx) error {
+		for _, userId := range userIds {
+			if err := tx.Bucket(boltMembers).Delete(boltKey(organizationId, userId)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(boltMemberships).Delete(boltKey(userId, organizationId)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (self storeBolt) GetMemberRole(organizationId, userId string) (role string, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		member := Member{}
+		if err := boltGet(tx.Bucket(boltMembers), boltKey(organizationId, userId), &member); err != nil {
+			return err
+		}
+		role = member.Role
+		return nil
+	})
+	return
+}
+
+func (self storeBolt) GetMembers(organizationId string) (members []Member, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		scanPrefix(tx.Bucket(boltMembers), organizationId, func(k, v []byte) bool {
+			member := Member{}
+			if err = json.Unmarshal(v, &member); err != nil {
+				return false
+			}
+			user := boltUser{}
+			if err = boltGet(tx.Bucket(boltUsers), []byte(member.UserId), &user); err != nil {
+				return false
+			}
+			member.Email = user.Email
+			members = append(members, member)
+			return true
+		})
+		return err
+	})
+
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].UserId < members[j].UserId
+		}
+		return members[i].CreatedAt.Before(members[j].CreatedAt)
+	})
+	return
+}
+
+func (self storeBolt) GetMemberships(userId string) (memberships []Membership, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		scanPrefix(tx.Bucket(boltMemberships), userId, func(k, v []byte) bool {
+			organizationId := string(k[len(userId)+1:])
+
+			organization := boltOrganization{}
+			if err = boltGet(tx.Bucket(boltOrganizations), []byte(organizationId), &organization); err != nil {
+				return false
+			}
+			member := Member{}
+			if err = boltGet(tx.Bucket(boltMembers), boltKey(organizationId, userId), &member); err != nil {
+				return false
+			}
+			memberships = append(memberships, Membership{organization.Organization, member.Role})
+			return true
+		})
+		return err
+	})
+
+	sort.Slice(memberships, func(i, j int) bool {
+		return memberships[i].Organization.Name < memberships[j].Organization.Name
+	})
+	return
+}
+
+func (self storeBolt) CreateImpersonation(impersonationId string, createdAt time.Time, tenant, userId, reason string) error {
+	return self.update(func(tx *bolt.Tx) error {
+		impersonation := Impersonation{impersonationId, createdAt, userId, reason}
+		return boltPut(tx.Bucket(boltImpersonations), boltTimeKey(tenant, createdAt, impersonationId), impersonation)
+	})
+}
+
+func (self storeBolt) GetImpersonations(tenant string) (impersonations []Impersonation, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		scanPrefix(tx.Bucket(boltImpersonations), tenant, func(k, v []byte) bool {
+			impersonation := Impersonation{}
+			if err = json.Unmarshal(v, &impersonation); err != nil {
+				return false
+			}
+			impersonations = append(impersonations, impersonation)
+			return true
+		})
+		return err
+	})
+	return
+}
+
+func (self storeBolt) CreateSession(sessionId string, createdAt time.Time, userId string) error {
+	return self.update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltUsers).Get([]byte(userId)) == nil {
+			return errForeignKey
+		}
+
+		if err := boltPut(tx.Bucket(boltSessions), []byte(sessionId), boltSession{createdAt, userId}); err != nil {
+			return err
+		}
+		return tx.Bucket(boltUserSessions).Put(boltKey(userId, sessionId), []byte{})
+	})
+}
+
+func (self storeBolt) GetSessionUserId(sessionId string) (userId string, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		session := boltSession{}
+		if err := boltGet(tx.Bucket(boltSessions), []byte(sessionId), &session); err != nil {
+			return err
+		}
+		userId = session.UserId
+		return nil
+	})
+	return
+}
+
+func (self storeBolt) RemoveSessions(sessionIds ...string) error {
+	return self.update(func(tx *bolt.Tx) error {
+		for _, sessionId := range sessionIds {
+			session := boltSession{}
+			if err := boltGet(tx.Bucket(boltSessions), []byte(sessionId), &session); err == sql.ErrNoRows {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			if err := tx.Bucket(boltSessions).Delete([]byte(sessionId)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(boltUserSessions).Delete(boltKey(session.UserId, sessionId)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (self storeBolt) CreateAccessToken(userId, hashedToken string, accessToken AccessToken) error {
+	return self.update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltUsers).Get([]byte(userId)) == nil {
+			return errForeignKey
+		}
+		if tx.Bucket(boltAccessTokenHashes).Get([]byte(hashedToken)) != nil {
+			return errDuplicateAccessToken
+		}
+
+		accessToken.LastUsedAt = time.Time{}
+		stored := boltAccessToken{accessToken, userId, hashedToken}
+		if err := boltPut(tx.Bucket(boltAccessTokens), []byte(accessToken.Id), stored); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltAccessTokenHashes).Put([]byte(hashedToken), []byte(accessToken.Id)); err != nil {
+			return err
+		}
+		return tx.Bucket(boltUserAccessTokens).Put(boltKey(userId, accessToken.Id), []byte{})
+	})
+}
+
+func (self storeBolt) GetAccessTokens(userId string) (accessTokens []AccessToken, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		var err error
+		scanPrefix(tx.Bucket(boltUserAccessTokens), userId, func(k, v []byte) bool {
+			accessToken := boltAccessToken{}
+			if err = boltGet(tx.Bucket(boltAccessTokens), k[len(userId)+1:], &accessToken); err != nil {
+				return false
+			}
+			accessTokens = append(accessTokens, accessToken.AccessToken)
+			return true
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(accessTokens, func(i, j int) bool {
+		return accessTokens[i].CreatedAt.Before(accessTokens[j].CreatedAt)
+	})
+	return
+}
+
+func (self storeBolt) GetAccessTokenByHash(hashedToken string) (accessToken AccessToken, userId string, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		accessTokenId := tx.Bucket(boltAccessTokenHashes).Get([]byte(hashedToken))
+		if accessTokenId == nil {
+			return sql.ErrNoRows
+		}
+
+		stored := boltAccessToken{}
+		if err := boltGet(tx.Bucket(boltAccessTokens), accessTokenId, &stored); err != nil {
+			return err
+		}
+		accessToken, userId = stored.AccessToken, stored.UserId
+		return nil
+	})
+	return
+}
+
+func (self storeBolt) SetAccessTokenLastUsedAt(accessTokenId string, lastUsedAt time.Time) error {
+	return self.update(func(tx *bolt.Tx) error {
+		stored := boltAccessToken{}
+		if err := boltGet(tx.Bucket(boltAccessTokens), []byte(accessTokenId), &stored); err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		stored.LastUsedAt = lastUsedAt
+		return boltPut(tx.Bucket(boltAccessTokens), []byte(accessTokenId), stored)
+	})
+}
+
+func (self storeBolt) RemoveAccessTokens(userId string, accessTokenIds ...string) error {
+	return self.update(func(tx *bolt.Tx) error {
+		return boltRemoveAccessTokens(tx, userId, accessTokenIds...)
+	})
+}
+
+// boltRemoveAccessTokens removes the access tokens of the user with the
+// given ids, along with their indexes.
+func boltRemoveAccessTokens(tx *bolt.Tx, userId string, accessTokenIds ...string) error {
+	for _, accessTokenId := range accessTokenIds {
+		stored := boltAccessToken{}
+		if err := boltGet(tx.Bucket(boltAccessTokens), []byte(accessTokenId), &stored); err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if stored.UserId != userId {
+			continue
+		}
+
+		deletes := []boltDelete{
+			{boltAccessTokens, []byte(accessTokenId)},
+			{boltAccessTokenHashes, []byte(stored.HashedToken)},
+			{boltUserAccessTokens, boltKey(userId, accessTokenId)},
+		}
+		for _, d := range deletes {
+			if err := tx.Bucket(d.bucket).Delete(d.key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (self storeBolt) CreateServiceAccount(tenant, hashedSecret string, serviceAccount ServiceAccount) error {
+	return self.update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltServiceAccounts).Get([]byte(serviceAccount.Id)) != nil {
+			return errDuplicateServiceAccount
+		}
+
+		serviceAccount.DisabledAt = time.Time{}
+		stored := boltServiceAccount{serviceAccount, tenant, hashedSecret}
+		if err := boltPut(tx.Bucket(boltServiceAccounts), []byte(serviceAccount.Id), stored); err != nil {
+			return err
+		}
+		createdAtKey := boltTimeKey(tenant, serviceAccount.CreatedAt, serviceAccount.Id)
+		return tx.Bucket(boltTenantServiceAccounts).Put(createdAtKey, []byte{})
+	})
+}
+
+func (self storeBolt) GetServiceAccounts(tenant string) (serviceAccounts []ServiceAccount, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		var err error
+		scanPrefix(tx.Bucket(boltTenantServiceAccounts), tenant, func(k, v []byte) bool {
+			serviceAccount := boltServiceAccount{}
+			if err = boltGet(tx.Bucket(boltServiceAccounts), []byte(boltTimeKeyId(tenant, k)), &serviceAccount); err != nil {
+				return false
+			}
+			serviceAccounts = append(serviceAccounts, serviceAccount.ServiceAccount)
+			return true
+		})
+		return err
+	})
+	if err != nil {
+		serviceAccounts = nil
+	}
+	return
+}
+
+func (self storeBolt) GetServiceAccount(tenant, serviceAccountId string) (serviceAccount ServiceAccount, hashedSecret string, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		stored := boltServiceAccount{}
+		if err := boltGet(tx.Bucket(boltServiceAccounts), []byte(serviceAccountId), &stored); err != nil {
+			return err
+		}
+		if stored.Tenant != tenant {
+			return sql.ErrNoRows
+		}
+		serviceAccount, hashedSecret = stored.ServiceAccount, stored.HashedSecret
+		return nil
+	})
+	return
+}
+
+func (self storeBolt) SetServiceAccountHashedSecret(serviceAccountId, hashedSecret string) error {
+	return self.updateServiceAccount(serviceAccountId, func(serviceAccount *boltServiceAccount) {
+		serviceAccount.HashedSecret = hashedSecret
+	})
+}
+
+func (self storeBolt) SetServiceAccountDisabledAt(serviceAccountId string, disabledAt time.Time) error {
+	return self.updateServiceAccount(serviceAccountId, func(serviceAccount *boltServiceAccount) {
+		serviceAccount.DisabledAt = disabledAt
+	})
+}
+
+// updateServiceAccount applies update to the service account, if it
+// exists.
+func (self storeBolt) updateServiceAccount(serviceAccountId string, update func(serviceAccount *boltServiceAccount)) error {
+	return self.update(func(tx *bolt.Tx) error {
+		stored := boltServiceAccount{}
+		if err := boltGet(tx.Bucket(boltServiceAccounts), []byte(serviceAccountId), &stored); err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		update(&stored)
+		return boltPut(tx.Bucket(boltServiceAccounts), []byte(serviceAccountId), stored)
+	})
+}
+
+func (self storeBolt) AcquireJobLock(tenant, job, owner string, now, lockedUntil time.Time) (acquired bool, err error) {
+	err = self.update(func(tx *bolt.Tx) error {
+		key := boltKey(tenant, job)
+		lock := boltJobLock{}
+		if err := boltGet(tx.Bucket(boltJobLocks), key, &lock); err == nil && lock.LockedUntil.After(now) {
+			return nil
+		} else if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		acquired = true
+		return boltPut(tx.Bucket(boltJobLocks), key, boltJobLock{owner, lockedUntil})
+	})
+	return
+}
+
+func (self storeBolt) CreateJobRun(tenant string, jobRun JobRun) error {
+	return self.update(func(tx *bolt.Tx) error {
+		return boltPut(tx.Bucket(boltJobRuns), boltTimeKey(tenant, jobRun.StartedAt, jobRun.Id), jobRun)
+	})
+}
+
+func (self storeBolt) GetJobRuns(tenant string, limit int) (jobRuns []JobRun, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		prefix := append([]byte(tenant), 0)
+
+		// The newest runs are last, just before the next tenant.
+		c := tx.Bucket(boltJobRuns).Cursor()
+		k, v := c.Seek(append([]byte(tenant), 1))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+
+		for ; k != nil && bytes.HasPrefix(k, prefix) && len(jobRuns) < limit; k, v = c.Prev() {
+			jobRun := JobRun{}
+			if err := json.Unmarshal(v, &jobRun); err != nil {
+				return err
+			}
+			jobRuns = append(jobRuns, jobRun)
+		}
+		return nil
+	})
+	return
+}
+
+func (self storeBolt) GetUnapprovedUsers(tenant string) (users []User, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		stored, err := boltAllUsers(tx, tenant)
+		for _, user := range stored {
+			if !user.ConfirmedAt.IsZero() && user.ApprovedAt.IsZero() {
+				users = append(users, user.toUser())
+			}
+		}
+		return err
+	})
+	return
+}
+
+func (self storeBolt) GetUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []User, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		stored, err := boltUnconfirmedUsersBefore(tx, tenant, date)
+		users = boltToUsers(stored)
+		return err
+	})
+	return
+}
+
+func (self storeBolt) GetUnwarnedUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []StoredUser, err error) {
+	err = self.view(func(tx *bolt.Tx) error {
+		stored, err := boltUnconfirmedUsersBefore(tx, tenant, date)
+		for _, user := range stored {
+			if user.RemovalWarnedAt.IsZero() {
+				users = append(users, user.StoredUser)
+			}
+		}
+		return err
+	})
+	return
+}
+
+func (self storeBolt) SetUserRemovalWarnedAt(userId string, removalWarnedAt time.Time) error {
+	return self.updateUser(userId, func(tx *bolt.Tx, user *boltUser) error {
+		user.RemovalWarnedAt = removalWarnedAt
+		return nil
+	})
+}
+
+func (self storeBolt) RemoveUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (removedUsers []User, err error) {
+	err = self.update(func(tx *bolt.Tx) error {
+		stored, err := boltUnconfirmedUsersBefore(tx, tenant, date)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range stored {
+			if err := boltRemoveUser(tx, user.Id); err != nil {
+				return err
+			}
+		}
+		removedUsers = boltToUsers(stored)
+		return nil
+	})
+	return
+}
+
+func (self storeBolt) ClearResetKeysCreatedBefore(tenant string, date time.Time) (cleared int64, err error) {
+	err = self.update(func(tx *bolt.Tx) error {
+		users, err := boltAllUsers(tx, tenant)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			if user.ResetKeyCreatedAt.IsZero() || !user.ResetKeyCreatedAt.Before(date) {
+				continue
+			}
+			user.ResetKey = ""
+			user.ResetKeyCreatedAt = time.Time{}
+			if err := boltPut(tx.Bucket(boltUsers), []byte(user.Id), user); err != nil {
+				return err
+			}
+			cleared++
+		}
+		return nil
+	})
+	return
+}
+
+func (self storeBolt) RemoveUsersDeletedBefore(tenant string, date time.Time) (removed int64, err error) {
+	err = self.update(func(tx *bolt.Tx) error {
+		userIds := []string{}
+		scanBefore(tx.Bucket(boltDeletedUsers), tenant, date, func(k, v []byte) {
+			userIds = append(userIds, boltTimeKeyId(tenant, k))
+		})
+
+		for _, userId := range userIds {
+			if err := boltRemoveUser(tx, userId); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return
+}
+
+func (self storeBolt) RemoveSessionsCreatedBefore(tenant string, date time.Time) (removed int64, err error) {
+	err = self.update(func(tx *bolt.Tx) error {
+		users, err := boltAllUsers(tx, tenant)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			sessionIds := []string{}
+			scanPrefix(tx.Bucket(boltUserSessions), user.Id, func(k, v []byte) bool {
+				sessionIds = append(sessionIds, string(k[len(user.Id)+1:]))
+				return true
+			})
+
+			for _, sessionId := range sessionIds {
+				session := boltSession{}
+				if err := boltGet(tx.Bucket(boltSessions), []byte(sessionId), &session); err != nil {
+					return err
+				}
+				if !session.CreatedAt.Before(date) {
+					continue
+				}
+				if err := tx.Bucket(boltSessions).Delete([]byte(sessionId)); err != nil {
+					return err
+				}
+				if err := tx.Bucket(boltUserSessions).Delete(boltKey(user.Id, sessionId)); err != nil {
+					return err
+				}
+				removed++
+			}
+		}
+		return nil
+	})
+	return
+}
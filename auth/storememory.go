@@ -0,0 +1,912 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// storeMemory keeps everything in memory, for tests and for trying the
+// service out. It is safe for concurrent use and enforces the same unique
+// and foreign keys as the SQL stores.
+type storeMemory struct {
+	mutex rwLocker
+	state *memoryState
+}
+
+type rwLocker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+}
+
+// memoryTxLock is the lock of the store within WithTx, which already holds
+// the lock of the store.
+type memoryTxLock struct{}
+
+func (memoryTxLock) Lock()    {}
+func (memoryTxLock) Unlock()  {}
+func (memoryTxLock) RLock()   {}
+func (memoryTxLock) RUnlock() {}
+
+// MemorySnapshot is a copy of the data of an in-memory store.
+type MemorySnapshot struct {
+	state memoryState
+}
+
+type memoryState struct {
+	users           map[string]memoryUser
+	userIds         map[memoryEmailKey]string
+	organizations   map[string]memoryOrganization
+	members         map[memoryMemberKey]Member
+	impersonations  []memoryImpersonation
+	sessions        map[string]memorySession
+	accessTokens    map[string]memoryAccessToken
+	accessTokenIds  map[string]string
+	serviceAccounts map[string]memoryServiceAccount
+	jobLocks        map[memoryJobKey]memoryJobLock
+	jobRuns         []memoryJobRun
+}
+
+type memoryUser struct {
+	StoredUser
+	tenant            string
+	resetKeyCreatedAt time.Time
+	removalWarnedAt   time.Time
+	deletedAt         time.Time
+	userProfile       json.RawMessage
+	adminProfile      json.RawMessage
+}
+
+// memoryEmailKey has the email folded, as the emails are not case
+// sensitive.
+type memoryEmailKey struct {
+	tenant, email string
+}
+
+func newMemoryEmailKey(tenant, email string) memoryEmailKey {
+	return memoryEmailKey{tenant, foldEmail(email)}
+}
+
+type memoryOrganization struct {
+	Organization
+	tenant string
+}
+
+type memoryMemberKey struct {
+	organizationId, userId string
+}
+
+type memoryImpersonation struct {
+	Impersonation
+	tenant string
+}
+
+type memorySession struct {
+	createdAt time.Time
+	userId    string
+}
+
+type memoryAccessToken struct {
+	AccessToken
+	userId      string
+	hashedToken string
+}
+
+type memoryServiceAccount struct {
+	ServiceAccount
+	tenant       string
+	hashedSecret string
+}
+
+type memoryJobKey struct {
+	tenant, job string
+}
+
+type memoryJobLock struct {
+	owner       string
+	lockedUntil time.Time
+}
+
+type memoryJobRun struct {
+	JobRun
+	tenant string
+}
+
+func NewStoreMemory() storeMemory {
+	return storeMemory{&sync.RWMutex{}, newMemoryState()}
+}
+
+func newMemoryState() *memoryState {
+	return &memoryState{
+		users:           map[string]memoryUser{},
+		userIds:         map[memoryEmailKey]string{},
+		organizations:   map[string]memoryOrganization{},
+		members:         map[memoryMemberKey]Member{},
+		sessions:        map[string]memorySession{},
+		accessTokens:    map[string]memoryAccessToken{},
+		accessTokenIds:  map[string]string{},
+		serviceAccounts: map[string]memoryServiceAccount{},
+		jobLocks:        map[memoryJobKey]memoryJobLock{},
+	}
+}
+
+// Snapshot copies the data of the store, to be restored later with Restore.
+func (self storeMemory) Snapshot() MemorySnapshot {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	return MemorySnapshot{self.state.copy()}
+}
+
+func (self storeMemory) Restore(snapshot MemorySnapshot) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	*self.state = snapshot.state.copy()
+}
+
+func (self memoryState) copy() memoryState {
+	state := *newMemoryState()
+	for k, v := range self.users {
+		state.users[k] = v
+	}
+	for k, v := range self.userIds {
+		state.userIds[k] = v
+	}
+	for k, v := range self.organizations {
+		state.organizations[k] = v
+	}
+	for k, v := range self.members {
+		state.members[k] = v
+	}
+	for k, v := range self.sessions {
+		state.sessions[k] = v
+	}
+	for k, v := range self.accessTokens {
+		state.accessTokens[k] = v
+	}
+	for k, v := range self.accessTokenIds {
+		state.accessTokenIds[k] = v
+	}
+	for k, v := range self.serviceAccounts {
+		state.serviceAccounts[k] = v
+	}
+	for k, v := range self.jobLocks {
+		state.jobLocks[k] = v
+	}
+	state.impersonations = append(state.impersonations, self.impersonations...)
+	state.jobRuns = append(state.jobRuns, self.jobRuns...)
+	return state
+}
+
+func (self storeMemory) Migrate(version int) error {
+	return nil
+}
+
+func (self storeMemory) SchemaVersion() (version int, err error) {
+	return 0, nil
+}
+
+// WithContext returns the store itself, whose operations never wait on
+// anything but each other.
+func (self storeMemory) WithContext(ctx context.Context) Store {
+	return self
+}
+
+// WithTx runs one transaction at a time, and restores a copy of the data
+// when fn fails.
+func (self storeMemory) WithTx(fn func(tx Store) error) error {
+	if _, ok := self.mutex.(memoryTxLock); ok {
+		return fn(self)
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	rollback := self.state.copy()
+	if err := fn(storeMemory{memoryTxLock{}, self.state}); err != nil {
+		*self.state = rollback
+		return err
+	}
+	return nil
+}
+
+func (self storeMemory) LockUser(userId string) error {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	if !self.state.hasUser(userId) {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (self storeMemory) LockOrganization(organizationId string) error {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	if _, ok := self.state.organizations[organizationId]; !ok {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (self storeMemory) CreateUser(userId string, createdAt time.Time, tenant, email, hashedPass, lang, confirmationKey string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if _, ok := self.state.users[userId]; ok {
+		return errDuplicateUser
+	}
+	emailKey := newMemoryEmailKey(tenant, email)
+	if _, ok := self.state.userIds[emailKey]; ok {
+		return errDuplicateEmail
+	}
+
+	self.state.users[userId] = memoryUser{
+		StoredUser: StoredUser{
+			Id:              userId,
+			CreatedAt:       createdAt,
+			Email:           email,
+			HashedPass:      hashedPass,
+			Lang:            lang,
+			ConfirmationKey: confirmationKey,
+		},
+		tenant:       tenant,
+		userProfile:  json.RawMessage(`{}`),
+		adminProfile: json.RawMessage(`{}`),
+	}
+	self.state.userIds[emailKey] = userId
+	return nil
+}
+
+func (self storeMemory) RemoveUsers(userIds ...string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, userId := range userIds {
+		self.state.removeUser(userId)
+	}
+	return nil
+}
+
+func (self storeMemory) DeleteUsers(deletedAt time.Time, userIds ...string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, userId := range userIds {
+		user, ok := self.state.users[userId]
+		if !ok || !user.deletedAt.IsZero() {
+			continue
+		}
+
+		user.deletedAt = deletedAt
+		self.state.users[userId] = user
+		self.state.removeUserRecords(userId)
+	}
+	return nil
+}
+
+// hasUser tells whether the user exists and is not deleted.
+func (self *memoryState) hasUser(userId string) bool {
+	user, ok := self.users[userId]
+	return ok && user.deletedAt.IsZero()
+}
+
+// removeUser also removes the memberships, sessions and access tokens of the
+// user, as the ON DELETE CASCADE of the SQL stores.
+func (self *memoryState) removeUser(userId string) {
+	user, ok := self.users[userId]
+	if !ok {
+		return
+	}
+
+	delete(self.users, userId)
+	delete(self.userIds, newMemoryEmailKey(user.tenant, user.Email))
+	self.removeUserRecords(userId)
+}
+
+// removeUserRecords removes the memberships, sessions and access tokens of
+// the user.
+func (self *memoryState) removeUserRecords(userId string) {
+	for key := range self.members {
+		if key.userId == userId {
+			delete(self.members, key)
+		}
+	}
+	for sessionId, session := range self.sessions {
+		if session.userId == userId {
+			delete(self.sessions, sessionId)
+		}
+	}
+	for accessTokenId, accessToken := range self.accessTokens {
+		if accessToken.userId == userId {
+			delete(self.accessTokens, accessTokenId)
+			delete(self.accessTokenIds, accessToken.hashedToken)
+		}
+	}
+}
+
+// updateUser applies update to the user, if it exists.
+func (self storeMemory) updateUser(userId string, update func(user *memoryUser)) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	user, ok := self.state.users[userId]
+	if !ok {
+		return
+	}
+	update(&user)
+	self.state.users[userId] = user
+}
+
+func (self storeMemory) SetUserConfirmedAt(userId string, confirmedAt time.Time) error {
+	self.updateUser(userId, func(user *memoryUser) {
+		user.ConfirmedAt = confirmedAt
+	})
+	return nil
+}
+
+func (self storeMemory) SetUserApprovedAt(userId string, approvedAt time.Time) error {
+	self.updateUser(userId, func(user *memoryUser) {
+		user.ApprovedAt = approvedAt
+	})
+	return nil
+}
+
+func (self storeMemory) SetUserResetKey(userId, resetKey string, resetKeyCreatedAt time.Time) error {
+	self.updateUser(userId, func(user *memoryUser) {
+		user.ResetKey = resetKey
+		user.resetKeyCreatedAt = resetKeyCreatedAt
+	})
+	return nil
+}
+
+func (self storeMemory) SetUserHashedPass(userId, hashedPass string) error {
+	self.updateUser(userId, func(user *memoryUser) {
+		user.HashedPass = hashedPass
+		user.ResetKey = ""
+		user.resetKeyCreatedAt = time.Time{}
+	})
+	return nil
+}
+
+func (self storeMemory) SetUserEmail(userId, email string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	user, ok := self.state.users[userId]
+	if !ok {
+		return nil
+	}
+
+	emailKey := newMemoryEmailKey(user.tenant, email)
+	if otherUserId, ok := self.state.userIds[emailKey]; ok && otherUserId != userId {
+		return errDuplicateEmail
+	}
+
+	delete(self.state.userIds, newMemoryEmailKey(user.tenant, user.Email))
+	self.state.userIds[emailKey] = userId
+	user.Email = email
+	self.state.users[userId] = user
+	return nil
+}
+
+func (self storeMemory) GetUserId(tenant, email string) (userId string, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	userId, ok := self.state.userIds[newMemoryEmailKey(tenant, email)]
+	if !ok || !self.state.hasUser(userId) {
+		return "", sql.ErrNoRows
+	}
+	return
+}
+
+func (self storeMemory) GetUser(userId string) (user StoredUser, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	memoryUser, ok := self.state.users[userId]
+	if !ok || !memoryUser.deletedAt.IsZero() {
+		err = sql.ErrNoRows
+		return
+	}
+	user = memoryUser.StoredUser
+	user.Tenant = memoryUser.tenant
+	return
+}
+
+// findUsers returns the users of the tenant that match, by creation date,
+// leaving out the deleted users.
+func (self storeMemory) findUsers(tenant string, match func(user memoryUser) bool) []memoryUser {
+	users := []memoryUser{}
+	for _, user := range self.state.users {
+		if user.tenant == tenant && user.deletedAt.IsZero() && match(user) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].Id < users[j].Id
+		}
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	return users
+}
+
+func toUsers(memoryUsers []memoryUser) []User {
+	users := make([]User, len(memoryUsers))
+	for i, user := range memoryUsers {
+		users[i] = user.toUser()
+	}
+	return users
+}
+
+func (self storeMemory) GetAllUsers(tenant string) (users []User, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	return toUsers(self.findUsers(tenant, func(user memoryUser) bool { return true })), nil
+}
+
+func (self storeMemory) GetProfile(userId string) (profile Profile, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	user, ok := self.state.users[userId]
+	if !ok {
+		err = sql.ErrNoRows
+		return
+	}
+	return Profile{UserData: user.userProfile, AdminData: user.adminProfile}, nil
+}
+
+func (self storeMemory) SetUserProfile(userId string, userData json.RawMessage) error {
+	userData = append(json.RawMessage{}, userData...)
+	self.updateUser(userId, func(user *memoryUser) {
+		user.userProfile = userData
+	})
+	return nil
+}
+
+func (self storeMemory) SetAdminProfile(userId string, adminData json.RawMessage) error {
+	adminData = append(json.RawMessage{}, adminData...)
+	self.updateUser(userId, func(user *memoryUser) {
+		user.adminProfile = adminData
+	})
+	return nil
+}
+
+func (self storeMemory) CreateOrganization(organizationId string, createdAt time.Time, tenant, name string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.state.organizations[organizationId] = memoryOrganization{Organization{organizationId, createdAt, name}, tenant}
+	return nil
+}
+
+func (self storeMemory) AddMember(organizationId, userId, role string, createdAt time.Time) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	user, ok := self.state.users[userId]
+	if _, orgOk := self.state.organizations[organizationId]; !ok || !orgOk {
+		return errForeignKey
+	}
+
+	key := memoryMemberKey{organizationId, userId}
+	if _, ok := self.state.members[key]; ok {
+		return errDuplicateMember
+	}
+
+	self.state.members[key] = Member{userId, user.Email, role, createdAt}
+	return nil
+}
+
+func (self storeMemory) SetMemberRole(organizationId, userId, role string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	key := memoryMemberKey{organizationId, userId}
+	member, ok := self.state.members[key]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	member.Role = role
+	self.state.members[key] = member
+	return nil
+}
+
+func (self storeMemory) RemoveMembers(organizationId string, userIds ...string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, userId := range userIds {
+		delete(self.state.members, memoryMemberKey{organizationId, userId})
+	}
+	return nil
+}
+
+func (self storeMemory) GetMemberRole(organizationId, userId string) (role string, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	member, ok := self.state.members[memoryMemberKey{organizationId, userId}]
+	if !ok {
+		err = sql.ErrNoRows
+		return
+	}
+	return member.Role, nil
+}
+
+func (self storeMemory) GetMembers(organizationId string) (members []Member, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	members = []Member{}
+	for key, member := range self.state.members {
+		if key.organizationId == organizationId {
+			// The email may have changed since the user joined.
+			member.Email = self.state.users[member.UserId].Email
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].UserId < members[j].UserId
+		}
+		return members[i].CreatedAt.Before(members[j].CreatedAt)
+	})
+	return
+}
+
+func (self storeMemory) GetMemberships(userId string) (memberships []Membership, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	memberships = []Membership{}
+	for key, member := range self.state.members {
+		if key.userId == userId {
+			organization := self.state.organizations[key.organizationId].Organization
+			memberships = append(memberships, Membership{organization, member.Role})
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool {
+		return memberships[i].Organization.Name < memberships[j].Organization.Name
+	})
+	return
+}
+
+func (self storeMemory) CreateImpersonation(impersonationId string, createdAt time.Time, tenant, userId, reason string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.state.impersonations = append(self.state.impersonations, memoryImpersonation{
+		Impersonation{impersonationId, createdAt, userId, reason},
+		tenant,
+	})
+	return nil
+}
+
+func (self storeMemory) GetImpersonations(tenant string) (impersonations []Impersonation, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	impersonations = []Impersonation{}
+	for _, impersonation := range self.state.impersonations {
+		if impersonation.tenant == tenant {
+			impersonations = append(impersonations, impersonation.Impersonation)
+		}
+	}
+	sort.SliceStable(impersonations, func(i, j int) bool {
+		return impersonations[i].CreatedAt.Before(impersonations[j].CreatedAt)
+	})
+	return
+}
+
+func (self storeMemory) CreateSession(sessionId string, createdAt time.Time, userId string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if _, ok := self.state.users[userId]; !ok {
+		return errForeignKey
+	}
+
+	self.state.sessions[sessionId] = memorySession{createdAt, userId}
+	return nil
+}
+
+func (self storeMemory) GetSessionUserId(sessionId string) (userId string, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	session, ok := self.state.sessions[sessionId]
+	if !ok {
+		err = sql.ErrNoRows
+		return
+	}
+	return session.userId, nil
+}
+
+func (self storeMemory) RemoveSessions(sessionIds ...string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, sessionId := range sessionIds {
+		delete(self.state.sessions, sessionId)
+	}
+	return nil
+}
+
+func (self storeMemory) CreateAccessToken(userId, hashedToken string, accessToken AccessToken) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if _, ok := self.state.users[userId]; !ok {
+		return errForeignKey
+	}
+	if _, ok := self.state.accessTokenIds[hashedToken]; ok {
+		return errDuplicateAccessToken
+	}
+
+	accessToken.Scopes = append([]string{}, accessToken.Scopes...)
+	accessToken.LastUsedAt = time.Time{}
+	self.state.accessTokens[accessToken.Id] = memoryAccessToken{accessToken, userId, hashedToken}
+	self.state.accessTokenIds[hashedToken] = accessToken.Id
+	return nil
+}
+
+func (self storeMemory) GetAccessTokens(userId string) (accessTokens []AccessToken, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	for _, accessToken := range self.state.accessTokens {
+		if accessToken.userId == userId {
+			accessTokens = append(accessTokens, accessToken.AccessToken)
+		}
+	}
+	sort.Slice(accessTokens, func(i, j int) bool {
+		return accessTokens[i].CreatedAt.Before(accessTokens[j].CreatedAt)
+	})
+	return
+}
+
+func (self storeMemory) GetAccessTokenByHash(hashedToken string) (accessToken AccessToken, userId string, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	stored, ok := self.state.accessTokens[self.state.accessTokenIds[hashedToken]]
+	if !ok {
+		err = sql.ErrNoRows
+		return
+	}
+	return stored.AccessToken, stored.userId, nil
+}
+
+func (self storeMemory) SetAccessTokenLastUsedAt(accessTokenId string, lastUsedAt time.Time) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if accessToken, ok := self.state.accessTokens[accessTokenId]; ok {
+		accessToken.LastUsedAt = lastUsedAt
+		self.state.accessTokens[accessTokenId] = accessToken
+	}
+	return nil
+}
+
+func (self storeMemory) RemoveAccessTokens(userId string, accessTokenIds ...string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, accessTokenId := range accessTokenIds {
+		if accessToken, ok := self.state.accessTokens[accessTokenId]; ok && accessToken.userId == userId {
+			delete(self.state.accessTokens, accessTokenId)
+			delete(self.state.accessTokenIds, accessToken.hashedToken)
+		}
+	}
+	return nil
+}
+
+func (self storeMemory) CreateServiceAccount(tenant, hashedSecret string, serviceAccount ServiceAccount) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if _, ok := self.state.serviceAccounts[serviceAccount.Id]; ok {
+		return errDuplicateServiceAccount
+	}
+
+	serviceAccount.Scopes = append([]string{}, serviceAccount.Scopes...)
+	serviceAccount.DisabledAt = time.Time{}
+	self.state.serviceAccounts[serviceAccount.Id] = memoryServiceAccount{serviceAccount, tenant, hashedSecret}
+	return nil
+}
+
+func (self storeMemory) GetServiceAccounts(tenant string) (serviceAccounts []ServiceAccount, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	for _, serviceAccount := range self.state.serviceAccounts {
+		if serviceAccount.tenant == tenant {
+			serviceAccounts = append(serviceAccounts, serviceAccount.ServiceAccount)
+		}
+	}
+	sort.Slice(serviceAccounts, func(i, j int) bool {
+		return serviceAccounts[i].CreatedAt.Before(serviceAccounts[j].CreatedAt)
+	})
+	return
+}
+
+func (self storeMemory) GetServiceAccount(tenant, serviceAccountId string) (serviceAccount ServiceAccount, hashedSecret string, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	stored, ok := self.state.serviceAccounts[serviceAccountId]
+	if !ok || stored.tenant != tenant {
+		err = sql.ErrNoRows
+		return
+	}
+	return stored.ServiceAccount, stored.hashedSecret, nil
+}
+
+func (self storeMemory) SetServiceAccountHashedSecret(serviceAccountId, hashedSecret string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if serviceAccount, ok := self.state.serviceAccounts[serviceAccountId]; ok {
+		serviceAccount.hashedSecret = hashedSecret
+		self.state.serviceAccounts[serviceAccountId] = serviceAccount
+	}
+	return nil
+}
+
+func (self storeMemory) SetServiceAccountDisabledAt(serviceAccountId string, disabledAt time.Time) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if serviceAccount, ok := self.state.serviceAccounts[serviceAccountId]; ok {
+		serviceAccount.DisabledAt = disabledAt
+		self.state.serviceAccounts[serviceAccountId] = serviceAccount
+	}
+	return nil
+}
+
+func (self storeMemory) AcquireJobLock(tenant, job, owner string, now, lockedUntil time.Time) (acquired bool, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	key := memoryJobKey{tenant, job}
+	if lock, ok := self.state.jobLocks[key]; ok && lock.lockedUntil.After(now) {
+		return false, nil
+	}
+
+	self.state.jobLocks[key] = memoryJobLock{owner, lockedUntil}
+	return true, nil
+}
+
+func (self storeMemory) CreateJobRun(tenant string, jobRun JobRun) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.state.jobRuns = append(self.state.jobRuns, memoryJobRun{jobRun, tenant})
+	return nil
+}
+
+func (self storeMemory) GetJobRuns(tenant string, limit int) (jobRuns []JobRun, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	jobRuns = []JobRun{}
+	for _, jobRun := range self.state.jobRuns {
+		if jobRun.tenant == tenant {
+			jobRuns = append(jobRuns, jobRun.JobRun)
+		}
+	}
+	sort.SliceStable(jobRuns, func(i, j int) bool {
+		return jobRuns[i].StartedAt.After(jobRuns[j].StartedAt)
+	})
+	if len(jobRuns) > limit {
+		jobRuns = jobRuns[:limit]
+	}
+	return
+}
+
+func unconfirmedBefore(date time.Time) func(user memoryUser) bool {
+	return func(user memoryUser) bool {
+		return user.CreatedAt.Before(date) && user.ConfirmedAt.IsZero()
+	}
+}
+
+func (self storeMemory) GetUnapprovedUsers(tenant string) (users []User, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	return toUsers(self.findUsers(tenant, func(user memoryUser) bool {
+		return !user.ConfirmedAt.IsZero() && user.ApprovedAt.IsZero()
+	})), nil
+}
+
+func (self storeMemory) GetUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []User, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	return toUsers(self.findUsers(tenant, unconfirmedBefore(date))), nil
+}
+
+func (self storeMemory) GetUnwarnedUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []StoredUser, err error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	users = []StoredUser{}
+	for _, user := range self.findUsers(tenant, unconfirmedBefore(date)) {
+		if user.removalWarnedAt.IsZero() {
+			users = append(users, user.StoredUser)
+		}
+	}
+	return
+}
+
+func (self storeMemory) SetUserRemovalWarnedAt(userId string, removalWarnedAt time.Time) error {
+	self.updateUser(userId, func(user *memoryUser) {
+		user.removalWarnedAt = removalWarnedAt
+	})
+	return nil
+}
+
+func (self storeMemory) RemoveUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (removedUsers []User, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	users := self.findUsers(tenant, unconfirmedBefore(date))
+	for _, user := range users {
+		self.state.removeUser(user.Id)
+	}
+	return toUsers(users), nil
+}
+
+func (self storeMemory) ClearResetKeysCreatedBefore(tenant string, date time.Time) (cleared int64, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for userId, user := range self.state.users {
+		if user.tenant == tenant && !user.resetKeyCreatedAt.IsZero() && user.resetKeyCreatedAt.Before(date) {
+			user.ResetKey = ""
+			user.resetKeyCreatedAt = time.Time{}
+			self.state.users[userId] = user
+			cleared++
+		}
+	}
+	return
+}
+
+func (self storeMemory) RemoveUsersDeletedBefore(tenant string, date time.Time) (removed int64, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for userId, user := range self.state.users {
+		if user.tenant == tenant && !user.deletedAt.IsZero() && user.deletedAt.Before(date) {
+			self.state.removeUser(userId)
+			removed++
+		}
+	}
+	return
+}
+
+func (self storeMemory) RemoveSessionsCreatedBefore(tenant string, date time.Time) (removed int64, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for sessionId, session := range self.state.sessions {
+		if self.state.users[session.userId].tenant == tenant && session.createdAt.Before(date) {
+			delete(self.state.sessions, sessionId)
+			removed++
+		}
+	}
+	return
+}
@@ -0,0 +1,1317 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// storeMysql keeps the users in MySQL or MariaDB. The data source must set
+// parseTime=true, so that DATETIME columns scan into time.Time.
+type storeMysql struct {
+	db  *sql.DB
+	tx  *sql.Tx
+	ctx context.Context
+}
+
+func NewStoreMysql(db *sql.DB) storeMysql {
+	return storeMysql{db, nil, context.Background()}
+}
+
+// The tenants and keys are compared byte by byte (utf8mb4_bin), as in
+// Postgres and SQLite: the default collations of MySQL ignore case and
+// accents. The emails ignore case from version 7 on, as in the other
+// stores, and names sort with utf8mb4_unicode_ci. From version 11 on, the
+// emails are unique by emailKey, their LOWER(email), as utf8mb4_unicode_ci
+// also ignored accents.
+var mysqlMigrations = migrations{
+	versionTable: "auth_schema_migration",
+	createVersionTable: `
+		CREATE TABLE IF NOT EXISTS auth_schema_migration (
+		   version   INTEGER NOT NULL,
+		   appliedAt DATETIME(6) NOT NULL,
+
+		   CONSTRAINT pk_auth_schema_migration PRIMARY KEY (version)
+		) ENGINE = InnoDB;
+	`,
+	hasBaseline:     `SELECT COUNT(*) > 0 FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'auth_user'`,
+	questionMarks:   true,
+	splitStatements: true,
+	// GET_LOCK gives up after an hour, and selects 0.
+	lock:   `SELECT GET_LOCK('auth_schema_migration', 3600)`,
+	unlock: `SELECT RELEASE_LOCK('auth_schema_migration')`,
+	steps: []migration{
+		{
+			version: 1,
+			up: `
+				CREATE TABLE auth_user (
+				   id              CHAR(36) CHARACTER SET ascii NOT NULL,
+				   createdAt       DATETIME(6) NOT NULL,
+				   email           VARCHAR(255) COLLATE utf8mb4_bin NOT NULL,
+				   hashedPass      VARCHAR(255) COLLATE utf8mb4_bin NOT NULL,
+				   lang            CHAR(5) CHARACTER SET ascii NOT NULL,
+				   confirmationKey CHAR(36) CHARACTER SET ascii NOT NULL,
+				   confirmedAt     DATETIME(6),
+				   resetKey        CHAR(36) CHARACTER SET ascii,
+
+				   CONSTRAINT pk_auth_user PRIMARY KEY (id)
+				) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth_user (email);
+			`,
+			down: `
+				DROP TABLE auth_user;
+			`,
+		},
+		{
+			version: 2,
+			// TEXT columns cannot have a default on every MySQL and MariaDB
+			// version, so CreateUser sets the profiles.
+			up: `
+				ALTER TABLE auth_user ADD COLUMN userProfile MEDIUMTEXT NOT NULL, ADD COLUMN adminProfile MEDIUMTEXT NOT NULL;
+				UPDATE auth_user SET userProfile = '{}', adminProfile = '{}';
+			`,
+			down: `
+				ALTER TABLE auth_user DROP COLUMN userProfile, DROP COLUMN adminProfile;
+			`,
+		},
+		{
+			version: 3,
+			up: `
+				ALTER TABLE auth_user ADD COLUMN tenant VARCHAR(191) COLLATE utf8mb4_bin NOT NULL DEFAULT '';
+				DROP INDEX idx_auth_user_email ON auth_user;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth_user (tenant, email);
+
+				CREATE TABLE auth_organization (
+				   id        CHAR(36) CHARACTER SET ascii NOT NULL,
+				   createdAt DATETIME(6) NOT NULL,
+				   tenant    VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,
+				   name      VARCHAR(255) NOT NULL,
+
+				   CONSTRAINT pk_auth_organization PRIMARY KEY (id)
+				) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+				CREATE TABLE auth_member (
+				   organizationId CHAR(36) CHARACTER SET ascii NOT NULL,
+				   userId         CHAR(36) CHARACTER SET ascii NOT NULL,
+				   role           VARCHAR(255) COLLATE utf8mb4_bin NOT NULL,
+				   createdAt      DATETIME(6) NOT NULL,
+
+				   CONSTRAINT pk_auth_member PRIMARY KEY (organizationId, userId),
+				   CONSTRAINT fk_auth_member_organization FOREIGN KEY (organizationId) REFERENCES auth_organization (id) ON DELETE CASCADE,
+				   CONSTRAINT fk_auth_member_user FOREIGN KEY (userId) REFERENCES auth_user (id) ON DELETE CASCADE
+				) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+				CREATE INDEX idx_auth_member_userId ON auth_member (userId);
+			`,
+			down: `
+				DROP TABLE auth_member;
+				DROP TABLE auth_organization;
+
+				DROP INDEX idx_auth_user_email ON auth_user;
+				ALTER TABLE auth_user DROP COLUMN tenant;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth_user (email);
+			`,
+		},
+		{
+			version: 4,
+			up: `
+				CREATE TABLE auth_impersonation (
+				   id        CHAR(36) CHARACTER SET ascii NOT NULL,
+				   createdAt DATETIME(6) NOT NULL,
+				   tenant    VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,
+				   userId    CHAR(36) CHARACTER SET ascii NOT NULL,
+				   reason    TEXT NOT NULL,
+
+				   CONSTRAINT pk_auth_impersonation PRIMARY KEY (id)
+				) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+			`,
+			down: `
+				DROP TABLE auth_impersonation;
+			`,
+		},
+		{
+			version: 5,
+			up: `
+				ALTER TABLE auth_user ADD COLUMN resetKeyCreatedAt DATETIME(6);
+
+				CREATE TABLE auth_session (
+				   id        CHAR(36) CHARACTER SET ascii NOT NULL,
+				   createdAt DATETIME(6) NOT NULL,
+				   userId    CHAR(36) CHARACTER SET ascii NOT NULL,
+
+				   CONSTRAINT pk_auth_session PRIMARY KEY (id),
+				   CONSTRAINT fk_auth_session_user FOREIGN KEY (userId) REFERENCES auth_user (id) ON DELETE CASCADE
+				) ENGINE = InnoDB;
+
+				CREATE TABLE auth_job_lock (
+				   tenant      VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,
+				   job         VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,
+				   owner       VARCHAR(255) NOT NULL,
+				   lockedUntil DATETIME(6) NOT NULL,
+
+				   CONSTRAINT pk_auth_job_lock PRIMARY KEY (tenant, job)
+				) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+				CREATE TABLE auth_job_run (
+				   id         CHAR(36) CHARACTER SET ascii NOT NULL,
+				   tenant     VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,
+				   job        VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,
+				   owner      VARCHAR(255) NOT NULL,
+				   startedAt  DATETIME(6) NOT NULL,
+				   finishedAt DATETIME(6) NOT NULL,
+				   affected   BIGINT NOT NULL,
+				   error      TEXT NOT NULL,
+
+				   CONSTRAINT pk_auth_job_run PRIMARY KEY (id)
+				) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+				CREATE INDEX idx_auth_job_run_startedAt ON auth_job_run (tenant, startedAt);
+			`,
+			down: `
+				DROP TABLE auth_job_run;
+				DROP TABLE auth_job_lock;
+				DROP TABLE auth_session;
+				ALTER TABLE auth_user DROP COLUMN resetKeyCreatedAt;
+			`,
+		},
+		{
+			version: 6,
+			up: `
+				ALTER TABLE auth_user ADD COLUMN removalWarnedAt DATETIME(6);
+			`,
+			down: `
+				ALTER TABLE auth_user DROP COLUMN removalWarnedAt;
+			`,
+		},
+		{
+			version: 7,
+			conflicts: `
+				SELECT GROUP_CONCAT(email SEPARATOR ' = ') FROM auth_user
+				GROUP BY tenant, email COLLATE utf8mb4_unicode_ci
+				HAVING COUNT(*) > 1;
+			`,
+			up: `
+				ALTER TABLE auth_user MODIFY email VARCHAR(255) COLLATE utf8mb4_unicode_ci NOT NULL;
+			`,
+			down: `
+				ALTER TABLE auth_user MODIFY email VARCHAR(255) COLLATE utf8mb4_bin NOT NULL;
+			`,
+		},
+		{
+			version: 8,
+			up: `
+				ALTER TABLE auth_user ADD COLUMN approvedAt DATETIME(6);
+				UPDATE auth_user SET approvedAt = confirmedAt;
+			`,
+			down: `
+				ALTER TABLE auth_user DROP COLUMN approvedAt;
+			`,
+		},
+		{
+			version: 9,
+			up: `
+				CREATE TABLE auth_access_token (
+				   id          CHAR(36) CHARACTER SET ascii NOT NULL,
+				   createdAt   DATETIME(6) NOT NULL,
+				   userId      CHAR(36) CHARACTER SET ascii NOT NULL,
+				   name        VARCHAR(255) NOT NULL,
+				   hashedToken CHAR(64) CHARACTER SET ascii NOT NULL,
+				   scopes      TEXT NOT NULL,
+				   expiresAt   DATETIME(6),
+				   lastUsedAt  DATETIME(6),
+
+				   CONSTRAINT pk_auth_access_token PRIMARY KEY (id),
+				   CONSTRAINT fk_auth_access_token_user FOREIGN KEY (userId) REFERENCES auth_user (id) ON DELETE CASCADE
+				) ENGINE = InnoDB;
+
+				CREATE UNIQUE INDEX idx_auth_access_token_hashedToken ON auth_access_token (hashedToken);
+			`,
+			down: `
+				DROP TABLE auth_access_token;
+			`,
+		},
+		{
+			version: 10,
+			up: `
+				CREATE TABLE auth_service_account (
+				   id           CHAR(36) CHARACTER SET ascii NOT NULL,
+				   createdAt    DATETIME(6) NOT NULL,
+				   tenant       VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,
+				   name         VARCHAR(255) NOT NULL,
+				   hashedSecret CHAR(64) CHARACTER SET ascii NOT NULL,
+				   scopes       TEXT NOT NULL,
+				   disabledAt   DATETIME(6),
+
+				   CONSTRAINT pk_auth_service_account PRIMARY KEY (id)
+				) ENGINE = InnoDB;
+
+				CREATE INDEX idx_auth_service_account_tenant ON auth_service_account (tenant, createdAt);
+			`,
+			down: `
+				DROP TABLE auth_service_account;
+			`,
+		},
+		{
+			version: 11,
+			up: `
+				ALTER TABLE auth_user MODIFY email VARCHAR(255) COLLATE utf8mb4_bin NOT NULL;
+				ALTER TABLE auth_user ADD COLUMN emailKey VARCHAR(255) COLLATE utf8mb4_bin AS (LOWER(email)) STORED;
+				DROP INDEX idx_auth_user_email ON auth_user;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth_user (tenant, emailKey);
+			`,
+			down: `
+				DROP INDEX idx_auth_user_email ON auth_user;
+				ALTER TABLE auth_user DROP COLUMN emailKey;
+				ALTER TABLE auth_user MODIFY email VARCHAR(255) COLLATE utf8mb4_unicode_ci NOT NULL;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth_user (tenant, email);
+			`,
+		},
+		{
+			// Version 12 only changes the Postgres schema.
+			version: 12,
+		},
+		{
+			version: 13,
+			up: `
+				ALTER TABLE auth_user ADD COLUMN deletedAt DATETIME(6);
+			`,
+			down: `
+				DELETE FROM auth_user WHERE deletedAt IS NOT NULL;
+				ALTER TABLE auth_user DROP COLUMN deletedAt;
+			`,
+		},
+	},
+}
+
+func (self storeMysql) Migrate(version int) error {
+	return mysqlMigrations.migrate(self.db, version)
+}
+
+func (self storeMysql) SchemaVersion() (int, error) {
+	return mysqlMigrations.version(self.db)
+}
+
+func (self storeMysql) conn() sqlConn {
+	if self.tx != nil {
+		return self.tx
+	}
+	return self.db
+}
+
+func (self storeMysql) WithTx(fn func(tx Store) error) error {
+	if self.tx != nil {
+		return fn(self)
+	}
+	return withSqlTx(self.ctx, self.db, func(tx *sql.Tx) error {
+		return fn(storeMysql{self.db, tx, self.ctx})
+	})
+}
+
+func (self storeMysql) WithContext(ctx context.Context) Store {
+	self.ctx = ctx
+	return self
+}
+
+func (self storeMysql) LockUser(userId string) error {
+	query := `
+		SELECT id
+		FROM auth_user
+		WHERE id = ? AND deletedAt IS NULL
+		FOR UPDATE;
+	`
+	return self.conn().QueryRowContext(self.ctx, query, userId).Scan(&userId)
+}
+
+func (self storeMysql) LockOrganization(organizationId string) error {
+	query := `
+		SELECT id
+		FROM auth_organization
+		WHERE id = ?
+		FOR UPDATE;
+	`
+	return self.conn().QueryRowContext(self.ctx, query, organizationId).Scan(&organizationId)
+}
+
+func (self storeMysql) CreateUser(userId string, createdAt time.Time, tenant, email, hashedPass, lang, confirmationKey string) error {
+	insert := `
+		INSERT INTO auth_user
+		(id, createdAt, tenant, email, hashedPass, lang, confirmationKey, userProfile, adminProfile)
+		VALUES
+		(?, ?, ?, ?, ?, ?, ?, '{}', '{}');
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, userId, createdAt, tenant, email, hashedPass, lang, confirmationKey)
+	return err
+}
+
+func (self storeMysql) RemoveUsers(userIds ...string) error {
+	placeholders := make([]string, len(userIds))
+	arguments := make([]interface{}, len(userIds))
+	for i, argument := range userIds {
+		placeholders[i] = "?"
+		arguments[i] = argument
+	}
+
+	delete := fmt.Sprintf("DELETE FROM auth_user WHERE id IN (%s)", strings.Join(placeholders, ","))
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, arguments...)
+	return err
+}
+
+func (self storeMysql) DeleteUsers(deletedAt time.Time, userIds ...string) error {
+	placeholders := make([]string, len(userIds))
+	arguments := make([]interface{}, len(userIds)+1)
+	arguments[0] = deletedAt
+	for i, argument := range userIds {
+		placeholders[i] = "?"
+		arguments[i+1] = argument
+	}
+	in := strings.Join(placeholders, ",")
+
+	return self.WithTx(func(tx Store) error {
+		conn := tx.(storeMysql).conn()
+
+		update := fmt.Sprintf("UPDATE auth_user SET deletedAt = ? WHERE id IN (%s) AND deletedAt IS NULL", in)
+		if _, err := conn.ExecContext(self.ctx, update, arguments...); err != nil {
+			return err
+		}
+
+		for _, table := range []string{"auth_member", "auth_session", "auth_access_token"} {
+			delete := fmt.Sprintf("DELETE FROM %s WHERE userId IN (%s)", table, in)
+			if _, err := conn.ExecContext(self.ctx, delete, arguments[1:]...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (self storeMysql) SetUserConfirmedAt(userId string, confirmedAt time.Time) error {
+	update := `
+		UPDATE auth_user
+		SET confirmedAt = ?
+		WHERE id = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, confirmedAt, userId)
+	return err
+}
+
+func (self storeMysql) SetUserApprovedAt(userId string, approvedAt time.Time) error {
+	update := `
+		UPDATE auth_user
+		SET approvedAt = ?
+		WHERE id = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, approvedAt, userId)
+	return err
+}
+
+func (self storeMysql) SetUserResetKey(userId, resetKey string, resetKeyCreatedAt time.Time) error {
+	update := `
+		UPDATE auth_user
+		SET resetKey = ?, resetKeyCreatedAt = ?
+		WHERE id = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, resetKey, resetKeyCreatedAt, userId)
+	return err
+}
+
+func (self storeMysql) SetUserHashedPass(userId, hashedPass string) error {
+	update := `
+		UPDATE auth_user
+		SET hashedPass = ?, resetKey = NULL, resetKeyCreatedAt = NULL
+		WHERE id = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, hashedPass, userId)
+	return err
+}
+
+func (self storeMysql) SetUserEmail(userId, email string) error {
+	update := `
+		UPDATE auth_user
+		SET email = ?
+		WHERE id = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, email, userId)
+	return err
+}
+
+func (self storeMysql) GetUserId(tenant, email string) (userId string, err error) {
+	query := `
+		SELECT id
+		FROM auth_user
+		WHERE tenant = ? AND emailKey = LOWER(?) AND deletedAt IS NULL;
+	`
+	err = self.conn().QueryRowContext(self.ctx, query, tenant, email).Scan(&userId)
+	return
+}
+
+func (self storeMysql) GetUser(userId string) (user StoredUser, err error) {
+	user.Id = userId
+
+	query := `
+		SELECT createdAt, tenant, email, hashedPass, lang, confirmationKey, confirmedAt, resetKey, approvedAt
+		FROM auth_user
+		WHERE id = ? AND deletedAt IS NULL;
+	`
+
+	var scanConfirmedAt, scanApprovedAt pq.NullTime
+	var scanResetKey sql.NullString
+
+	err = self.conn().QueryRowContext(self.ctx, query, userId).Scan(
+		&user.CreatedAt,
+		&user.Tenant,
+		&user.Email,
+		&user.HashedPass,
+		&user.Lang,
+		&user.ConfirmationKey,
+		&scanConfirmedAt,
+		&scanResetKey,
+		&scanApprovedAt,
+	)
+
+	if scanConfirmedAt.Valid {
+		user.ConfirmedAt = scanConfirmedAt.Time
+	}
+	if scanResetKey.Valid {
+		user.ResetKey = scanResetKey.String
+	}
+	if scanApprovedAt.Valid {
+		user.ApprovedAt = scanApprovedAt.Time
+	}
+
+	return
+}
+
+func (self storeMysql) GetAllUsers(tenant string) (users []User, err error) {
+	query := `
+		SELECT id, createdAt, email, lang, confirmedAt
+		FROM auth_user
+		WHERE tenant = ? AND deletedAt IS NULL
+		ORDER BY createdAt;
+	`
+
+	var scanConfirmedAt pq.NullTime
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := User{}
+		err = rows.Scan(&user.Id, &user.CreatedAt, &user.Email, &user.Lang, &scanConfirmedAt)
+		if err != nil {
+			return
+		}
+		if scanConfirmedAt.Valid {
+			user.ConfirmedAt = scanConfirmedAt.Time
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storeMysql) GetProfile(userId string) (profile Profile, err error) {
+	query := `
+		SELECT userProfile, adminProfile
+		FROM auth_user
+		WHERE id = ?;
+	`
+
+	var scanUserProfile, scanAdminProfile []byte
+
+	err = self.conn().QueryRowContext(self.ctx, query, userId).Scan(&scanUserProfile, &scanAdminProfile)
+
+	profile.UserData = json.RawMessage(scanUserProfile)
+	profile.AdminData = json.RawMessage(scanAdminProfile)
+	return
+}
+
+func (self storeMysql) SetUserProfile(userId string, userData json.RawMessage) error {
+	update := `
+		UPDATE auth_user
+		SET userProfile = ?
+		WHERE id = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, string(userData), userId)
+	return err
+}
+
+func (self storeMysql) SetAdminProfile(userId string, adminData json.RawMessage) error {
+	update := `
+		UPDATE auth_user
+		SET adminProfile = ?
+		WHERE id = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, string(adminData), userId)
+	return err
+}
+
+func (self storeMysql) CreateOrganization(organizationId string, createdAt time.Time, tenant, name string) error {
+	insert := `
+		INSERT INTO auth_organization
+		(id, createdAt, tenant, name)
+		VALUES
+		(?, ?, ?, ?);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, organizationId, createdAt, tenant, name)
+	return err
+}
+
+func (self storeMysql) AddMember(organizationId, userId, role string, createdAt time.Time) error {
+	insert := `
+		INSERT INTO auth_member
+		(organizationId, userId, role, createdAt)
+		VALUES
+		(?, ?, ?, ?);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, organizationId, userId, role, createdAt)
+	return err
+}
+
+func (self storeMysql) SetMemberRole(organizationId, userId, role string) error {
+	update := `
+		UPDATE auth_member
+		SET role = ?
+		WHERE organizationId = ? AND userId = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, role, organizationId, userId)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil || updated == 1 {
+		return err
+	}
+
+	// MySQL counts the changed rows, so that setting the role a member
+	// already has affects none.
+	_, err = self.GetMemberRole(organizationId, userId)
+	return err
+}
+
+func (self storeMysql) RemoveMembers(organizationId string, userIds ...string) error {
+	placeholders := make([]string, len(userIds))
+	arguments := make([]interface{}, len(userIds)+1)
+	arguments[0] = organizationId
+	for i, argument := range userIds {
+		placeholders[i] = "?"
+		arguments[i+1] = argument
+	}
+
+	delete := fmt.Sprintf("DELETE FROM auth_member WHERE organizationId = ? AND userId IN (%s)", strings.Join(placeholders, ","))
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, arguments...)
+	return err
+}
+
+func (self storeMysql) GetMemberRole(organizationId, userId string) (role string, err error) {
+	query := `
+		SELECT role
+		FROM auth_member
+		WHERE organizationId = ? AND userId = ?;
+	`
+	err = self.conn().QueryRowContext(self.ctx, query, organizationId, userId).Scan(&role)
+	return
+}
+
+func (self storeMysql) GetMembers(organizationId string) (members []Member, err error) {
+	query := `
+		SELECT m.userId, u.email, m.role, m.createdAt
+		FROM auth_member m
+		JOIN auth_user u ON u.id = m.userId
+		WHERE m.organizationId = ?
+		ORDER BY m.createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, organizationId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		member := Member{}
+		err = rows.Scan(&member.UserId, &member.Email, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return
+		}
+		members = append(members, member)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storeMysql) GetMemberships(userId string) (memberships []Membership, err error) {
+	query := `
+		SELECT o.id, o.createdAt, o.name, m.role
+		FROM auth_member m
+		JOIN auth_organization o ON o.id = m.organizationId
+		WHERE m.userId = ?
+		ORDER BY o.name;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		membership := Membership{}
+		err = rows.Scan(
+			&membership.Organization.Id,
+			&membership.Organization.CreatedAt,
+			&membership.Organization.Name,
+			&membership.Role,
+		)
+		if err != nil {
+			return
+		}
+		memberships = append(memberships, membership)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storeMysql) CreateImpersonation(impersonationId string, createdAt time.Time, tenant, userId, reason string) error {
+	insert := `
+		INSERT INTO auth_impersonation
+		(id, createdAt, tenant, userId, reason)
+		VALUES
+		(?, ?, ?, ?, ?);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, impersonationId, createdAt, tenant, userId, reason)
+	return err
+}
+
+func (self storeMysql) GetImpersonations(tenant string) (impersonations []Impersonation, err error) {
+	query := `
+		SELECT id, createdAt, userId, reason
+		FROM auth_impersonation
+		WHERE tenant = ?
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		impersonation := Impersonation{}
+		err = rows.Scan(&impersonation.Id, &impersonation.CreatedAt, &impersonation.UserId, &impersonation.Reason)
+		if err != nil {
+			return
+		}
+		impersonations = append(impersonations, impersonation)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storeMysql) CreateSession(sessionId string, createdAt time.Time, userId string) error {
+	insert := `
+		INSERT INTO auth_session
+		(id, createdAt, userId)
+		VALUES
+		(?, ?, ?);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, sessionId, createdAt, userId)
+	return err
+}
+
+func (self storeMysql) GetSessionUserId(sessionId string) (userId string, err error) {
+	query := `
+		SELECT userId
+		FROM auth_session
+		WHERE id = ?;
+	`
+	err = self.conn().QueryRowContext(self.ctx, query, sessionId).Scan(&userId)
+	return
+}
+
+func (self storeMysql) RemoveSessions(sessionIds ...string) error {
+	placeholders := make([]string, len(sessionIds))
+	arguments := make([]interface{}, len(sessionIds))
+	for i, argument := range sessionIds {
+		placeholders[i] = "?"
+		arguments[i] = argument
+	}
+
+	delete := fmt.Sprintf("DELETE FROM auth_session WHERE id IN (%s)", strings.Join(placeholders, ","))
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, arguments...)
+	return err
+}
+
+func (self storeMysql) CreateAccessToken(userId, hashedToken string, accessToken AccessToken) error {
+	insert := `
+		INSERT INTO auth_access_token
+		(id, createdAt, userId, name, hashedToken, scopes, expiresAt)
+		VALUES
+		(?, ?, ?, ?, ?, ?, ?);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(
+		self.ctx,
+		accessToken.Id,
+		accessToken.CreatedAt,
+		userId,
+		accessToken.Name,
+		hashedToken,
+		joinScopes(accessToken.Scopes),
+		nullTime(accessToken.ExpiresAt),
+	)
+	return err
+}
+
+func (self storeMysql) GetAccessTokens(userId string) (accessTokens []AccessToken, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, expiresAt, lastUsedAt
+		FROM auth_access_token
+		WHERE userId = ?
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, userId)
+	if err != nil {
+		return
+	}
+
+	return scanAccessTokens(rows)
+}
+
+func (self storeMysql) GetAccessTokenByHash(hashedToken string) (accessToken AccessToken, userId string, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, expiresAt, lastUsedAt, userId
+		FROM auth_access_token
+		WHERE hashedToken = ?;
+	`
+	row := self.conn().QueryRowContext(self.ctx, query, hashedToken)
+	accessToken, err = scanAccessToken(row, &userId)
+	return
+}
+
+func (self storeMysql) SetAccessTokenLastUsedAt(accessTokenId string, lastUsedAt time.Time) error {
+	update := `
+		UPDATE auth_access_token
+		SET lastUsedAt = ?
+		WHERE id = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, lastUsedAt, accessTokenId)
+	return err
+}
+
+func (self storeMysql) RemoveAccessTokens(userId string, accessTokenIds ...string) error {
+	placeholders := make([]string, len(accessTokenIds))
+	arguments := make([]interface{}, len(accessTokenIds)+1)
+	arguments[0] = userId
+	for i, argument := range accessTokenIds {
+		placeholders[i] = "?"
+		arguments[i+1] = argument
+	}
+
+	delete := fmt.Sprintf("DELETE FROM auth_access_token WHERE userId = ? AND id IN (%s)", strings.Join(placeholders, ","))
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, arguments...)
+	return err
+}
+
+func (self storeMysql) CreateServiceAccount(tenant, hashedSecret string, serviceAccount ServiceAccount) error {
+	insert := `
+		INSERT INTO auth_service_account
+		(id, createdAt, tenant, name, hashedSecret, scopes)
+		VALUES
+		(?, ?, ?, ?, ?, ?);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(
+		self.ctx,
+		serviceAccount.Id,
+		serviceAccount.CreatedAt,
+		tenant,
+		serviceAccount.Name,
+		hashedSecret,
+		joinScopes(serviceAccount.Scopes),
+	)
+	return err
+}
+
+func (self storeMysql) GetServiceAccounts(tenant string) (serviceAccounts []ServiceAccount, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, disabledAt
+		FROM auth_service_account
+		WHERE tenant = ?
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
+	if err != nil {
+		return
+	}
+
+	return scanServiceAccounts(rows)
+}
+
+func (self storeMysql) GetServiceAccount(tenant, serviceAccountId string) (serviceAccount ServiceAccount, hashedSecret string, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, disabledAt, hashedSecret
+		FROM auth_service_account
+		WHERE tenant = ? AND id = ?;
+	`
+	row := self.conn().QueryRowContext(self.ctx, query, tenant, serviceAccountId)
+	serviceAccount, err = scanServiceAccount(row, &hashedSecret)
+	return
+}
+
+func (self storeMysql) SetServiceAccountHashedSecret(serviceAccountId, hashedSecret string) error {
+	update := `
+		UPDATE auth_service_account
+		SET hashedSecret = ?
+		WHERE id = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, hashedSecret, serviceAccountId)
+	return err
+}
+
+func (self storeMysql) SetServiceAccountDisabledAt(serviceAccountId string, disabledAt time.Time) error {
+	update := `
+		UPDATE auth_service_account
+		SET disabledAt = ?
+		WHERE id = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, nullTime(disabledAt), serviceAccountId)
+	return err
+}
+
+func (self storeMysql) AcquireJobLock(tenant, job, owner string, now, lockedUntil time.Time) (acquired bool, err error) {
+	update := `
+		UPDATE auth_job_lock
+		SET owner = ?, lockedUntil = ?
+		WHERE tenant = ? AND job = ? AND lockedUntil <= ?;
+	`
+
+	result, err := self.conn().ExecContext(self.ctx, update, owner, lockedUntil, tenant, job, now)
+	if err != nil {
+		return
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil || updated == 1 {
+		return updated == 1, err
+	}
+
+	// The update leaves an existing lock as it is, so that no row is
+	// affected.
+	insert := `
+		INSERT INTO auth_job_lock
+		(tenant, job, owner, lockedUntil)
+		VALUES
+		(?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE tenant = tenant;
+	`
+
+	result, err = self.conn().ExecContext(self.ctx, insert, tenant, job, owner, lockedUntil)
+	if err != nil {
+		return
+	}
+
+	inserted, err := result.RowsAffected()
+	return inserted == 1, err
+}
+
+func (self storeMysql) CreateJobRun(tenant string, jobRun JobRun) error {
+	insert := `
+		INSERT INTO auth_job_run
+		(id, tenant, job, owner, startedAt, finishedAt, affected, error)
+		VALUES
+		(?, ?, ?, ?, ?, ?, ?, ?);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(
+		self.ctx,
+		jobRun.Id,
+		tenant,
+		jobRun.Job,
+		jobRun.Owner,
+		jobRun.StartedAt,
+		jobRun.FinishedAt,
+		jobRun.Affected,
+		jobRun.Error,
+	)
+	return err
+}
+
+func (self storeMysql) GetJobRuns(tenant string, limit int) (jobRuns []JobRun, err error) {
+	query := `
+		SELECT id, job, owner, startedAt, finishedAt, affected, error
+		FROM auth_job_run
+		WHERE tenant = ?
+		ORDER BY startedAt DESC
+		LIMIT ?;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		jobRun := JobRun{}
+		err = rows.Scan(
+			&jobRun.Id,
+			&jobRun.Job,
+			&jobRun.Owner,
+			&jobRun.StartedAt,
+			&jobRun.FinishedAt,
+			&jobRun.Affected,
+			&jobRun.Error,
+		)
+		if err != nil {
+			return
+		}
+		jobRuns = append(jobRuns, jobRun)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storeMysql) GetUnapprovedUsers(tenant string) (users []User, err error) {
+	query := `
+		SELECT id, createdAt, email, lang, confirmedAt
+		FROM auth_user
+		WHERE tenant = ? AND confirmedAt IS NOT NULL AND approvedAt IS NULL AND deletedAt IS NULL
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
+	if err != nil {
+		return
+	}
+
+	return scanUsers(rows)
+}
+
+func (self storeMysql) GetUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []User, err error) {
+	query := `
+		SELECT id, createdAt, email, lang, confirmedAt
+		FROM auth_user
+		WHERE tenant = ? AND createdAt < ? AND confirmedAt IS NULL AND deletedAt IS NULL
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return scanUsers(rows)
+}
+
+func (self storeMysql) GetUnwarnedUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []StoredUser, err error) {
+	query := `
+		SELECT id, createdAt, email, lang, confirmationKey
+		FROM auth_user
+		WHERE tenant = ? AND createdAt < ? AND confirmedAt IS NULL AND removalWarnedAt IS NULL AND deletedAt IS NULL
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant, date)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := StoredUser{}
+		err = rows.Scan(&user.Id, &user.CreatedAt, &user.Email, &user.Lang, &user.ConfirmationKey)
+		if err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storeMysql) SetUserRemovalWarnedAt(userId string, removalWarnedAt time.Time) error {
+	update := `
+		UPDATE auth_user
+		SET removalWarnedAt = ?
+		WHERE id = ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, removalWarnedAt, userId)
+	return err
+}
+
+func (self storeMysql) RemoveUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (removedUsers []User, err error) {
+	// MySQL has no DELETE ... RETURNING, so the users are locked and read
+	// before they are removed.
+	err = self.WithTx(func(tx Store) error {
+		conn := tx.(storeMysql).conn()
+
+		query := `
+			SELECT id, createdAt, email, lang, confirmedAt
+			FROM auth_user
+			WHERE tenant = ? AND createdAt < ? AND confirmedAt IS NULL AND deletedAt IS NULL
+			ORDER BY createdAt
+			FOR UPDATE;
+		`
+
+		rows, err := conn.QueryContext(self.ctx, query, tenant, date)
+		if err != nil {
+			return err
+		}
+
+		removedUsers, err = scanUsers(rows)
+		if err != nil || len(removedUsers) == 0 {
+			return err
+		}
+
+		placeholders := make([]string, len(removedUsers))
+		arguments := make([]interface{}, len(removedUsers))
+		for i, user := range removedUsers {
+			placeholders[i] = "?"
+			arguments[i] = user.Id
+		}
+
+		delete := fmt.Sprintf("DELETE FROM auth_user WHERE id IN (%s)", strings.Join(placeholders, ","))
+		_, err = conn.ExecContext(self.ctx, delete, arguments...)
+		return err
+	})
+	if err != nil {
+		removedUsers = nil
+	}
+	return
+}
+
+func (self storeMysql) ClearResetKeysCreatedBefore(tenant string, date time.Time) (cleared int64, err error) {
+	update := `
+		UPDATE auth_user
+		SET resetKey = NULL, resetKeyCreatedAt = NULL
+		WHERE tenant = ? AND resetKeyCreatedAt < ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return result.RowsAffected()
+}
+
+func (self storeMysql) RemoveUsersDeletedBefore(tenant string, date time.Time) (removed int64, err error) {
+	delete := `
+		DELETE FROM auth_user
+		WHERE tenant = ? AND deletedAt < ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return result.RowsAffected()
+}
+
+func (self storeMysql) RemoveSessionsCreatedBefore(tenant string, date time.Time) (removed int64, err error) {
+	delete := `
+		DELETE FROM auth_session
+		WHERE userId IN (SELECT id FROM auth_user WHERE tenant = ?) AND createdAt < ?;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return result.RowsAffected()
+}
@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,57 +13,359 @@ import (
 )
 
 type storePg struct {
-	db *sql.DB
+	db  *sql.DB
+	tx  *sql.Tx
+	ctx context.Context
 }
 
 func NewStorePg(db *sql.DB) storePg {
-	return storePg{db}
+	return storePg{db, nil, context.Background()}
 }
 
-func (self storePg) createSchema() error {
-	schema := `
-		CREATE SCHEMA auth;
+var pgMigrations = migrations{
+	versionTable: "auth.schema_migration",
+	createVersionTable: `
+		CREATE SCHEMA IF NOT EXISTS auth;
 
-		CREATE TYPE auth.lang AS ENUM ('pt_PT', 'en_US');
+		CREATE TABLE IF NOT EXISTS auth.schema_migration (
+		   version   INTEGER NOT NULL,
+		   appliedAt TIMESTAMPTZ NOT NULL,
 
-		CREATE TABLE auth.user (
-		   id              CHAR(36) NOT NULL,
-		   createdAt       TIMESTAMPTZ NOT NULL,
-		   email           TEXT NOT NULL,
-		   hashedPass      TEXT NOT NULL,
-		   lang            auth.lang NOT NULL,
-		   confirmationKey CHAR(36) NOT NULL,
-		   confirmedAt     TIMESTAMPTZ,
-		   resetKey        CHAR(36),
-
-		   CONSTRAINT pk_auth_user PRIMARY KEY (id)
+		   CONSTRAINT pk_auth_schema_migration PRIMARY KEY (version)
 		);
+	`,
+	hasBaseline: `SELECT to_regclass('auth.user') IS NOT NULL`,
+	lock:        `SELECT 1 FROM (SELECT pg_advisory_lock(hashtext('auth.schema_migration'))) AS locked`,
+	unlock:      `SELECT pg_advisory_unlock(hashtext('auth.schema_migration'))`,
+	steps: []migration{
+		{
+			version: 1,
+			up: `
+				CREATE TYPE auth.lang AS ENUM ('pt_PT', 'en_US');
+
+				CREATE TABLE auth.user (
+				   id              CHAR(36) NOT NULL,
+				   createdAt       TIMESTAMPTZ NOT NULL,
+				   email           TEXT NOT NULL,
+				   hashedPass      TEXT NOT NULL,
+				   lang            auth.lang NOT NULL,
+				   confirmationKey CHAR(36) NOT NULL,
+				   confirmedAt     TIMESTAMPTZ,
+				   resetKey        CHAR(36),
+
+				   CONSTRAINT pk_auth_user PRIMARY KEY (id)
+				);
+
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth.user (email);
+			`,
+			down: `
+				DROP TABLE auth.user;
+				DROP TYPE auth.lang;
+			`,
+		},
+		{
+			version: 2,
+			up: `
+				ALTER TABLE auth.user ADD COLUMN userProfile JSONB NOT NULL DEFAULT '{}';
+				ALTER TABLE auth.user ADD COLUMN adminProfile JSONB NOT NULL DEFAULT '{}';
+			`,
+			down: `
+				ALTER TABLE auth.user DROP COLUMN userProfile;
+				ALTER TABLE auth.user DROP COLUMN adminProfile;
+			`,
+		},
+		{
+			version: 3,
+			up: `
+				ALTER TABLE auth.user ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+				DROP INDEX auth.idx_auth_user_email;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth.user (tenant, email);
+
+				CREATE TABLE auth.organization (
+				   id        CHAR(36) NOT NULL,
+				   createdAt TIMESTAMPTZ NOT NULL,
+				   tenant    TEXT NOT NULL,
+				   name      TEXT NOT NULL,
+
+				   CONSTRAINT pk_auth_organization PRIMARY KEY (id)
+				);
+
+				CREATE TABLE auth.member (
+				   organizationId CHAR(36) NOT NULL,
+				   userId         CHAR(36) NOT NULL,
+				   role           TEXT NOT NULL,
+				   createdAt      TIMESTAMPTZ NOT NULL,
+
+				   CONSTRAINT pk_auth_member PRIMARY KEY (organizationId, userId),
+				   CONSTRAINT fk_auth_member_organization FOREIGN KEY (organizationId) REFERENCES auth.organization (id) ON DELETE CASCADE,
+				   CONSTRAINT fk_auth_member_user FOREIGN KEY (userId) REFERENCES auth.user (id) ON DELETE CASCADE
+				);
+
+				CREATE INDEX idx_auth_member_userId ON auth.member (userId);
+			`,
+			down: `
+				DROP TABLE auth.member;
+				DROP TABLE auth.organization;
+
+				DROP INDEX auth.idx_auth_user_email;
+				ALTER TABLE auth.user DROP COLUMN tenant;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth.user (email);
+			`,
+		},
+		{
+			version: 4,
+			up: `
+				CREATE TABLE auth.impersonation (
+				   id        CHAR(36) NOT NULL,
+				   createdAt TIMESTAMPTZ NOT NULL,
+				   tenant    TEXT NOT NULL,
+				   userId    CHAR(36) NOT NULL,
+				   reason    TEXT NOT NULL,
+
+				   CONSTRAINT pk_auth_impersonation PRIMARY KEY (id)
+				);
+			`,
+			down: `
+				DROP TABLE auth.impersonation;
+			`,
+		},
+		{
+			version: 5,
+			up: `
+				ALTER TABLE auth.user ADD COLUMN resetKeyCreatedAt TIMESTAMPTZ;
+
+				CREATE TABLE auth.session (
+				   id        CHAR(36) NOT NULL,
+				   createdAt TIMESTAMPTZ NOT NULL,
+				   userId    CHAR(36) NOT NULL,
+
+				   CONSTRAINT pk_auth_session PRIMARY KEY (id),
+				   CONSTRAINT fk_auth_session_user FOREIGN KEY (userId) REFERENCES auth.user (id) ON DELETE CASCADE
+				);
+
+				CREATE TABLE auth.job_lock (
+				   tenant      TEXT NOT NULL,
+				   job         TEXT NOT NULL,
+				   owner       TEXT NOT NULL,
+				   lockedUntil TIMESTAMPTZ NOT NULL,
+
+				   CONSTRAINT pk_auth_job_lock PRIMARY KEY (tenant, job)
+				);
+
+				CREATE TABLE auth.job_run (
+				   id         CHAR(36) NOT NULL,
+				   tenant     TEXT NOT NULL,
+				   job        TEXT NOT NULL,
+				   owner      TEXT NOT NULL,
+				   startedAt  TIMESTAMPTZ NOT NULL,
+				   finishedAt TIMESTAMPTZ NOT NULL,
+				   affected   BIGINT NOT NULL,
+				   error      TEXT NOT NULL,
+
+				   CONSTRAINT pk_auth_job_run PRIMARY KEY (id)
+				);
+
+				CREATE INDEX idx_auth_job_run_startedAt ON auth.job_run (tenant, startedAt);
+			`,
+			down: `
+				DROP TABLE auth.job_run;
+				DROP TABLE auth.job_lock;
+				DROP TABLE auth.session;
+				ALTER TABLE auth.user DROP COLUMN resetKeyCreatedAt;
+			`,
+		},
+		{
+			version: 6,
+			up: `
+				ALTER TABLE auth.user ADD COLUMN removalWarnedAt TIMESTAMPTZ;
+			`,
+			down: `
+				ALTER TABLE auth.user DROP COLUMN removalWarnedAt;
+			`,
+		},
+		{
+			version: 7,
+			conflicts: `
+				SELECT string_agg(email, ' = ') FROM auth.user
+				GROUP BY tenant, lower(email)
+				HAVING COUNT(*) > 1;
+			`,
+			up: `
+				DROP INDEX auth.idx_auth_user_email;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth.user (tenant, lower(email));
+			`,
+			down: `
+				DROP INDEX auth.idx_auth_user_email;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth.user (tenant, email);
+			`,
+		},
+		{
+			version: 8,
+			up: `
+				ALTER TABLE auth.user ADD COLUMN approvedAt TIMESTAMPTZ;
+				UPDATE auth.user SET approvedAt = confirmedAt;
+			`,
+			down: `
+				ALTER TABLE auth.user DROP COLUMN approvedAt;
+			`,
+		},
+		{
+			version: 9,
+			up: `
+				CREATE TABLE auth.access_token (
+				   id          CHAR(36) NOT NULL,
+				   createdAt   TIMESTAMPTZ NOT NULL,
+				   userId      CHAR(36) NOT NULL,
+				   name        TEXT NOT NULL,
+				   hashedToken CHAR(64) NOT NULL,
+				   scopes      TEXT NOT NULL,
+				   expiresAt   TIMESTAMPTZ,
+				   lastUsedAt  TIMESTAMPTZ,
+
+				   CONSTRAINT pk_auth_access_token PRIMARY KEY (id),
+				   CONSTRAINT fk_auth_access_token_user FOREIGN KEY (userId) REFERENCES auth.user (id) ON DELETE CASCADE
+				);
+
+				CREATE UNIQUE INDEX idx_auth_access_token_hashedToken ON auth.access_token (hashedToken);
+				CREATE INDEX idx_auth_access_token_userId ON auth.access_token (userId);
+			`,
+			down: `
+				DROP TABLE auth.access_token;
+			`,
+		},
+		{
+			version: 10,
+			up: `
+				CREATE TABLE auth.service_account (
+				   id           CHAR(36) NOT NULL,
+				   createdAt    TIMESTAMPTZ NOT NULL,
+				   tenant       TEXT NOT NULL,
+				   name         TEXT NOT NULL,
+				   hashedSecret CHAR(64) NOT NULL,
+				   scopes       TEXT NOT NULL,
+				   disabledAt   TIMESTAMPTZ,
+
+				   CONSTRAINT pk_auth_service_account PRIMARY KEY (id)
+				);
+
+				CREATE INDEX idx_auth_service_account_tenant ON auth.service_account (tenant, createdAt);
+			`,
+			down: `
+				DROP TABLE auth.service_account;
+			`,
+		},
+		{
+			// Version 11 only changes the MySQL schema; the dialects keep
+			// the same versions.
+			version: 11,
+		},
+		{
+			// CHAR(36) pads the shorter ids and keys with blanks on the way
+			// back, so that "1" would come back as "1" and 35 blanks. The
+			// foreign keys are changed before the keys they reference.
+			version: 12,
+			up: `
+				ALTER TABLE auth.member ALTER COLUMN organizationId TYPE TEXT, ALTER COLUMN userId TYPE TEXT;
+				ALTER TABLE auth.session ALTER COLUMN id TYPE TEXT, ALTER COLUMN userId TYPE TEXT;
+				ALTER TABLE auth.access_token ALTER COLUMN id TYPE TEXT, ALTER COLUMN userId TYPE TEXT;
+				ALTER TABLE auth.impersonation ALTER COLUMN id TYPE TEXT, ALTER COLUMN userId TYPE TEXT;
+				ALTER TABLE auth.job_run ALTER COLUMN id TYPE TEXT;
+				ALTER TABLE auth.service_account ALTER COLUMN id TYPE TEXT;
+				ALTER TABLE auth.organization ALTER COLUMN id TYPE TEXT;
+				ALTER TABLE auth.user ALTER COLUMN id TYPE TEXT, ALTER COLUMN confirmationKey TYPE TEXT, ALTER COLUMN resetKey TYPE TEXT;
+			`,
+			down: `
+				ALTER TABLE auth.member ALTER COLUMN organizationId TYPE CHAR(36), ALTER COLUMN userId TYPE CHAR(36);
+				ALTER TABLE auth.session ALTER COLUMN id TYPE CHAR(36), ALTER COLUMN userId TYPE CHAR(36);
+				ALTER TABLE auth.access_token ALTER COLUMN id TYPE CHAR(36), ALTER COLUMN userId TYPE CHAR(36);
+				ALTER TABLE auth.impersonation ALTER COLUMN id TYPE CHAR(36), ALTER COLUMN userId TYPE CHAR(36);
+				ALTER TABLE auth.job_run ALTER COLUMN id TYPE CHAR(36);
+				ALTER TABLE auth.service_account ALTER COLUMN id TYPE CHAR(36);
+				ALTER TABLE auth.organization ALTER COLUMN id TYPE CHAR(36);
+				ALTER TABLE auth.user ALTER COLUMN id TYPE CHAR(36), ALTER COLUMN confirmationKey TYPE CHAR(36), ALTER COLUMN resetKey TYPE CHAR(36);
+			`,
+		},
+		{
+			version: 13,
+			up: `
+				ALTER TABLE auth.user ADD COLUMN deletedAt TIMESTAMPTZ;
+			`,
+			down: `
+				DELETE FROM auth.user WHERE deletedAt IS NOT NULL;
+				ALTER TABLE auth.user DROP COLUMN deletedAt;
+			`,
+		},
+	},
+}
+
+func (self storePg) Migrate(version int) error {
+	return pgMigrations.migrate(self.db, version)
+}
+
+func (self storePg) SchemaVersion() (int, error) {
+	return pgMigrations.version(self.db)
+}
+
+func (self storePg) conn() sqlConn {
+	if self.tx != nil {
+		return self.tx
+	}
+	return self.db
+}
+
+func (self storePg) WithTx(fn func(tx Store) error) error {
+	if self.tx != nil {
+		return fn(self)
+	}
+	return withSqlTx(self.ctx, self.db, func(tx *sql.Tx) error {
+		return fn(storePg{self.db, tx, self.ctx})
+	})
+}
+
+func (self storePg) WithContext(ctx context.Context) Store {
+	self.ctx = ctx
+	return self
+}
 
-		CREATE UNIQUE INDEX idx_auth_user_email ON auth.user (email);
+func (self storePg) LockUser(userId string) error {
+	query := `
+		SELECT id
+		FROM auth.user
+		WHERE id = $1 AND deletedAt IS NULL
+		FOR UPDATE;
 	`
+	return self.conn().QueryRowContext(self.ctx, query, userId).Scan(&userId)
+}
 
-	_, err := self.db.Exec(schema)
-	return err
+func (self storePg) LockOrganization(organizationId string) error {
+	query := `
+		SELECT id
+		FROM auth.organization
+		WHERE id = $1
+		FOR UPDATE;
+	`
+	return self.conn().QueryRowContext(self.ctx, query, organizationId).Scan(&organizationId)
 }
 
-func (self storePg) createUser(userId string, createdAt time.Time, email, hashedPass, lang, confirmationKey string) error {
+func (self storePg) CreateUser(userId string, createdAt time.Time, tenant, email, hashedPass, lang, confirmationKey string) error {
 	insert := `
 		INSERT INTO auth.user
-		(id, createdAt, email, hashedPass, lang, confirmationKey)
+		(id, createdAt, tenant, email, hashedPass, lang, confirmationKey)
 		VALUES
-		($1, $2, $3, $4, $5, $6);
+		($1, $2, $3, $4, $5, $6, $7);
 	`
 
-	stmt, err := self.db.Prepare(insert)
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(userId, createdAt, email, hashedPass, lang, confirmationKey)
+	_, err = stmt.ExecContext(self.ctx, userId, createdAt, tenant, email, hashedPass, lang, confirmationKey)
 	return err
 }
 
-func (self storePg) removeUsers(userIds ...string) error {
+func (self storePg) RemoveUsers(userIds ...string) error {
 	placeholders := make([]string, len(userIds))
 	arguments := make([]interface{}, len(userIds))
 	for i, argument := range userIds {
@@ -71,130 +375,192 @@ func (self storePg) removeUsers(userIds ...string) error {
 	}
 
 	delete := fmt.Sprintf("DELETE FROM auth.user WHERE id IN (%s)", strings.Join(placeholders, ","))
-	stmt, err := self.db.Prepare(delete)
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(arguments...)
+	_, err = stmt.ExecContext(self.ctx, arguments...)
 	return err
 }
 
-func (self storePg) setUserConfirmedAt(userId string, confirmedAt time.Time) error {
+func (self storePg) DeleteUsers(deletedAt time.Time, userIds ...string) error {
+	placeholders := make([]string, len(userIds))
+	arguments := make([]interface{}, len(userIds))
+	for i, argument := range userIds {
+		s := strconv.Itoa(i + 1)
+		placeholders[i] = strings.Join([]string{"$", s}, "")
+		arguments[i] = argument
+	}
+
+	return self.WithTx(func(tx Store) error {
+		conn := tx.(storePg).conn()
+
+		// The ids follow deletedAt in the update.
+
+		updatePlaceholders := make([]string, len(userIds))
+		for i := range userIds {
+			updatePlaceholders[i] = strings.Join([]string{"$", strconv.Itoa(i + 2)}, "")
+		}
+		update := fmt.Sprintf("UPDATE auth.user SET deletedAt = $1 WHERE id IN (%s) AND deletedAt IS NULL", strings.Join(updatePlaceholders, ","))
+		if _, err := conn.ExecContext(self.ctx, update, append([]interface{}{deletedAt}, arguments...)...); err != nil {
+			return err
+		}
+
+		for _, table := range []string{"auth.member", "auth.session", "auth.access_token"} {
+			delete := fmt.Sprintf("DELETE FROM %s WHERE userId IN (%s)", table, strings.Join(placeholders, ","))
+			if _, err := conn.ExecContext(self.ctx, delete, arguments...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (self storePg) SetUserConfirmedAt(userId string, confirmedAt time.Time) error {
 	update := `
 		UPDATE auth.user
 		SET confirmedAt = $1
 		WHERE id = $2;
 	`
 
-	stmt, err := self.db.Prepare(update)
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(confirmedAt, userId)
+	_, err = stmt.ExecContext(self.ctx, confirmedAt, userId)
 	return err
 }
 
-func (self storePg) setUserResetKey(userId, resetKey string) error {
+func (self storePg) SetUserApprovedAt(userId string, approvedAt time.Time) error {
 	update := `
 		UPDATE auth.user
-		SET resetKey = $1
+		SET approvedAt = $1
 		WHERE id = $2;
 	`
 
-	stmt, err := self.db.Prepare(update)
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(resetKey, userId)
+	_, err = stmt.ExecContext(self.ctx, approvedAt, userId)
 	return err
 }
 
-func (self storePg) setUserHashedPass(userId, hashedPass string) error {
+func (self storePg) SetUserResetKey(userId, resetKey string, resetKeyCreatedAt time.Time) error {
 	update := `
 		UPDATE auth.user
-		SET hashedPass = $1, resetKey = NULL
+		SET resetKey = $1, resetKeyCreatedAt = $2
+		WHERE id = $3;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, resetKey, resetKeyCreatedAt, userId)
+	return err
+}
+
+func (self storePg) SetUserHashedPass(userId, hashedPass string) error {
+	update := `
+		UPDATE auth.user
+		SET hashedPass = $1, resetKey = NULL, resetKeyCreatedAt = NULL
 		WHERE id = $2;
 	`
 
-	stmt, err := self.db.Prepare(update)
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(hashedPass, userId)
+	_, err = stmt.ExecContext(self.ctx, hashedPass, userId)
 	return err
 }
 
-func (self storePg) setUserEmail(userId, email string) error {
+func (self storePg) SetUserEmail(userId, email string) error {
 	update := `
 		UPDATE auth.user
 		SET email = $1
 		WHERE id = $2;
 	`
 
-	stmt, err := self.db.Prepare(update)
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(email, userId)
+	_, err = stmt.ExecContext(self.ctx, email, userId)
 	return err
 }
 
-func (self storePg) getUserId(email string) (userId string, err error) {
+func (self storePg) GetUserId(tenant, email string) (userId string, err error) {
 	query := `
 		SELECT id
 		FROM auth.user
-		WHERE email = $1;
+		WHERE tenant = $1 AND lower(email) = lower($2) AND deletedAt IS NULL;
 	`
-	err = self.db.QueryRow(query, email).Scan(&userId)
+	err = self.conn().QueryRowContext(self.ctx, query, tenant, email).Scan(&userId)
 	return
 }
 
-func (self storePg) getPrivateUser(userId string) (user privateUser, err error) {
-	user.id = userId
+func (self storePg) GetUser(userId string) (user StoredUser, err error) {
+	user.Id = userId
 
 	query := `
-		SELECT createdAt, email, hashedPass, lang, confirmationKey, confirmedAt, resetKey
+		SELECT createdAt, tenant, email, hashedPass, lang, confirmationKey, confirmedAt, resetKey, approvedAt
 		FROM auth.user
-		WHERE id = $1;
+		WHERE id = $1 AND deletedAt IS NULL;
 	`
 
-	var scanConfirmedAt pq.NullTime
+	var scanConfirmedAt, scanApprovedAt pq.NullTime
 	var scanResetKey sql.NullString
 
-	err = self.db.QueryRow(query, userId).Scan(
-		&user.createdAt,
-		&user.email,
-		&user.hashedPass,
-		&user.lang,
-		&user.confirmationKey,
+	err = self.conn().QueryRowContext(self.ctx, query, userId).Scan(
+		&user.CreatedAt,
+		&user.Tenant,
+		&user.Email,
+		&user.HashedPass,
+		&user.Lang,
+		&user.ConfirmationKey,
 		&scanConfirmedAt,
 		&scanResetKey,
+		&scanApprovedAt,
 	)
 
 	if scanConfirmedAt.Valid {
-		user.confirmedAt = scanConfirmedAt.Time
+		user.ConfirmedAt = scanConfirmedAt.Time
 	}
 	if scanResetKey.Valid {
-		user.resetKey = scanResetKey.String
+		user.ResetKey = scanResetKey.String
+	}
+	if scanApprovedAt.Valid {
+		user.ApprovedAt = scanApprovedAt.Time
 	}
 
 	return
 }
 
-func (self storePg) getAllUsers() (users []User, err error) {
+func (self storePg) GetAllUsers(tenant string) (users []User, err error) {
 	query := `
 		SELECT id, createdAt, email, lang, confirmedAt
-		FROM auth.user;
+		FROM auth.user
+		WHERE tenant = $1 AND deletedAt IS NULL
+		ORDER BY createdAt;
 	`
 
 	var scanConfirmedAt pq.NullTime
 
-	rows, err := self.db.Query(query)
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
 	if err != nil {
 		return
 	}
@@ -215,12 +581,721 @@ func (self storePg) getAllUsers() (users []User, err error) {
 	return
 }
 
-func (self storePg) removeUnconfirmedUsersCreatedBefore(date time.Time) error {
-	stmt, err := self.db.Prepare("DELETE FROM auth.user WHERE createdAt < $1;")
+func (self storePg) GetProfile(userId string) (profile Profile, err error) {
+	query := `
+		SELECT userProfile, adminProfile
+		FROM auth.user
+		WHERE id = $1;
+	`
+
+	var scanUserProfile, scanAdminProfile []byte
+
+	err = self.conn().QueryRowContext(self.ctx, query, userId).Scan(&scanUserProfile, &scanAdminProfile)
+
+	profile.UserData = json.RawMessage(scanUserProfile)
+	profile.AdminData = json.RawMessage(scanAdminProfile)
+	return
+}
+
+func (self storePg) SetUserProfile(userId string, userData json.RawMessage) error {
+	update := `
+		UPDATE auth.user
+		SET userProfile = $1::jsonb
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(date)
+	_, err = stmt.ExecContext(self.ctx, string(userData), userId)
 	return err
 }
+
+func (self storePg) SetAdminProfile(userId string, adminData json.RawMessage) error {
+	update := `
+		UPDATE auth.user
+		SET adminProfile = $1::jsonb
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, string(adminData), userId)
+	return err
+}
+
+func (self storePg) CreateOrganization(organizationId string, createdAt time.Time, tenant, name string) error {
+	insert := `
+		INSERT INTO auth.organization
+		(id, createdAt, tenant, name)
+		VALUES
+		($1, $2, $3, $4);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, organizationId, createdAt, tenant, name)
+	return err
+}
+
+func (self storePg) AddMember(organizationId, userId, role string, createdAt time.Time) error {
+	insert := `
+		INSERT INTO auth.member
+		(organizationId, userId, role, createdAt)
+		VALUES
+		($1, $2, $3, $4);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, organizationId, userId, role, createdAt)
+	return err
+}
+
+func (self storePg) SetMemberRole(organizationId, userId, role string) error {
+	update := `
+		UPDATE auth.member
+		SET role = $1
+		WHERE organizationId = $2 AND userId = $3;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, role, organizationId, userId)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err == nil && updated == 0 {
+		err = sql.ErrNoRows
+	}
+	return err
+}
+
+func (self storePg) RemoveMembers(organizationId string, userIds ...string) error {
+	placeholders := make([]string, len(userIds))
+	arguments := make([]interface{}, len(userIds)+1)
+	arguments[0] = organizationId
+	for i, argument := range userIds {
+		s := strconv.Itoa(i + 2)
+		placeholders[i] = strings.Join([]string{"$", s}, "")
+		arguments[i+1] = argument
+	}
+
+	delete := fmt.Sprintf("DELETE FROM auth.member WHERE organizationId = $1 AND userId IN (%s)", strings.Join(placeholders, ","))
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, arguments...)
+	return err
+}
+
+func (self storePg) GetMemberRole(organizationId, userId string) (role string, err error) {
+	query := `
+		SELECT role
+		FROM auth.member
+		WHERE organizationId = $1 AND userId = $2;
+	`
+	err = self.conn().QueryRowContext(self.ctx, query, organizationId, userId).Scan(&role)
+	return
+}
+
+func (self storePg) GetMembers(organizationId string) (members []Member, err error) {
+	query := `
+		SELECT m.userId, u.email, m.role, m.createdAt
+		FROM auth.member m
+		JOIN auth.user u ON u.id = m.userId
+		WHERE m.organizationId = $1
+		ORDER BY m.createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, organizationId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		member := Member{}
+		err = rows.Scan(&member.UserId, &member.Email, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return
+		}
+		members = append(members, member)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storePg) GetMemberships(userId string) (memberships []Membership, err error) {
+	query := `
+		SELECT o.id, o.createdAt, o.name, m.role
+		FROM auth.member m
+		JOIN auth.organization o ON o.id = m.organizationId
+		WHERE m.userId = $1
+		ORDER BY o.name;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		membership := Membership{}
+		err = rows.Scan(
+			&membership.Organization.Id,
+			&membership.Organization.CreatedAt,
+			&membership.Organization.Name,
+			&membership.Role,
+		)
+		if err != nil {
+			return
+		}
+		memberships = append(memberships, membership)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storePg) CreateImpersonation(impersonationId string, createdAt time.Time, tenant, userId, reason string) error {
+	insert := `
+		INSERT INTO auth.impersonation
+		(id, createdAt, tenant, userId, reason)
+		VALUES
+		($1, $2, $3, $4, $5);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, impersonationId, createdAt, tenant, userId, reason)
+	return err
+}
+
+func (self storePg) GetImpersonations(tenant string) (impersonations []Impersonation, err error) {
+	query := `
+		SELECT id, createdAt, userId, reason
+		FROM auth.impersonation
+		WHERE tenant = $1
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		impersonation := Impersonation{}
+		err = rows.Scan(&impersonation.Id, &impersonation.CreatedAt, &impersonation.UserId, &impersonation.Reason)
+		if err != nil {
+			return
+		}
+		impersonations = append(impersonations, impersonation)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storePg) CreateSession(sessionId string, createdAt time.Time, userId string) error {
+	insert := `
+		INSERT INTO auth.session
+		(id, createdAt, userId)
+		VALUES
+		($1, $2, $3);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, sessionId, createdAt, userId)
+	return err
+}
+
+func (self storePg) GetSessionUserId(sessionId string) (userId string, err error) {
+	query := `
+		SELECT userId
+		FROM auth.session
+		WHERE id = $1;
+	`
+	err = self.conn().QueryRowContext(self.ctx, query, sessionId).Scan(&userId)
+	return
+}
+
+func (self storePg) RemoveSessions(sessionIds ...string) error {
+	placeholders := make([]string, len(sessionIds))
+	arguments := make([]interface{}, len(sessionIds))
+	for i, argument := range sessionIds {
+		s := strconv.Itoa(i + 1)
+		placeholders[i] = strings.Join([]string{"$", s}, "")
+		arguments[i] = argument
+	}
+
+	delete := fmt.Sprintf("DELETE FROM auth.session WHERE id IN (%s)", strings.Join(placeholders, ","))
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, arguments...)
+	return err
+}
+
+func (self storePg) CreateAccessToken(userId, hashedToken string, accessToken AccessToken) error {
+	insert := `
+		INSERT INTO auth.access_token
+		(id, createdAt, userId, name, hashedToken, scopes, expiresAt)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(
+		self.ctx,
+		accessToken.Id,
+		accessToken.CreatedAt,
+		userId,
+		accessToken.Name,
+		hashedToken,
+		joinScopes(accessToken.Scopes),
+		nullTime(accessToken.ExpiresAt),
+	)
+	return err
+}
+
+func (self storePg) GetAccessTokens(userId string) (accessTokens []AccessToken, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, expiresAt, lastUsedAt
+		FROM auth.access_token
+		WHERE userId = $1
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, userId)
+	if err != nil {
+		return
+	}
+
+	return scanAccessTokens(rows)
+}
+
+func (self storePg) GetAccessTokenByHash(hashedToken string) (accessToken AccessToken, userId string, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, expiresAt, lastUsedAt, userId
+		FROM auth.access_token
+		WHERE hashedToken = $1;
+	`
+	row := self.conn().QueryRowContext(self.ctx, query, hashedToken)
+	accessToken, err = scanAccessToken(row, &userId)
+	return
+}
+
+func (self storePg) SetAccessTokenLastUsedAt(accessTokenId string, lastUsedAt time.Time) error {
+	update := `
+		UPDATE auth.access_token
+		SET lastUsedAt = $1
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, lastUsedAt, accessTokenId)
+	return err
+}
+
+func (self storePg) RemoveAccessTokens(userId string, accessTokenIds ...string) error {
+	placeholders := make([]string, len(accessTokenIds))
+	arguments := make([]interface{}, len(accessTokenIds)+1)
+	arguments[0] = userId
+	for i, argument := range accessTokenIds {
+		s := strconv.Itoa(i + 2)
+		placeholders[i] = strings.Join([]string{"$", s}, "")
+		arguments[i+1] = argument
+	}
+
+	delete := fmt.Sprintf("DELETE FROM auth.access_token WHERE userId = $1 AND id IN (%s)", strings.Join(placeholders, ","))
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, arguments...)
+	return err
+}
+
+func (self storePg) CreateServiceAccount(tenant, hashedSecret string, serviceAccount ServiceAccount) error {
+	insert := `
+		INSERT INTO auth.service_account
+		(id, createdAt, tenant, name, hashedSecret, scopes)
+		VALUES
+		($1, $2, $3, $4, $5, $6);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(
+		self.ctx,
+		serviceAccount.Id,
+		serviceAccount.CreatedAt,
+		tenant,
+		serviceAccount.Name,
+		hashedSecret,
+		joinScopes(serviceAccount.Scopes),
+	)
+	return err
+}
+
+func (self storePg) GetServiceAccounts(tenant string) (serviceAccounts []ServiceAccount, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, disabledAt
+		FROM auth.service_account
+		WHERE tenant = $1
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
+	if err != nil {
+		return
+	}
+
+	return scanServiceAccounts(rows)
+}
+
+func (self storePg) GetServiceAccount(tenant, serviceAccountId string) (serviceAccount ServiceAccount, hashedSecret string, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, disabledAt, hashedSecret
+		FROM auth.service_account
+		WHERE tenant = $1 AND id = $2;
+	`
+	row := self.conn().QueryRowContext(self.ctx, query, tenant, serviceAccountId)
+	serviceAccount, err = scanServiceAccount(row, &hashedSecret)
+	return
+}
+
+func (self storePg) SetServiceAccountHashedSecret(serviceAccountId, hashedSecret string) error {
+	update := `
+		UPDATE auth.service_account
+		SET hashedSecret = $1
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, hashedSecret, serviceAccountId)
+	return err
+}
+
+func (self storePg) SetServiceAccountDisabledAt(serviceAccountId string, disabledAt time.Time) error {
+	update := `
+		UPDATE auth.service_account
+		SET disabledAt = $1
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, nullTime(disabledAt), serviceAccountId)
+	return err
+}
+
+func (self storePg) AcquireJobLock(tenant, job, owner string, now, lockedUntil time.Time) (acquired bool, err error) {
+	update := `
+		UPDATE auth.job_lock
+		SET owner = $1, lockedUntil = $2
+		WHERE tenant = $3 AND job = $4 AND lockedUntil <= $5;
+	`
+
+	result, err := self.conn().ExecContext(self.ctx, update, owner, lockedUntil, tenant, job, now)
+	if err != nil {
+		return
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil || updated == 1 {
+		return updated == 1, err
+	}
+
+	insert := `
+		INSERT INTO auth.job_lock
+		(tenant, job, owner, lockedUntil)
+		SELECT $1::TEXT, $2::TEXT, $3::TEXT, $4::TIMESTAMPTZ
+		WHERE NOT EXISTS (SELECT 1 FROM auth.job_lock WHERE tenant = $1 AND job = $2);
+	`
+
+	result, err = self.conn().ExecContext(self.ctx, insert, tenant, job, owner, lockedUntil)
+	if err != nil {
+		return
+	}
+
+	inserted, err := result.RowsAffected()
+	return inserted == 1, err
+}
+
+func (self storePg) CreateJobRun(tenant string, jobRun JobRun) error {
+	insert := `
+		INSERT INTO auth.job_run
+		(id, tenant, job, owner, startedAt, finishedAt, affected, error)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(
+		self.ctx,
+		jobRun.Id,
+		tenant,
+		jobRun.Job,
+		jobRun.Owner,
+		jobRun.StartedAt,
+		jobRun.FinishedAt,
+		jobRun.Affected,
+		jobRun.Error,
+	)
+	return err
+}
+
+func (self storePg) GetJobRuns(tenant string, limit int) (jobRuns []JobRun, err error) {
+	query := `
+		SELECT id, job, owner, startedAt, finishedAt, affected, error
+		FROM auth.job_run
+		WHERE tenant = $1
+		ORDER BY startedAt DESC
+		LIMIT $2;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		jobRun := JobRun{}
+		err = rows.Scan(
+			&jobRun.Id,
+			&jobRun.Job,
+			&jobRun.Owner,
+			&jobRun.StartedAt,
+			&jobRun.FinishedAt,
+			&jobRun.Affected,
+			&jobRun.Error,
+		)
+		if err != nil {
+			return
+		}
+		jobRuns = append(jobRuns, jobRun)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storePg) GetUnapprovedUsers(tenant string) (users []User, err error) {
+	query := `
+		SELECT id, createdAt, email, lang, confirmedAt
+		FROM auth.user
+		WHERE tenant = $1 AND confirmedAt IS NOT NULL AND approvedAt IS NULL AND deletedAt IS NULL
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
+	if err != nil {
+		return
+	}
+
+	return scanUsers(rows)
+}
+
+func (self storePg) GetUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []User, err error) {
+	query := `
+		SELECT id, createdAt, email, lang, confirmedAt
+		FROM auth.user
+		WHERE tenant = $1 AND createdAt < $2 AND confirmedAt IS NULL AND deletedAt IS NULL
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return scanUsers(rows)
+}
+
+func (self storePg) GetUnwarnedUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []StoredUser, err error) {
+	query := `
+		SELECT id, createdAt, email, lang, confirmationKey
+		FROM auth.user
+		WHERE tenant = $1 AND createdAt < $2 AND confirmedAt IS NULL AND removalWarnedAt IS NULL AND deletedAt IS NULL
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant, date)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := StoredUser{}
+		err = rows.Scan(&user.Id, &user.CreatedAt, &user.Email, &user.Lang, &user.ConfirmationKey)
+		if err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storePg) SetUserRemovalWarnedAt(userId string, removalWarnedAt time.Time) error {
+	update := `
+		UPDATE auth.user
+		SET removalWarnedAt = $1
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, removalWarnedAt, userId)
+	return err
+}
+
+func (self storePg) RemoveUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (removedUsers []User, err error) {
+	delete := `
+		DELETE FROM auth.user
+		WHERE tenant = $1 AND createdAt < $2 AND confirmedAt IS NULL AND deletedAt IS NULL
+		RETURNING id, createdAt, email, lang, confirmedAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, delete, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return scanUsers(rows)
+}
+
+func (self storePg) ClearResetKeysCreatedBefore(tenant string, date time.Time) (cleared int64, err error) {
+	update := `
+		UPDATE auth.user
+		SET resetKey = NULL, resetKeyCreatedAt = NULL
+		WHERE tenant = $1 AND resetKeyCreatedAt < $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return result.RowsAffected()
+}
+
+func (self storePg) RemoveUsersDeletedBefore(tenant string, date time.Time) (removed int64, err error) {
+	delete := `
+		DELETE FROM auth.user
+		WHERE tenant = $1 AND deletedAt < $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return result.RowsAffected()
+}
+
+func (self storePg) RemoveSessionsCreatedBefore(tenant string, date time.Time) (removed int64, err error) {
+	delete := `
+		DELETE FROM auth.session
+		WHERE createdAt < $2 AND userId IN (SELECT id FROM auth.user WHERE tenant = $1);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return result.RowsAffected()
+}
@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -12,53 +14,351 @@ import (
 )
 
 type storeSqlite struct {
-	db *sql.DB
+	db  *sql.DB
+	tx  *sql.Tx
+	ctx context.Context
 }
 
 func NewStoreSqlite(db *sql.DB) storeSqlite {
-	return storeSqlite{db}
-}
-
-func (self storeSqlite) createSchema() error {
-	schema := `
-		CREATE TABLE auth_user (
-		   id              CHAR(36) NOT NULL,
-		   createdAt       DATETIME NOT NULL,
-		   email           TEXT NOT NULL,
-		   hashedPass      TEXT NOT NULL,
-		   lang            CHAR(5) NOT NULL,
-		   confirmationKey CHAR(36) NOT NULL,
-		   confirmedAt     DATETIME,
-		   resetKey        CHAR(36),
-
-		   CONSTRAINT pk_auth_user PRIMARY KEY (id)
+	return storeSqlite{db, nil, context.Background()}
+}
+
+var sqliteMigrations = migrations{
+	versionTable: "auth_schema_migration",
+	createVersionTable: `
+		CREATE TABLE IF NOT EXISTS auth_schema_migration (
+		   version   INTEGER NOT NULL,
+		   appliedAt DATETIME NOT NULL,
+
+		   CONSTRAINT pk_auth_schema_migration PRIMARY KEY (version)
 		);
+	`,
+	hasBaseline: `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'auth_user'`,
+	steps: []migration{
+		{
+			version: 1,
+			up: `
+				CREATE TABLE auth_user (
+				   id              CHAR(36) NOT NULL,
+				   createdAt       DATETIME NOT NULL,
+				   email           TEXT NOT NULL,
+				   hashedPass      TEXT NOT NULL,
+				   lang            CHAR(5) NOT NULL,
+				   confirmationKey CHAR(36) NOT NULL,
+				   confirmedAt     DATETIME,
+				   resetKey        CHAR(36),
+
+				   CONSTRAINT pk_auth_user PRIMARY KEY (id)
+				);
+
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth_user (email);
+			`,
+			down: `
+				DROP TABLE auth_user;
+			`,
+		},
+		{
+			version: 2,
+			up: `
+				ALTER TABLE auth_user ADD COLUMN userProfile TEXT NOT NULL DEFAULT '{}';
+				ALTER TABLE auth_user ADD COLUMN adminProfile TEXT NOT NULL DEFAULT '{}';
+			`,
+			down: `
+				ALTER TABLE auth_user DROP COLUMN userProfile;
+				ALTER TABLE auth_user DROP COLUMN adminProfile;
+			`,
+		},
+		{
+			version: 3,
+			up: `
+				ALTER TABLE auth_user ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+				DROP INDEX idx_auth_user_email;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth_user (tenant, email);
+
+				CREATE TABLE auth_organization (
+				   id        CHAR(36) NOT NULL,
+				   createdAt DATETIME NOT NULL,
+				   tenant    TEXT NOT NULL,
+				   name      TEXT NOT NULL,
+
+				   CONSTRAINT pk_auth_organization PRIMARY KEY (id)
+				);
+
+				CREATE TABLE auth_member (
+				   organizationId CHAR(36) NOT NULL,
+				   userId         CHAR(36) NOT NULL,
+				   role           TEXT NOT NULL,
+				   createdAt      DATETIME NOT NULL,
+
+				   CONSTRAINT pk_auth_member PRIMARY KEY (organizationId, userId),
+				   CONSTRAINT fk_auth_member_organization FOREIGN KEY (organizationId) REFERENCES auth_organization (id) ON DELETE CASCADE,
+				   CONSTRAINT fk_auth_member_user FOREIGN KEY (userId) REFERENCES auth_user (id) ON DELETE CASCADE
+				);
+
+				CREATE INDEX idx_auth_member_userId ON auth_member (userId);
+			`,
+			down: `
+				DROP TABLE auth_member;
+				DROP TABLE auth_organization;
+
+				DROP INDEX idx_auth_user_email;
+				ALTER TABLE auth_user DROP COLUMN tenant;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth_user (email);
+			`,
+		},
+		{
+			version: 4,
+			up: `
+				CREATE TABLE auth_impersonation (
+				   id        CHAR(36) NOT NULL,
+				   createdAt DATETIME NOT NULL,
+				   tenant    TEXT NOT NULL,
+				   userId    CHAR(36) NOT NULL,
+				   reason    TEXT NOT NULL,
+
+				   CONSTRAINT pk_auth_impersonation PRIMARY KEY (id)
+				);
+			`,
+			down: `
+				DROP TABLE auth_impersonation;
+			`,
+		},
+		{
+			version: 5,
+			up: `
+				ALTER TABLE auth_user ADD COLUMN resetKeyCreatedAt DATETIME;
+
+				CREATE TABLE auth_session (
+				   id        CHAR(36) NOT NULL,
+				   createdAt DATETIME NOT NULL,
+				   userId    CHAR(36) NOT NULL,
+
+				   CONSTRAINT pk_auth_session PRIMARY KEY (id),
+				   CONSTRAINT fk_auth_session_user FOREIGN KEY (userId) REFERENCES auth_user (id) ON DELETE CASCADE
+				);
+
+				CREATE TABLE auth_job_lock (
+				   tenant      TEXT NOT NULL,
+				   job         TEXT NOT NULL,
+				   owner       TEXT NOT NULL,
+				   lockedUntil DATETIME NOT NULL,
+
+				   CONSTRAINT pk_auth_job_lock PRIMARY KEY (tenant, job)
+				);
+
+				CREATE TABLE auth_job_run (
+				   id         CHAR(36) NOT NULL,
+				   tenant     TEXT NOT NULL,
+				   job        TEXT NOT NULL,
+				   owner      TEXT NOT NULL,
+				   startedAt  DATETIME NOT NULL,
+				   finishedAt DATETIME NOT NULL,
+				   affected   BIGINT NOT NULL,
+				   error      TEXT NOT NULL,
+
+				   CONSTRAINT pk_auth_job_run PRIMARY KEY (id)
+				);
+
+				CREATE INDEX idx_auth_job_run_startedAt ON auth_job_run (tenant, startedAt);
+			`,
+			down: `
+				DROP TABLE auth_job_run;
+				DROP TABLE auth_job_lock;
+				DROP TABLE auth_session;
+				ALTER TABLE auth_user DROP COLUMN resetKeyCreatedAt;
+			`,
+		},
+		{
+			version: 6,
+			up: `
+				ALTER TABLE auth_user ADD COLUMN removalWarnedAt DATETIME;
+			`,
+			down: `
+				ALTER TABLE auth_user DROP COLUMN removalWarnedAt;
+			`,
+		},
+		{
+			version: 7,
+			conflicts: `
+				SELECT group_concat(email, ' = ') FROM auth_user
+				GROUP BY tenant, email COLLATE NOCASE
+				HAVING COUNT(*) > 1;
+			`,
+			up: `
+				DROP INDEX idx_auth_user_email;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth_user (tenant, email COLLATE NOCASE);
+			`,
+			down: `
+				DROP INDEX idx_auth_user_email;
+				CREATE UNIQUE INDEX idx_auth_user_email ON auth_user (tenant, email);
+			`,
+		},
+		{
+			version: 8,
+			up: `
+				ALTER TABLE auth_user ADD COLUMN approvedAt DATETIME;
+				UPDATE auth_user SET approvedAt = confirmedAt;
+			`,
+			down: `
+				ALTER TABLE auth_user DROP COLUMN approvedAt;
+			`,
+		},
+		{
+			version: 9,
+			up: `
+				CREATE TABLE auth_access_token (
+				   id          CHAR(36) NOT NULL,
+				   createdAt   DATETIME NOT NULL,
+				   userId      CHAR(36) NOT NULL,
+				   name        TEXT NOT NULL,
+				   hashedToken CHAR(64) NOT NULL,
+				   scopes      TEXT NOT NULL,
+				   expiresAt   DATETIME,
+				   lastUsedAt  DATETIME,
+
+				   CONSTRAINT pk_auth_access_token PRIMARY KEY (id),
+				   CONSTRAINT fk_auth_access_token_user FOREIGN KEY (userId) REFERENCES auth_user (id) ON DELETE CASCADE
+				);
+
+				CREATE UNIQUE INDEX idx_auth_access_token_hashedToken ON auth_access_token (hashedToken);
+				CREATE INDEX idx_auth_access_token_userId ON auth_access_token (userId);
+			`,
+			down: `
+				DROP TABLE auth_access_token;
+			`,
+		},
+		{
+			version: 10,
+			up: `
+				CREATE TABLE auth_service_account (
+				   id           CHAR(36) NOT NULL,
+				   createdAt    DATETIME NOT NULL,
+				   tenant       TEXT NOT NULL,
+				   name         TEXT NOT NULL,
+				   hashedSecret CHAR(64) NOT NULL,
+				   scopes       TEXT NOT NULL,
+				   disabledAt   DATETIME,
+
+				   CONSTRAINT pk_auth_service_account PRIMARY KEY (id)
+				);
+
+				CREATE INDEX idx_auth_service_account_tenant ON auth_service_account (tenant, createdAt);
+			`,
+			down: `
+				DROP TABLE auth_service_account;
+			`,
+		},
+		{
+			// Version 11 only changes the MySQL schema; the dialects keep
+			// the same versions.
+			version: 11,
+		},
+		{
+			// Version 12 only changes the Postgres schema.
+			version: 12,
+		},
+		{
+			version: 13,
+			up: `
+				ALTER TABLE auth_user ADD COLUMN deletedAt DATETIME;
+			`,
+			down: `
+				DELETE FROM auth_user WHERE deletedAt IS NOT NULL;
+				ALTER TABLE auth_user DROP COLUMN deletedAt;
+			`,
+		},
+	},
+}
+
+func (self storeSqlite) Migrate(version int) error {
+	return sqliteMigrations.migrate(self.db, version)
+}
+
+func (self storeSqlite) SchemaVersion() (int, error) {
+	return sqliteMigrations.version(self.db)
+}
+
+func (self storeSqlite) conn() sqlConn {
+	if self.tx != nil {
+		return self.tx
+	}
+	return self.db
+}
+
+func (self storeSqlite) WithTx(fn func(tx Store) error) error {
+	if self.tx != nil {
+		return fn(self)
+	}
+	return withSqlTx(self.ctx, self.db, func(tx *sql.Tx) error {
+		return fn(storeSqlite{self.db, tx, self.ctx})
+	})
+}
+
+func (self storeSqlite) WithContext(ctx context.Context) Store {
+	self.ctx = ctx
+	return self
+}
+
+func (self storeSqlite) LockUser(userId string) error {
+	// An update takes the write lock of the database, that SQLite
+	// otherwise takes on the first write of the transaction.
+	update := `
+		UPDATE auth_user
+		SET id = id
+		WHERE id = $1 AND deletedAt IS NULL;
+	`
+
+	result, err := self.conn().ExecContext(self.ctx, update, userId)
+	if err != nil {
+		return err
+	}
+
+	locked, err := result.RowsAffected()
+	if err == nil && locked == 0 {
+		err = sql.ErrNoRows
+	}
+	return err
+}
 
-		CREATE UNIQUE INDEX idx_auth_user_email ON auth_user (email);
+func (self storeSqlite) LockOrganization(organizationId string) error {
+	// Like LockUser, the update takes the write lock of the database.
+	update := `
+		UPDATE auth_organization
+		SET id = id
+		WHERE id = $1;
 	`
 
-	_, err := self.db.Exec(schema)
+	result, err := self.conn().ExecContext(self.ctx, update, organizationId)
+	if err != nil {
+		return err
+	}
+
+	locked, err := result.RowsAffected()
+	if err == nil && locked == 0 {
+		err = sql.ErrNoRows
+	}
 	return err
 }
 
-func (self storeSqlite) createUser(userId string, createdAt time.Time, email, hashedPass, lang, confirmationKey string) error {
+func (self storeSqlite) CreateUser(userId string, createdAt time.Time, tenant, email, hashedPass, lang, confirmationKey string) error {
 	insert := `
 		INSERT INTO auth_user
-		(id, createdAt, email, hashedPass, lang, confirmationKey)
+		(id, createdAt, tenant, email, hashedPass, lang, confirmationKey)
 		VALUES
-		($1, $2, $3, $4, $5, $6);
+		($1, $2, $3, $4, $5, $6, $7);
 	`
 
-	stmt, err := self.db.Prepare(insert)
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(userId, createdAt, email, hashedPass, lang, confirmationKey)
+	_, err = stmt.ExecContext(self.ctx, userId, createdAt, tenant, email, hashedPass, lang, confirmationKey)
 	return err
 }
 
-func (self storeSqlite) removeUsers(userIds ...string) error {
+func (self storeSqlite) RemoveUsers(userIds ...string) error {
 	placeholders := make([]string, len(userIds))
 	arguments := make([]interface{}, len(userIds))
 	for i, argument := range userIds {
@@ -67,131 +367,198 @@ func (self storeSqlite) removeUsers(userIds ...string) error {
 		arguments[i] = argument
 	}
 
-	delete := fmt.Sprintf("DELETE FROM auth_user WHERE id IN (%s)", strings.Join(placeholders, ","))
-	stmt, err := self.db.Prepare(delete)
-	if err != nil {
+	// SQLite does not enforce foreign keys by default, so the memberships,
+	// sessions and access tokens are removed explicitly.
+	return self.WithTx(func(tx Store) error {
+		conn := tx.(storeSqlite).conn()
+
+		for _, table := range []string{"auth_member", "auth_session", "auth_access_token"} {
+			deleteRelated := fmt.Sprintf("DELETE FROM %s WHERE userId IN (%s)", table, strings.Join(placeholders, ","))
+			if _, err := conn.ExecContext(self.ctx, deleteRelated, arguments...); err != nil {
+				return err
+			}
+		}
+
+		delete := fmt.Sprintf("DELETE FROM auth_user WHERE id IN (%s)", strings.Join(placeholders, ","))
+		_, err := conn.ExecContext(self.ctx, delete, arguments...)
 		return err
+	})
+}
+
+func (self storeSqlite) DeleteUsers(deletedAt time.Time, userIds ...string) error {
+	placeholders := make([]string, len(userIds))
+	arguments := make([]interface{}, len(userIds))
+	for i, argument := range userIds {
+		s := strconv.Itoa(i + 1)
+		placeholders[i] = strings.Join([]string{"$", s}, "")
+		arguments[i] = argument
 	}
 
-	_, err = stmt.Exec(arguments...)
-	return err
+	return self.WithTx(func(tx Store) error {
+		conn := tx.(storeSqlite).conn()
+
+		for _, table := range []string{"auth_member", "auth_session", "auth_access_token"} {
+			deleteRelated := fmt.Sprintf("DELETE FROM %s WHERE userId IN (%s)", table, strings.Join(placeholders, ","))
+			if _, err := conn.ExecContext(self.ctx, deleteRelated, arguments...); err != nil {
+				return err
+			}
+		}
+
+		// SQLite numbers the parameters in the order they first appear,
+		// whatever their names, so deletedAt is $1 and the ids follow.
+		updatePlaceholders := make([]string, len(userIds))
+		for i := range userIds {
+			updatePlaceholders[i] = strings.Join([]string{"$", strconv.Itoa(i + 2)}, "")
+		}
+		update := fmt.Sprintf("UPDATE auth_user SET deletedAt = $1 WHERE id IN (%s) AND deletedAt IS NULL", strings.Join(updatePlaceholders, ","))
+		_, err := conn.ExecContext(self.ctx, update, append([]interface{}{deletedAt}, arguments...)...)
+		return err
+	})
 }
 
-func (self storeSqlite) setUserConfirmedAt(userId string, confirmedAt time.Time) error {
+func (self storeSqlite) SetUserConfirmedAt(userId string, confirmedAt time.Time) error {
 	update := `
 		UPDATE auth_user
 		SET confirmedAt = $1
 		WHERE id = $2;
 	`
 
-	stmt, err := self.db.Prepare(update)
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(confirmedAt, userId)
+	_, err = stmt.ExecContext(self.ctx, confirmedAt, userId)
 	return err
 }
 
-func (self storeSqlite) setUserResetKey(userId, resetKey string) error {
+func (self storeSqlite) SetUserApprovedAt(userId string, approvedAt time.Time) error {
 	update := `
 		UPDATE auth_user
-		SET resetKey = $1
+		SET approvedAt = $1
 		WHERE id = $2;
 	`
 
-	stmt, err := self.db.Prepare(update)
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, approvedAt, userId)
+	return err
+}
+
+func (self storeSqlite) SetUserResetKey(userId, resetKey string, resetKeyCreatedAt time.Time) error {
+	update := `
+		UPDATE auth_user
+		SET resetKey = $1, resetKeyCreatedAt = $2
+		WHERE id = $3;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(resetKey, userId)
+	_, err = stmt.ExecContext(self.ctx, resetKey, resetKeyCreatedAt, userId)
 	return err
 }
 
-func (self storeSqlite) setUserHashedPass(userId, hashedPass string) error {
+func (self storeSqlite) SetUserHashedPass(userId, hashedPass string) error {
 	update := `
 		UPDATE auth_user
-		SET hashedPass = $1, resetKey = NULL
+		SET hashedPass = $1, resetKey = NULL, resetKeyCreatedAt = NULL
 		WHERE id = $2;
 	`
 
-	stmt, err := self.db.Prepare(update)
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(hashedPass, userId)
+	_, err = stmt.ExecContext(self.ctx, hashedPass, userId)
 	return err
 }
 
-func (self storeSqlite) setUserEmail(userId, email string) error {
+func (self storeSqlite) SetUserEmail(userId, email string) error {
 	update := `
 		UPDATE auth_user
 		SET email = $1
 		WHERE id = $2;
 	`
 
-	stmt, err := self.db.Prepare(update)
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(email, userId)
+	_, err = stmt.ExecContext(self.ctx, email, userId)
 	return err
 }
 
-func (self storeSqlite) getUserId(email string) (userId string, err error) {
+func (self storeSqlite) GetUserId(tenant, email string) (userId string, err error) {
 	query := `
 		SELECT id
 		FROM auth_user
-		WHERE email = $1;
+		WHERE tenant = $1 AND email = $2 COLLATE NOCASE AND deletedAt IS NULL;
 	`
-	err = self.db.QueryRow(query, email).Scan(&userId)
+	err = self.conn().QueryRowContext(self.ctx, query, tenant, email).Scan(&userId)
 	return
 }
 
-func (self storeSqlite) getPrivateUser(userId string) (user privateUser, err error) {
-	user.id = userId
+func (self storeSqlite) GetUser(userId string) (user StoredUser, err error) {
+	user.Id = userId
 
 	query := `
-		SELECT createdAt, email, hashedPass, lang, confirmationKey, confirmedAt, resetKey
+		SELECT createdAt, tenant, email, hashedPass, lang, confirmationKey, confirmedAt, resetKey, approvedAt
 		FROM auth_user
-		WHERE id = $1;
+		WHERE id = $1 AND deletedAt IS NULL;
 	`
 
-	var scanConfirmedAt pq.NullTime
+	var scanConfirmedAt, scanApprovedAt pq.NullTime
 	var scanResetKey sql.NullString
 
-	err = self.db.QueryRow(query, userId).Scan(
-		&user.createdAt,
-		&user.email,
-		&user.hashedPass,
-		&user.lang,
-		&user.confirmationKey,
+	err = self.conn().QueryRowContext(self.ctx, query, userId).Scan(
+		&user.CreatedAt,
+		&user.Tenant,
+		&user.Email,
+		&user.HashedPass,
+		&user.Lang,
+		&user.ConfirmationKey,
 		&scanConfirmedAt,
 		&scanResetKey,
+		&scanApprovedAt,
 	)
 
 	if scanConfirmedAt.Valid {
-		user.confirmedAt = scanConfirmedAt.Time
+		user.ConfirmedAt = scanConfirmedAt.Time
 	}
 	if scanResetKey.Valid {
-		user.resetKey = scanResetKey.String
+		user.ResetKey = scanResetKey.String
+	}
+	if scanApprovedAt.Valid {
+		user.ApprovedAt = scanApprovedAt.Time
 	}
 
 	return
 }
 
-func (self storeSqlite) getAllUsers() (users []User, err error) {
+func (self storeSqlite) GetAllUsers(tenant string) (users []User, err error) {
 	query := `
 		SELECT id, createdAt, email, lang, confirmedAt
-		FROM auth_user;
+		FROM auth_user
+		WHERE tenant = $1 AND deletedAt IS NULL
+		ORDER BY createdAt;
 	`
 
 	var scanConfirmedAt pq.NullTime
 
-	rows, err := self.db.Query(query)
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
 	if err != nil {
 		return
 	}
@@ -212,12 +579,745 @@ func (self storeSqlite) getAllUsers() (users []User, err error) {
 	return
 }
 
-func (self storeSqlite) removeUnconfirmedUsersCreatedBefore(date time.Time) error {
-	stmt, err := self.db.Prepare("DELETE FROM auth_user WHERE createdAt < $1;")
+func (self storeSqlite) GetProfile(userId string) (profile Profile, err error) {
+	query := `
+		SELECT userProfile, adminProfile
+		FROM auth_user
+		WHERE id = $1;
+	`
+
+	var scanUserProfile, scanAdminProfile []byte
+
+	err = self.conn().QueryRowContext(self.ctx, query, userId).Scan(&scanUserProfile, &scanAdminProfile)
+
+	profile.UserData = json.RawMessage(scanUserProfile)
+	profile.AdminData = json.RawMessage(scanAdminProfile)
+	return
+}
+
+func (self storeSqlite) SetUserProfile(userId string, userData json.RawMessage) error {
+	update := `
+		UPDATE auth_user
+		SET userProfile = $1
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, string(userData), userId)
+	return err
+}
+
+func (self storeSqlite) SetAdminProfile(userId string, adminData json.RawMessage) error {
+	update := `
+		UPDATE auth_user
+		SET adminProfile = $1
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, string(adminData), userId)
+	return err
+}
+
+func (self storeSqlite) CreateOrganization(organizationId string, createdAt time.Time, tenant, name string) error {
+	insert := `
+		INSERT INTO auth_organization
+		(id, createdAt, tenant, name)
+		VALUES
+		($1, $2, $3, $4);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, organizationId, createdAt, tenant, name)
+	return err
+}
+
+func (self storeSqlite) AddMember(organizationId, userId, role string, createdAt time.Time) error {
+	insert := `
+		INSERT INTO auth_member
+		(organizationId, userId, role, createdAt)
+		VALUES
+		($1, $2, $3, $4);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, organizationId, userId, role, createdAt)
+	return err
+}
+
+func (self storeSqlite) SetMemberRole(organizationId, userId, role string) error {
+	update := `
+		UPDATE auth_member
+		SET role = $1
+		WHERE organizationId = $2 AND userId = $3;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, role, organizationId, userId)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err == nil && updated == 0 {
+		err = sql.ErrNoRows
+	}
+	return err
+}
+
+func (self storeSqlite) RemoveMembers(organizationId string, userIds ...string) error {
+	placeholders := make([]string, len(userIds))
+	arguments := make([]interface{}, len(userIds)+1)
+	arguments[0] = organizationId
+	for i, argument := range userIds {
+		s := strconv.Itoa(i + 2)
+		placeholders[i] = strings.Join([]string{"$", s}, "")
+		arguments[i+1] = argument
+	}
+
+	delete := fmt.Sprintf("DELETE FROM auth_member WHERE organizationId = $1 AND userId IN (%s)", strings.Join(placeholders, ","))
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, arguments...)
+	return err
+}
+
+func (self storeSqlite) GetMemberRole(organizationId, userId string) (role string, err error) {
+	query := `
+		SELECT role
+		FROM auth_member
+		WHERE organizationId = $1 AND userId = $2;
+	`
+	err = self.conn().QueryRowContext(self.ctx, query, organizationId, userId).Scan(&role)
+	return
+}
+
+func (self storeSqlite) GetMembers(organizationId string) (members []Member, err error) {
+	query := `
+		SELECT m.userId, u.email, m.role, m.createdAt
+		FROM auth_member m
+		JOIN auth_user u ON u.id = m.userId
+		WHERE m.organizationId = $1
+		ORDER BY m.createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, organizationId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		member := Member{}
+		err = rows.Scan(&member.UserId, &member.Email, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return
+		}
+		members = append(members, member)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storeSqlite) GetMemberships(userId string) (memberships []Membership, err error) {
+	query := `
+		SELECT o.id, o.createdAt, o.name, m.role
+		FROM auth_member m
+		JOIN auth_organization o ON o.id = m.organizationId
+		WHERE m.userId = $1
+		ORDER BY o.name;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		membership := Membership{}
+		err = rows.Scan(
+			&membership.Organization.Id,
+			&membership.Organization.CreatedAt,
+			&membership.Organization.Name,
+			&membership.Role,
+		)
+		if err != nil {
+			return
+		}
+		memberships = append(memberships, membership)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storeSqlite) CreateImpersonation(impersonationId string, createdAt time.Time, tenant, userId, reason string) error {
+	insert := `
+		INSERT INTO auth_impersonation
+		(id, createdAt, tenant, userId, reason)
+		VALUES
+		($1, $2, $3, $4, $5);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, impersonationId, createdAt, tenant, userId, reason)
+	return err
+}
+
+func (self storeSqlite) GetImpersonations(tenant string) (impersonations []Impersonation, err error) {
+	query := `
+		SELECT id, createdAt, userId, reason
+		FROM auth_impersonation
+		WHERE tenant = $1
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		impersonation := Impersonation{}
+		err = rows.Scan(&impersonation.Id, &impersonation.CreatedAt, &impersonation.UserId, &impersonation.Reason)
+		if err != nil {
+			return
+		}
+		impersonations = append(impersonations, impersonation)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storeSqlite) CreateSession(sessionId string, createdAt time.Time, userId string) error {
+	insert := `
+		INSERT INTO auth_session
+		(id, createdAt, userId)
+		VALUES
+		($1, $2, $3);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, sessionId, createdAt, userId)
+	return err
+}
+
+func (self storeSqlite) GetSessionUserId(sessionId string) (userId string, err error) {
+	query := `
+		SELECT userId
+		FROM auth_session
+		WHERE id = $1;
+	`
+	err = self.conn().QueryRowContext(self.ctx, query, sessionId).Scan(&userId)
+	return
+}
+
+func (self storeSqlite) RemoveSessions(sessionIds ...string) error {
+	placeholders := make([]string, len(sessionIds))
+	arguments := make([]interface{}, len(sessionIds))
+	for i, argument := range sessionIds {
+		s := strconv.Itoa(i + 1)
+		placeholders[i] = strings.Join([]string{"$", s}, "")
+		arguments[i] = argument
+	}
+
+	delete := fmt.Sprintf("DELETE FROM auth_session WHERE id IN (%s)", strings.Join(placeholders, ","))
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, arguments...)
+	return err
+}
+
+func (self storeSqlite) CreateAccessToken(userId, hashedToken string, accessToken AccessToken) error {
+	insert := `
+		INSERT INTO auth_access_token
+		(id, createdAt, userId, name, hashedToken, scopes, expiresAt)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(
+		self.ctx,
+		accessToken.Id,
+		accessToken.CreatedAt,
+		userId,
+		accessToken.Name,
+		hashedToken,
+		joinScopes(accessToken.Scopes),
+		nullTime(accessToken.ExpiresAt),
+	)
+	return err
+}
+
+func (self storeSqlite) GetAccessTokens(userId string) (accessTokens []AccessToken, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, expiresAt, lastUsedAt
+		FROM auth_access_token
+		WHERE userId = $1
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, userId)
+	if err != nil {
+		return
+	}
+
+	return scanAccessTokens(rows)
+}
+
+func (self storeSqlite) GetAccessTokenByHash(hashedToken string) (accessToken AccessToken, userId string, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, expiresAt, lastUsedAt, userId
+		FROM auth_access_token
+		WHERE hashedToken = $1;
+	`
+	row := self.conn().QueryRowContext(self.ctx, query, hashedToken)
+	accessToken, err = scanAccessToken(row, &userId)
+	return
+}
+
+func (self storeSqlite) SetAccessTokenLastUsedAt(accessTokenId string, lastUsedAt time.Time) error {
+	update := `
+		UPDATE auth_access_token
+		SET lastUsedAt = $1
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, lastUsedAt, accessTokenId)
+	return err
+}
+
+func (self storeSqlite) RemoveAccessTokens(userId string, accessTokenIds ...string) error {
+	placeholders := make([]string, len(accessTokenIds))
+	arguments := make([]interface{}, len(accessTokenIds)+1)
+	arguments[0] = userId
+	for i, argument := range accessTokenIds {
+		s := strconv.Itoa(i + 2)
+		placeholders[i] = strings.Join([]string{"$", s}, "")
+		arguments[i+1] = argument
+	}
+
+	delete := fmt.Sprintf("DELETE FROM auth_access_token WHERE userId = $1 AND id IN (%s)", strings.Join(placeholders, ","))
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, arguments...)
+	return err
+}
+
+func (self storeSqlite) CreateServiceAccount(tenant, hashedSecret string, serviceAccount ServiceAccount) error {
+	insert := `
+		INSERT INTO auth_service_account
+		(id, createdAt, tenant, name, hashedSecret, scopes)
+		VALUES
+		($1, $2, $3, $4, $5, $6);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(
+		self.ctx,
+		serviceAccount.Id,
+		serviceAccount.CreatedAt,
+		tenant,
+		serviceAccount.Name,
+		hashedSecret,
+		joinScopes(serviceAccount.Scopes),
+	)
+	return err
+}
+
+func (self storeSqlite) GetServiceAccounts(tenant string) (serviceAccounts []ServiceAccount, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, disabledAt
+		FROM auth_service_account
+		WHERE tenant = $1
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
+	if err != nil {
+		return
+	}
+
+	return scanServiceAccounts(rows)
+}
+
+func (self storeSqlite) GetServiceAccount(tenant, serviceAccountId string) (serviceAccount ServiceAccount, hashedSecret string, err error) {
+	query := `
+		SELECT id, createdAt, name, scopes, disabledAt, hashedSecret
+		FROM auth_service_account
+		WHERE tenant = $1 AND id = $2;
+	`
+	row := self.conn().QueryRowContext(self.ctx, query, tenant, serviceAccountId)
+	serviceAccount, err = scanServiceAccount(row, &hashedSecret)
+	return
+}
+
+func (self storeSqlite) SetServiceAccountHashedSecret(serviceAccountId, hashedSecret string) error {
+	update := `
+		UPDATE auth_service_account
+		SET hashedSecret = $1
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, hashedSecret, serviceAccountId)
+	return err
+}
+
+func (self storeSqlite) SetServiceAccountDisabledAt(serviceAccountId string, disabledAt time.Time) error {
+	update := `
+		UPDATE auth_service_account
+		SET disabledAt = $1
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(self.ctx, nullTime(disabledAt), serviceAccountId)
+	return err
+}
+
+func (self storeSqlite) AcquireJobLock(tenant, job, owner string, now, lockedUntil time.Time) (acquired bool, err error) {
+	update := `
+		UPDATE auth_job_lock
+		SET owner = $1, lockedUntil = $2
+		WHERE tenant = $3 AND job = $4 AND lockedUntil <= $5;
+	`
+
+	result, err := self.conn().ExecContext(self.ctx, update, owner, lockedUntil, tenant, job, now)
+	if err != nil {
+		return
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil || updated == 1 {
+		return updated == 1, err
+	}
+
+	insert := `
+		INSERT INTO auth_job_lock
+		(tenant, job, owner, lockedUntil)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (SELECT 1 FROM auth_job_lock WHERE tenant = $1 AND job = $2);
+	`
+
+	result, err = self.conn().ExecContext(self.ctx, insert, tenant, job, owner, lockedUntil)
+	if err != nil {
+		return
+	}
+
+	inserted, err := result.RowsAffected()
+	return inserted == 1, err
+}
+
+func (self storeSqlite) CreateJobRun(tenant string, jobRun JobRun) error {
+	insert := `
+		INSERT INTO auth_job_run
+		(id, tenant, job, owner, startedAt, finishedAt, affected, error)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8);
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(
+		self.ctx,
+		jobRun.Id,
+		tenant,
+		jobRun.Job,
+		jobRun.Owner,
+		jobRun.StartedAt,
+		jobRun.FinishedAt,
+		jobRun.Affected,
+		jobRun.Error,
+	)
+	return err
+}
+
+func (self storeSqlite) GetJobRuns(tenant string, limit int) (jobRuns []JobRun, err error) {
+	query := `
+		SELECT id, job, owner, startedAt, finishedAt, affected, error
+		FROM auth_job_run
+		WHERE tenant = $1
+		ORDER BY startedAt DESC
+		LIMIT $2;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		jobRun := JobRun{}
+		err = rows.Scan(
+			&jobRun.Id,
+			&jobRun.Job,
+			&jobRun.Owner,
+			&jobRun.StartedAt,
+			&jobRun.FinishedAt,
+			&jobRun.Affected,
+			&jobRun.Error,
+		)
+		if err != nil {
+			return
+		}
+		jobRuns = append(jobRuns, jobRun)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storeSqlite) GetUnapprovedUsers(tenant string) (users []User, err error) {
+	query := `
+		SELECT id, createdAt, email, lang, confirmedAt
+		FROM auth_user
+		WHERE tenant = $1 AND confirmedAt IS NOT NULL AND approvedAt IS NULL AND deletedAt IS NULL
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant)
+	if err != nil {
+		return
+	}
+
+	return scanUsers(rows)
+}
+
+func (self storeSqlite) GetUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []User, err error) {
+	query := `
+		SELECT id, createdAt, email, lang, confirmedAt
+		FROM auth_user
+		WHERE tenant = $1 AND createdAt < $2 AND confirmedAt IS NULL AND deletedAt IS NULL
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return scanUsers(rows)
+}
+
+func (self storeSqlite) GetUnwarnedUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (users []StoredUser, err error) {
+	query := `
+		SELECT id, createdAt, email, lang, confirmationKey
+		FROM auth_user
+		WHERE tenant = $1 AND createdAt < $2 AND confirmedAt IS NULL AND removalWarnedAt IS NULL AND deletedAt IS NULL
+		ORDER BY createdAt;
+	`
+
+	rows, err := self.conn().QueryContext(self.ctx, query, tenant, date)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := StoredUser{}
+		err = rows.Scan(&user.Id, &user.CreatedAt, &user.Email, &user.Lang, &user.ConfirmationKey)
+		if err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+func (self storeSqlite) SetUserRemovalWarnedAt(userId string, removalWarnedAt time.Time) error {
+	update := `
+		UPDATE auth_user
+		SET removalWarnedAt = $1
+		WHERE id = $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(date)
+	_, err = stmt.ExecContext(self.ctx, removalWarnedAt, userId)
 	return err
 }
+
+func (self storeSqlite) RemoveUnconfirmedUsersCreatedBefore(tenant string, date time.Time) (removedUsers []User, err error) {
+	err = self.WithTx(func(tx Store) error {
+		conn := tx.(storeSqlite).conn()
+
+		for _, table := range []string{"auth_member", "auth_session", "auth_access_token"} {
+			deleteRelated := fmt.Sprintf(`
+				DELETE FROM %s
+				WHERE userId IN (
+					SELECT id FROM auth_user
+					WHERE tenant = $1 AND createdAt < $2 AND confirmedAt IS NULL AND deletedAt IS NULL
+				);
+			`, table)
+			if _, err := conn.ExecContext(self.ctx, deleteRelated, tenant, date); err != nil {
+				return err
+			}
+		}
+
+		delete := `
+			DELETE FROM auth_user
+			WHERE tenant = $1 AND createdAt < $2 AND confirmedAt IS NULL AND deletedAt IS NULL
+			RETURNING id, createdAt, email, lang, confirmedAt;
+		`
+
+		rows, err := conn.QueryContext(self.ctx, delete, tenant, date)
+		if err != nil {
+			return err
+		}
+
+		removedUsers, err = scanUsers(rows)
+		return err
+	})
+	if err != nil {
+		removedUsers = nil
+	}
+	return
+}
+
+func (self storeSqlite) ClearResetKeysCreatedBefore(tenant string, date time.Time) (cleared int64, err error) {
+	update := `
+		UPDATE auth_user
+		SET resetKey = NULL, resetKeyCreatedAt = NULL
+		WHERE tenant = $1 AND resetKeyCreatedAt < $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, update)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return result.RowsAffected()
+}
+
+func (self storeSqlite) RemoveUsersDeletedBefore(tenant string, date time.Time) (removed int64, err error) {
+	// DeleteUsers already removed their memberships, sessions and access
+	// tokens.
+	delete := `
+		DELETE FROM auth_user
+		WHERE tenant = $1 AND deletedAt < $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return result.RowsAffected()
+}
+
+func (self storeSqlite) RemoveSessionsCreatedBefore(tenant string, date time.Time) (removed int64, err error) {
+	delete := `
+		DELETE FROM auth_session
+		WHERE userId IN (SELECT id FROM auth_user WHERE tenant = $1) AND createdAt < $2;
+	`
+
+	stmt, err := self.conn().PrepareContext(self.ctx, delete)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(self.ctx, tenant, date)
+	if err != nil {
+		return
+	}
+
+	return result.RowsAffected()
+}
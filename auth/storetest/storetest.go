@@ -0,0 +1,682 @@
+// Package storetest checks that an auth.Store behaves as the auth service
+// expects. Run it from the tests of a Store implementation:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) auth.Store {
+//			return newEmptyStore(t)
+//		})
+//	}
+package storetest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dfreire/fservices/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// NewStore returns an empty store, with its schema, for each test.
+type NewStore func(t *testing.T) auth.Store
+
+func Run(t *testing.T, newStore NewStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store auth.Store)
+	}{
+		{"Users", testUsers},
+		{"NullableFields", testNullableFields},
+		{"Approval", testApproval},
+		{"Uniqueness", testUniqueness},
+		{"NotFound", testNotFound},
+		{"RemoveUsers", testRemoveUsers},
+		{"DeleteUsers", testDeleteUsers},
+		{"RemoveUnconfirmedUsers", testRemoveUnconfirmedUsers},
+		{"Profiles", testProfiles},
+		{"Organizations", testOrganizations},
+		{"Sessions", testSessions},
+		{"RemoveSessionsCreatedBefore", testRemoveSessionsCreatedBefore},
+		{"AccessTokens", testAccessTokens},
+		{"ServiceAccounts", testServiceAccounts},
+		{"Jobs", testJobs},
+		{"Transactions", testTransactions},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newStore(t))
+		})
+	}
+}
+
+// when is the creation time of the test records, truncated to what every
+// store can keep.
+var when = time.Now().UTC().Truncate(time.Millisecond)
+
+func createUser(t *testing.T, store auth.Store, userId, tenant, email string, createdAt time.Time) {
+	err := store.CreateUser(userId, createdAt, tenant, email, "hashedPass", "en_US", "confirmationKey-"+userId)
+	assert.Nil(t, err)
+}
+
+func testUsers(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "dario.freire@gmail.com", when)
+
+	userId, err := store.GetUserId("", "dario.freire@gmail.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", userId)
+
+	user, err := store.GetUser("1")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", user.Id)
+	assert.WithinDuration(t, when, user.CreatedAt, time.Millisecond)
+	assert.Equal(t, "", user.Tenant)
+	assert.Equal(t, "dario.freire@gmail.com", user.Email)
+	assert.Equal(t, "hashedPass", user.HashedPass)
+	assert.Equal(t, "en_US", user.Lang)
+	assert.Equal(t, "confirmationKey-1", user.ConfirmationKey)
+
+	assert.Nil(t, store.SetUserHashedPass("1", "newHashedPass"))
+	assert.Nil(t, store.SetUserEmail("1", "dario.freire+new@gmail.com"))
+
+	user, err = store.GetUser("1")
+	assert.Nil(t, err)
+	assert.Equal(t, "newHashedPass", user.HashedPass)
+	assert.Equal(t, "dario.freire+new@gmail.com", user.Email)
+
+	createUser(t, store, "2", "", "joe@example.com", when.Add(time.Second))
+	createUser(t, store, "3", "other", "ann@example.com", when)
+
+	user, err = store.GetUser("3")
+	assert.Nil(t, err)
+	assert.Equal(t, "other", user.Tenant)
+
+	users, err := store.GetAllUsers("")
+	assert.Nil(t, err)
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "1", users[0].Id)
+		assert.Equal(t, "2", users[1].Id)
+	}
+}
+
+func testNullableFields(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "dario.freire@gmail.com", when)
+
+	user, err := store.GetUser("1")
+	assert.Nil(t, err)
+	assert.True(t, user.ConfirmedAt.IsZero())
+	assert.Equal(t, "", user.ResetKey)
+
+	users, err := store.GetAllUsers("")
+	assert.Nil(t, err)
+	if assert.Len(t, users, 1) {
+		assert.True(t, users[0].ConfirmedAt.IsZero())
+	}
+
+	assert.Nil(t, store.SetUserConfirmedAt("1", when))
+	assert.Nil(t, store.SetUserResetKey("1", "resetKey", when))
+
+	user, err = store.GetUser("1")
+	assert.Nil(t, err)
+	assert.WithinDuration(t, when, user.ConfirmedAt, time.Millisecond)
+	assert.Equal(t, "resetKey", user.ResetKey)
+
+	// Changing the password consumes the reset key.
+	assert.Nil(t, store.SetUserHashedPass("1", "newHashedPass"))
+	user, err = store.GetUser("1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", user.ResetKey)
+
+	assert.Nil(t, store.SetUserResetKey("1", "resetKey", when))
+	cleared, err := store.ClearResetKeysCreatedBefore("", when.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cleared)
+
+	user, err = store.GetUser("1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", user.ResetKey)
+}
+
+func testApproval(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "dario.freire@gmail.com", when)
+	createUser(t, store, "2", "", "joe@example.com", when.Add(time.Second))
+	createUser(t, store, "3", "", "ann@example.com", when.Add(2*time.Second))
+
+	user, err := store.GetUser("1")
+	assert.Nil(t, err)
+	assert.True(t, user.ApprovedAt.IsZero())
+
+	// Only the confirmed users wait for approval.
+	assert.Nil(t, store.SetUserConfirmedAt("1", when))
+	assert.Nil(t, store.SetUserConfirmedAt("2", when))
+
+	users, err := store.GetUnapprovedUsers("")
+	assert.Nil(t, err)
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "1", users[0].Id)
+		assert.Equal(t, "2", users[1].Id)
+	}
+
+	assert.Nil(t, store.SetUserApprovedAt("1", when))
+
+	user, err = store.GetUser("1")
+	assert.Nil(t, err)
+	assert.WithinDuration(t, when, user.ApprovedAt, time.Millisecond)
+
+	users, err = store.GetUnapprovedUsers("")
+	assert.Nil(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "2", users[0].Id)
+	}
+
+	users, err = store.GetUnapprovedUsers("other")
+	assert.Nil(t, err)
+	assert.Empty(t, users)
+}
+
+func testUniqueness(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "dario.freire@gmail.com", when)
+
+	err := store.CreateUser("2", when, "", "dario.freire@gmail.com", "hashedPass", "en_US", "confirmationKey")
+	assert.NotNil(t, err)
+
+	// Emails are unique per tenant.
+	createUser(t, store, "3", "other", "dario.freire@gmail.com", when)
+
+	createUser(t, store, "4", "", "joe@example.com", when)
+	assert.NotNil(t, store.SetUserEmail("4", "dario.freire@gmail.com"))
+
+	user, err := store.GetUser("4")
+	assert.Nil(t, err)
+	assert.Equal(t, "joe@example.com", user.Email)
+	// Emails are not case sensitive.
+	err = store.CreateUser("5", when, "", "Dario.Freire@Gmail.com", "hashedPass", "en_US", "confirmationKey")
+	assert.NotNil(t, err)
+
+	userId, err := store.GetUserId("", "DARIO.FREIRE@gmail.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", userId)
+
+	// But they are accent sensitive.
+	createUser(t, store, "6", "", "jose@example.com", when)
+	createUser(t, store, "7", "", "josé@example.com", when)
+
+	userId, err = store.GetUserId("", "JOSé@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "7", userId)
+}
+
+func testNotFound(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "dario.freire@gmail.com", when)
+
+	_, err := store.GetUserId("", "joe@example.com")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	_, err = store.GetUserId("other", "dario.freire@gmail.com")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	_, err = store.GetUser("2")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	_, err = store.GetProfile("2")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	_, err = store.GetMemberRole("organization", "1")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	_, err = store.GetSessionUserId("session")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func testRemoveUsers(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "dario.freire@gmail.com", when)
+	createUser(t, store, "2", "", "joe@example.com", when)
+	createUser(t, store, "3", "", "ann@example.com", when)
+
+	assert.Nil(t, store.CreateOrganization("organization", when, "", "Acme"))
+	assert.Nil(t, store.AddMember("organization", "1", auth.OrganizationRoleAdmin, when))
+	assert.Nil(t, store.AddMember("organization", "2", auth.OrganizationRoleMember, when))
+	assert.Nil(t, store.CreateSession("session", when, "1"))
+	assert.Nil(t, store.CreateAccessToken("1", "hash", auth.AccessToken{Id: "token", CreatedAt: when, Name: "CI"}))
+
+	assert.Nil(t, store.RemoveUsers("1", "3", "4"))
+
+	_, err := store.GetUser("1")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = store.GetUser("3")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = store.GetUser("2")
+	assert.Nil(t, err)
+
+	// The memberships, sessions and access tokens of the removed users go
+	// with them.
+	members, err := store.GetMembers("organization")
+	assert.Nil(t, err)
+	if assert.Len(t, members, 1) {
+		assert.Equal(t, "2", members[0].UserId)
+	}
+
+	_, err = store.GetSessionUserId("session")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, _, err = store.GetAccessTokenByHash("hash")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// The email of a removed user can be used again.
+	createUser(t, store, "5", "", "dario.freire@gmail.com", when)
+}
+
+func testDeleteUsers(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "dario.freire@gmail.com", when)
+	createUser(t, store, "2", "", "joe@example.com", when)
+	createUser(t, store, "3", "other", "dario.freire@gmail.com", when)
+
+	assert.Nil(t, store.CreateOrganization("organization", when, "", "Acme"))
+	assert.Nil(t, store.AddMember("organization", "1", auth.OrganizationRoleAdmin, when))
+	assert.Nil(t, store.AddMember("organization", "2", auth.OrganizationRoleMember, when))
+	assert.Nil(t, store.CreateSession("session", when, "1"))
+	assert.Nil(t, store.CreateAccessToken("1", "hash", auth.AccessToken{Id: "token", CreatedAt: when, Name: "CI"}))
+
+	assert.Nil(t, store.DeleteUsers(when, "1", "3", "4"))
+
+	// The deleted users are neither found nor listed.
+	_, err := store.GetUser("1")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = store.GetUserId("", "dario.freire@gmail.com")
+	assert.Equal(t, sql.ErrNoRows, err)
+	err = store.WithTx(func(tx auth.Store) error {
+		return tx.LockUser("1")
+	})
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	users, err := store.GetAllUsers("")
+	assert.Nil(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "2", users[0].Id)
+	}
+	users, err = store.GetUnconfirmedUsersCreatedBefore("", when.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Len(t, users, 1)
+
+	members, err := store.GetMembers("organization")
+	assert.Nil(t, err)
+	assert.Len(t, members, 1)
+	_, err = store.GetSessionUserId("session")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, _, err = store.GetAccessTokenByHash("hash")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// Their emails stay taken until they are removed.
+	assert.NotNil(t, store.CreateUser("5", when, "", "dario.freire@gmail.com", "hashedPass", "en_US", "confirmationKey-5"))
+
+	removed, err := store.RemoveUsersDeletedBefore("", when)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), removed)
+
+	removed, err = store.RemoveUsersDeletedBefore("", when.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	createUser(t, store, "5", "", "dario.freire@gmail.com", when)
+
+	// The purge of the tenant left the deleted user of the other tenant.
+	removed, err = store.RemoveUsersDeletedBefore("other", when.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+}
+
+func testRemoveUnconfirmedUsers(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "old.unconfirmed@example.com", when.Add(-2*time.Hour))
+	createUser(t, store, "2", "", "old.confirmed@example.com", when.Add(-2*time.Hour))
+	createUser(t, store, "3", "", "new.unconfirmed@example.com", when)
+	createUser(t, store, "4", "other", "old.unconfirmed@example.com", when.Add(-2*time.Hour))
+	assert.Nil(t, store.SetUserConfirmedAt("2", when))
+	assert.Nil(t, store.CreateSession("session", when, "1"))
+
+	before := when.Add(-time.Hour)
+
+	users, err := store.GetUnconfirmedUsersCreatedBefore("", before)
+	assert.Nil(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "1", users[0].Id)
+	}
+
+	unwarned, err := store.GetUnwarnedUnconfirmedUsersCreatedBefore("", before)
+	assert.Nil(t, err)
+	if assert.Len(t, unwarned, 1) {
+		assert.Equal(t, "confirmationKey-1", unwarned[0].ConfirmationKey)
+	}
+
+	assert.Nil(t, store.SetUserRemovalWarnedAt("1", when))
+	unwarned, err = store.GetUnwarnedUnconfirmedUsersCreatedBefore("", before)
+	assert.Nil(t, err)
+	assert.Len(t, unwarned, 0)
+
+	removedUsers, err := store.RemoveUnconfirmedUsersCreatedBefore("", before)
+	assert.Nil(t, err)
+	if assert.Len(t, removedUsers, 1) {
+		assert.Equal(t, "1", removedUsers[0].Id)
+		assert.Equal(t, "old.unconfirmed@example.com", removedUsers[0].Email)
+	}
+
+	for _, userId := range []string{"2", "3", "4"} {
+		_, err = store.GetUser(userId)
+		assert.Nil(t, err)
+	}
+
+	_, err = store.GetSessionUserId("session")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func testProfiles(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "dario.freire@gmail.com", when)
+
+	profile, err := store.GetProfile("1")
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{}`, string(profile.UserData))
+	assert.JSONEq(t, `{}`, string(profile.AdminData))
+
+	assert.Nil(t, store.SetUserProfile("1", json.RawMessage(`{"displayName": "Dario"}`)))
+	assert.Nil(t, store.SetAdminProfile("1", json.RawMessage(`{"plan": "pro"}`)))
+
+	profile, err = store.GetProfile("1")
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"displayName": "Dario"}`, string(profile.UserData))
+	assert.JSONEq(t, `{"plan": "pro"}`, string(profile.AdminData))
+}
+
+func testOrganizations(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "dario.freire@gmail.com", when)
+	createUser(t, store, "2", "", "joe@example.com", when)
+
+	assert.Nil(t, store.CreateOrganization("a", when, "", "Beta"))
+	assert.Nil(t, store.CreateOrganization("b", when, "", "Alpha"))
+	assert.Nil(t, store.AddMember("a", "1", auth.OrganizationRoleAdmin, when))
+	assert.Nil(t, store.AddMember("a", "2", auth.OrganizationRoleMember, when.Add(time.Second)))
+	assert.Nil(t, store.AddMember("b", "1", auth.OrganizationRoleMember, when))
+
+	assert.NotNil(t, store.AddMember("a", "2", auth.OrganizationRoleAdmin, when))
+
+	role, err := store.GetMemberRole("a", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, auth.OrganizationRoleMember, role)
+
+	assert.Nil(t, store.SetMemberRole("a", "2", auth.OrganizationRoleAdmin))
+	role, err = store.GetMemberRole("a", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, auth.OrganizationRoleAdmin, role)
+
+	// Setting the same role again still finds the member.
+	assert.Nil(t, store.SetMemberRole("a", "2", auth.OrganizationRoleAdmin))
+	assert.Equal(t, sql.ErrNoRows, store.SetMemberRole("b", "2", auth.OrganizationRoleAdmin))
+
+	members, err := store.GetMembers("a")
+	assert.Nil(t, err)
+	if assert.Len(t, members, 2) {
+		assert.Equal(t, "1", members[0].UserId)
+		assert.Equal(t, "dario.freire@gmail.com", members[0].Email)
+		assert.Equal(t, "2", members[1].UserId)
+	}
+
+	memberships, err := store.GetMemberships("1")
+	assert.Nil(t, err)
+	if assert.Len(t, memberships, 2) {
+		assert.Equal(t, "Alpha", memberships[0].Organization.Name)
+		assert.Equal(t, auth.OrganizationRoleMember, memberships[0].Role)
+		assert.Equal(t, "Beta", memberships[1].Organization.Name)
+		assert.Equal(t, auth.OrganizationRoleAdmin, memberships[1].Role)
+	}
+
+	assert.Nil(t, store.RemoveMembers("a", "2", "3"))
+	members, err = store.GetMembers("a")
+	assert.Nil(t, err)
+	assert.Len(t, members, 1)
+}
+
+func testSessions(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "dario.freire@gmail.com", when)
+	createUser(t, store, "2", "other", "dario.freire@gmail.com", when)
+
+	assert.Nil(t, store.CreateSession("old", when.Add(-2*time.Hour), "1"))
+	assert.Nil(t, store.CreateSession("new", when, "1"))
+	assert.Nil(t, store.CreateSession("other", when.Add(-2*time.Hour), "2"))
+
+	userId, err := store.GetSessionUserId("new")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", userId)
+
+	removed, err := store.RemoveSessionsCreatedBefore("", when.Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	_, err = store.GetSessionUserId("old")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = store.GetSessionUserId("new")
+	assert.Nil(t, err)
+	_, err = store.GetSessionUserId("other")
+	assert.Nil(t, err)
+
+	assert.Nil(t, store.RemoveSessions("new", "unknown"))
+	_, err = store.GetSessionUserId("new")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = store.GetSessionUserId("other")
+	assert.Nil(t, err)
+
+	assert.Nil(t, store.CreateImpersonation("impersonation", when, "", "1", "Support ticket."))
+	impersonations, err := store.GetImpersonations("")
+	assert.Nil(t, err)
+	if assert.Len(t, impersonations, 1) {
+		assert.Equal(t, "1", impersonations[0].UserId)
+		assert.Equal(t, "Support ticket.", impersonations[0].Reason)
+	}
+
+	impersonations, err = store.GetImpersonations("other")
+	assert.Nil(t, err)
+	assert.Len(t, impersonations, 0)
+}
+
+// testRemoveSessionsCreatedBefore binds a tenant and a date that cannot be
+// mistaken for each other, as SQLite numbers the $N parameters by their
+// first appearance in the query.
+func testRemoveSessionsCreatedBefore(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "acme", "dario.freire@gmail.com", when)
+	createUser(t, store, "2", "", "dario.freire@gmail.com", when)
+
+	assert.Nil(t, store.CreateSession("old", when.Add(-2*time.Hour), "1"))
+	assert.Nil(t, store.CreateSession("older", when.Add(-3*time.Hour), "1"))
+	assert.Nil(t, store.CreateSession("new", when, "1"))
+	assert.Nil(t, store.CreateSession("other", when.Add(-2*time.Hour), "2"))
+
+	removed, err := store.RemoveSessionsCreatedBefore("acme", when.Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), removed)
+
+	_, err = store.GetSessionUserId("old")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = store.GetSessionUserId("older")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = store.GetSessionUserId("new")
+	assert.Nil(t, err)
+	_, err = store.GetSessionUserId("other")
+	assert.Nil(t, err)
+}
+
+func testAccessTokens(t *testing.T, store auth.Store) {
+	createUser(t, store, "1", "", "dario.freire@gmail.com", when)
+	createUser(t, store, "2", "", "joe@example.com", when)
+
+	ci := auth.AccessToken{Id: "ci", CreatedAt: when, Name: "CI", Scopes: []string{"read", "write"}, ExpiresAt: when.Add(time.Hour)}
+	script := auth.AccessToken{Id: "script", CreatedAt: when.Add(time.Second), Name: "Script", Scopes: []string{}}
+	assert.Nil(t, store.CreateAccessToken("1", "hash-ci", ci))
+	assert.Nil(t, store.CreateAccessToken("1", "hash-script", script))
+	assert.NotNil(t, store.CreateAccessToken("2", "hash-ci", auth.AccessToken{Id: "other", CreatedAt: when, Name: "Other"}))
+
+	accessToken, userId, err := store.GetAccessTokenByHash("hash-ci")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", userId)
+	assert.Equal(t, "ci", accessToken.Id)
+	assert.Equal(t, "CI", accessToken.Name)
+	assert.Equal(t, []string{"read", "write"}, accessToken.Scopes)
+	assert.WithinDuration(t, when.Add(time.Hour), accessToken.ExpiresAt, time.Millisecond)
+	assert.True(t, accessToken.LastUsedAt.IsZero())
+
+	_, _, err = store.GetAccessTokenByHash("unknown")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	assert.Nil(t, store.SetAccessTokenLastUsedAt("ci", when))
+
+	accessTokens, err := store.GetAccessTokens("1")
+	assert.Nil(t, err)
+	if assert.Len(t, accessTokens, 2) {
+		assert.Equal(t, "ci", accessTokens[0].Id)
+		assert.WithinDuration(t, when, accessTokens[0].LastUsedAt, time.Millisecond)
+		assert.Equal(t, "script", accessTokens[1].Id)
+		assert.Empty(t, accessTokens[1].Scopes)
+		assert.True(t, accessTokens[1].ExpiresAt.IsZero())
+	}
+
+	// Only the tokens of the user are removed.
+	assert.Nil(t, store.RemoveAccessTokens("2", "ci"))
+	assert.Nil(t, store.RemoveAccessTokens("1", "ci", "unknown"))
+
+	accessTokens, err = store.GetAccessTokens("1")
+	assert.Nil(t, err)
+	if assert.Len(t, accessTokens, 1) {
+		assert.Equal(t, "script", accessTokens[0].Id)
+	}
+
+	_, _, err = store.GetAccessTokenByHash("hash-ci")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	accessTokens, err = store.GetAccessTokens("2")
+	assert.Nil(t, err)
+	assert.Empty(t, accessTokens)
+}
+
+func testServiceAccounts(t *testing.T, store auth.Store) {
+	deploy := auth.ServiceAccount{Id: "deploy", CreatedAt: when, Name: "Deploy", Scopes: []string{"deploy"}}
+	backup := auth.ServiceAccount{Id: "backup", CreatedAt: when.Add(time.Second), Name: "Backup", Scopes: []string{}}
+	assert.Nil(t, store.CreateServiceAccount("", "hash-deploy", deploy))
+	assert.Nil(t, store.CreateServiceAccount("", "hash-backup", backup))
+	assert.NotNil(t, store.CreateServiceAccount("", "hash-other", deploy))
+
+	serviceAccount, hashedSecret, err := store.GetServiceAccount("", "deploy")
+	assert.Nil(t, err)
+	assert.Equal(t, "Deploy", serviceAccount.Name)
+	assert.Equal(t, []string{"deploy"}, serviceAccount.Scopes)
+	assert.Equal(t, "hash-deploy", hashedSecret)
+	assert.True(t, serviceAccount.DisabledAt.IsZero())
+
+	_, _, err = store.GetServiceAccount("other", "deploy")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	assert.Nil(t, store.SetServiceAccountHashedSecret("deploy", "hash-rotated"))
+	assert.Nil(t, store.SetServiceAccountDisabledAt("backup", when))
+
+	_, hashedSecret, err = store.GetServiceAccount("", "deploy")
+	assert.Nil(t, err)
+	assert.Equal(t, "hash-rotated", hashedSecret)
+
+	serviceAccounts, err := store.GetServiceAccounts("")
+	assert.Nil(t, err)
+	if assert.Len(t, serviceAccounts, 2) {
+		assert.Equal(t, "deploy", serviceAccounts[0].Id)
+		assert.Equal(t, "backup", serviceAccounts[1].Id)
+		assert.Empty(t, serviceAccounts[1].Scopes)
+		assert.WithinDuration(t, when, serviceAccounts[1].DisabledAt, time.Millisecond)
+	}
+
+	serviceAccounts, err = store.GetServiceAccounts("other")
+	assert.Nil(t, err)
+	assert.Empty(t, serviceAccounts)
+}
+
+func testJobs(t *testing.T, store auth.Store) {
+	acquired, err := store.AcquireJobLock("", "job", "a", when, when.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = store.AcquireJobLock("", "job", "b", when.Add(time.Minute), when.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+
+	acquired, err = store.AcquireJobLock("other", "job", "b", when, when.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = store.AcquireJobLock("", "job", "b", when.Add(time.Hour), when.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	for i, id := range []string{"1", "2", "3"} {
+		startedAt := when.Add(time.Duration(i) * time.Minute)
+		err = store.CreateJobRun("", auth.JobRun{
+			Id:         id,
+			Job:        "job",
+			Owner:      "a",
+			StartedAt:  startedAt,
+			FinishedAt: startedAt.Add(time.Second),
+			Affected:   int64(i),
+		})
+		assert.Nil(t, err)
+	}
+
+	jobRuns, err := store.GetJobRuns("", 2)
+	assert.Nil(t, err)
+	if assert.Len(t, jobRuns, 2) {
+		assert.Equal(t, "3", jobRuns[0].Id)
+		assert.Equal(t, int64(2), jobRuns[0].Affected)
+		assert.Equal(t, "2", jobRuns[1].Id)
+	}
+
+	jobRuns, err = store.GetJobRuns("other", 10)
+	assert.Nil(t, err)
+	assert.Len(t, jobRuns, 0)
+}
+
+func testTransactions(t *testing.T, store auth.Store) {
+	err := store.WithTx(func(tx auth.Store) error {
+		createUser(t, tx, "1", "", "dario.freire@gmail.com", when)
+		assert.Nil(t, tx.LockUser("1"))
+		return tx.SetUserConfirmedAt("1", when)
+	})
+	assert.Nil(t, err)
+
+	user, err := store.GetUser("1")
+	assert.Nil(t, err)
+	assert.WithinDuration(t, when, user.ConfirmedAt, time.Millisecond)
+
+	// A failed transaction leaves nothing behind, within nested calls too.
+	failed := errors.New("failed")
+	err = store.WithTx(func(tx auth.Store) error {
+		createUser(t, tx, "2", "", "other@example.com", when)
+		return tx.WithTx(func(tx auth.Store) error {
+			assert.Nil(t, tx.SetUserEmail("1", "changed@example.com"))
+			return failed
+		})
+	})
+	assert.Equal(t, failed, err)
+
+	_, err = store.GetUser("2")
+	assert.Equal(t, sql.ErrNoRows, err)
+	user, err = store.GetUser("1")
+	assert.Nil(t, err)
+	assert.Equal(t, "dario.freire@gmail.com", user.Email)
+
+	err = store.WithTx(func(tx auth.Store) error {
+		return tx.LockUser("3")
+	})
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	assert.Nil(t, store.CreateOrganization("a", when, "", "Alpha"))
+	err = store.WithTx(func(tx auth.Store) error {
+		return tx.LockOrganization("a")
+	})
+	assert.Nil(t, err)
+	err = store.WithTx(func(tx auth.Store) error {
+		return tx.LockOrganization("b")
+	})
+	assert.Equal(t, sql.ErrNoRows, err)
+}
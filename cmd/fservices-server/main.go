@@ -0,0 +1,154 @@
+// Command fservices-server serves auth and files behind one HTTP listener,
+// from the same TOML config as the fservices command:
+//
+//	/healthz   liveness, always 200 while the process runs
+//	/readyz    readiness, 503 when the database is down or on shutdown
+//	/auth/...  the auth JSON API (see auth/http)
+//	/files/... file uploads, for signed in users
+//	/admin/backup  a copy of a bolt store, with the X-Admin-Key header
+//
+// It also runs the scheduled jobs of the [Jobs] section, and shuts down
+// gracefully on SIGINT or SIGTERM.
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	stdhttp "net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/dfreire/fservices/auth"
+	authhttp "github.com/dfreire/fservices/auth/http"
+	"github.com/dfreire/fservices/config"
+	"github.com/dfreire/fservices/files"
+	"github.com/dfreire/fservices/mailer"
+	"github.com/labstack/echo"
+)
+
+func main() {
+	configPath := flag.String("config", "fservices.toml", "the TOML config file")
+	flag.Parse()
+
+	if err := run(*configPath); err != nil {
+		log.Fatalf("fservices-server: %s", err)
+	}
+}
+
+func run(configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Server.Addr == "" {
+		cfg.Server.Addr = ":8080"
+	}
+	if cfg.Server.ShutdownTimeout == "" {
+		cfg.Server.ShutdownTimeout = "10s"
+	}
+	shutdownTimeout, err := time.ParseDuration(cfg.Server.ShutdownTimeout)
+	if err != nil {
+		return err
+	}
+
+	store, db, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	a := auth.NewAuth(cfg.AuthConfig, store, mailer.NewMailer(cfg.Smtp))
+
+	scheduler, err := auth.NewScheduler(a)
+	if err != nil {
+		return err
+	}
+
+	var shuttingDown int32
+	server := &stdhttp.Server{
+		Addr:    cfg.Server.Addr,
+		Handler: newHandler(cfg, store, db, a, &shuttingDown),
+	}
+
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	done := make(chan error, 1)
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-signals
+
+		log.Printf("fservices-server: %s, shutting down", sig)
+		atomic.StoreInt32(&shuttingDown, 1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		done <- server.Shutdown(ctx)
+	}()
+
+	log.Printf("fservices-server: listening on %s", cfg.Server.Addr)
+	if cfg.Server.TLSCertFile != "" || cfg.Server.TLSKeyFile != "" {
+		err = server.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != stdhttp.ErrServerClosed {
+		return err
+	}
+
+	return <-done
+}
+
+func newHandler(cfg config.Config, store auth.Store, db io.Closer, a auth.Auth, shuttingDown *int32) stdhttp.Handler {
+	e := echo.New()
+
+	// The SQL databases can be down; a bolt file is always there once open.
+	ping := func() error { return nil }
+	if pinger, ok := db.(interface {
+		Ping() error
+	}); ok {
+		ping = pinger.Ping
+	}
+
+	e.Get("/healthz", func(c *echo.Context) error {
+		return c.String(stdhttp.StatusOK, "ok")
+	})
+
+	e.Get("/readyz", func(c *echo.Context) error {
+		if atomic.LoadInt32(shuttingDown) == 1 {
+			return c.String(stdhttp.StatusServiceUnavailable, "shutting down")
+		}
+		if err := ping(); err != nil {
+			log.Printf("fservices-server: the database is not ready: %s", err)
+			return c.String(stdhttp.StatusServiceUnavailable, "database unavailable")
+		}
+		return c.String(stdhttp.StatusOK, "ok")
+	})
+
+	authhttp.Mount(e.Group("/auth"), a, cfg.Http)
+
+	filesGroup := e.Group("/files", authhttp.RequireSession(a, cfg.Http), authhttp.RequireConfirmed())
+	filesGroup.Post("/upload", files.Upload)
+
+	if backuper, ok := store.(interface {
+		Backup(w io.Writer) (int64, error)
+	}); ok {
+		adminGroup := e.Group("/admin", authhttp.RequireAdminKey(a))
+		adminGroup.Get("/backup", func(c *echo.Context) error {
+			c.Response().Header().Set("Content-Type", "application/octet-stream")
+			c.Response().Header().Set("Content-Disposition", `attachment; filename="auth.db"`)
+			c.Response().WriteHeader(stdhttp.StatusOK)
+			_, err := backuper.Backup(c.Response())
+			return err
+		})
+	}
+
+	return e
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dfreire/fservices/auth"
+	"github.com/dfreire/fservices/config"
+	"github.com/dfreire/fservices/mailer"
+)
+
+type env struct {
+	cfg    config.Config
+	db     io.Closer
+	store  auth.Store
+	auth   auth.Auth
+	mailer mailer.Mailer
+}
+
+func openEnv(configPath string) (env env, err error) {
+	env.cfg, err = config.Load(configPath)
+	if err != nil {
+		return
+	}
+
+	env.store, env.db, err = env.cfg.OpenStore()
+	if err != nil {
+		return
+	}
+
+	env.mailer = mailer.NewMailer(env.cfg.Smtp)
+	env.auth = auth.NewAuth(env.cfg.AuthConfig, env.store, env.mailer)
+	return
+}
+
+// parseArgs parses the flags of a command and checks that it has between
+// min and max positional arguments; max < 0 means no limit.
+func parseArgs(flags *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	args = flags.Args()
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return nil, errors.New("Wrong number of arguments, see fservices -h.")
+	}
+	return args, nil
+}
+
+func usersList(env env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("users list", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+
+	users, err := env.auth.GetUsers(env.cfg.AdminKey)
+	if err != nil {
+		return err
+	}
+
+	printUsers(users)
+	return nil
+}
+
+func usersCreate(env env, args []string) error {
+	flags := flag.NewFlagSet("users create", flag.ContinueOnError)
+	lang := flags.String("lang", "en_US", "the language of the user")
+	args, err := parseArgs(flags, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	return env.auth.CreateUser(env.cfg.AdminKey, args[0], args[1], *lang)
+}
+
+func usersRemove(env env, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("users remove", flag.ContinueOnError), args, 1, -1)
+	if err != nil {
+		return err
+	}
+
+	return env.auth.RemoveUsers(env.cfg.AdminKey, args...)
+}
+
+func usersUnapproved(env env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("users unapproved", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+
+	users, err := env.auth.GetUnapprovedUsers(env.cfg.AdminKey)
+	if err != nil {
+		return err
+	}
+
+	printUsers(users)
+	return nil
+}
+
+func usersApprove(env env, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("users approve", flag.ContinueOnError), args, 1, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, userId := range args {
+		if err := env.auth.ApproveUser(env.cfg.AdminKey, userId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func usersReject(env env, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("users reject", flag.ContinueOnError), args, 1, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, userId := range args {
+		if err := env.auth.RejectUser(env.cfg.AdminKey, userId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func usersSetPassword(env env, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("users set-password", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	return env.auth.ChangeUserPassword(env.cfg.AdminKey, args[0], args[1])
+}
+
+func usersSetEmail(env env, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("users set-email", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	return env.auth.ChangeUserEmail(env.cfg.AdminKey, args[0], args[1])
+}
+
+func usersPurgeUnconfirmed(env env, args []string) error {
+	flags := flag.NewFlagSet("users purge-unconfirmed", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only list the users that would be removed")
+	if _, err := parseArgs(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	removedUsers, err := env.auth.RemoveUnconfirmedUsers(env.cfg.AdminKey, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	printUsers(removedUsers)
+	return nil
+}
+
+func serviceAccountsList(env env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("service-accounts list", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+
+	serviceAccounts, err := env.auth.GetServiceAccounts(env.cfg.AdminKey)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCREATED\tDISABLED")
+	for _, serviceAccount := range serviceAccounts {
+		disabledAt := "-"
+		if !serviceAccount.DisabledAt.IsZero() {
+			disabledAt = serviceAccount.DisabledAt.Format(time.RFC3339)
+		}
+		scopes := strings.Join(serviceAccount.Scopes, " ")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", serviceAccount.Id, serviceAccount.Name, scopes, serviceAccount.CreatedAt.Format(time.RFC3339), disabledAt)
+	}
+	w.Flush()
+	return nil
+}
+
+// serviceAccountsCreate prints the client id and the client secret, which
+// cannot be read again.
+func serviceAccountsCreate(env env, args []string) error {
+	flags := flag.NewFlagSet("service-accounts create", flag.ContinueOnError)
+	scopes := flags.String("scopes", "", "the scopes that the tokens of the account may have, separated by spaces")
+	args, err := parseArgs(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	serviceAccount, clientSecret, err := env.auth.CreateServiceAccount(env.cfg.AdminKey, args[0], strings.Fields(*scopes))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("client_id:     %s\nclient_secret: %s\n", serviceAccount.Id, clientSecret)
+	return nil
+}
+
+func serviceAccountsRotate(env env, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("service-accounts rotate", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	clientSecret, err := env.auth.RotateServiceAccountSecret(env.cfg.AdminKey, args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("client_secret: %s\n", clientSecret)
+	return nil
+}
+
+func serviceAccountsDisable(env env, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("service-accounts disable", flag.ContinueOnError), args, 1, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, serviceAccountId := range args {
+		if err := env.auth.DisableServiceAccount(env.cfg.AdminKey, serviceAccountId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func schemaInit(env env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("schema init", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+
+	version, err := auth.SchemaVersion(env.store)
+	if err != nil {
+		return err
+	}
+	if version > 0 {
+		return errors.New("The schema already exists, use schema migrate to update it.")
+	}
+
+	return auth.Migrate(env.store)
+}
+
+func schemaMigrate(env env, args []string) error {
+	flags := flag.NewFlagSet("schema migrate", flag.ContinueOnError)
+	to := flags.Int("to", -1, "the schema version to migrate up or down to; the default is the latest")
+	if _, err := parseArgs(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	if err := auth.MigrateTo(env.store, *to); err != nil {
+		return err
+	}
+
+	version, err := auth.SchemaVersion(env.store)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("The schema is at version %d.\n", version)
+	return nil
+}
+
+// storeBackup copies a bolt store. The server locks the file while it runs,
+// then its GET /admin/backup makes the same copy.
+func storeBackup(env env, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("store backup", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	backuper, ok := env.store.(interface {
+		Backup(w io.Writer) (int64, error)
+	})
+	if !ok {
+		return fmt.Errorf("The %s store has no backup command, use the tools of the database.", env.cfg.Database.Driver)
+	}
+
+	file, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := backuper.Backup(file); err != nil {
+		file.Close()
+		os.Remove(args[0])
+		return err
+	}
+	return file.Close()
+}
+
+func mailTest(env env, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("mail test", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	return env.mailer.Send(mailer.Mail{
+		From:    env.cfg.FromEmail,
+		To:      []string{args[0]},
+		Subject: "fservices test mail",
+		Body:    "<p>The mail server of fservices is working.</p>",
+	})
+}
+
+func printUsers(users []auth.User) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tLANG\tCREATED\tCONFIRMED")
+	for _, user := range users {
+		confirmedAt := "-"
+		if !user.ConfirmedAt.IsZero() {
+			confirmedAt = user.ConfirmedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", user.Id, user.Email, user.Lang, user.CreatedAt.Format(time.RFC3339), confirmedAt)
+	}
+	w.Flush()
+}
@@ -0,0 +1,89 @@
+// Command fservices runs the admin tasks of the fservices on the database
+// and the mail server of a TOML config file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: fservices [-config fservices.toml] <command> [arguments]
+
+commands:
+  users list
+  users create [-lang en_US] <email> <password>
+  users remove <userId>...
+  users unapproved
+  users approve <userId>...
+  users reject <userId>...
+  users set-password <userId> <password>
+  users set-email <userId> <email>
+  users purge-unconfirmed [-dry-run]
+  service-accounts list
+  service-accounts create [-scopes "scope ..."] <name>
+  service-accounts rotate <serviceAccountId>
+  service-accounts disable <serviceAccountId>...
+  schema init
+  schema migrate [-to version]
+  store backup <file>
+  mail test <to>
+`
+
+type command func(env env, args []string) error
+
+var commands = map[string]command{
+	"users list":              usersList,
+	"users create":            usersCreate,
+	"users remove":            usersRemove,
+	"users unapproved":        usersUnapproved,
+	"users approve":           usersApprove,
+	"users reject":            usersReject,
+	"users set-password":      usersSetPassword,
+	"users set-email":         usersSetEmail,
+	"users purge-unconfirmed": usersPurgeUnconfirmed,
+	"schema init":             schemaInit,
+	"schema migrate":          schemaMigrate,
+	"store backup":            storeBackup,
+	"mail test":               mailTest,
+
+	"service-accounts list":    serviceAccountsList,
+	"service-accounts create":  serviceAccountsCreate,
+	"service-accounts rotate":  serviceAccountsRotate,
+	"service-accounts disable": serviceAccountsDisable,
+}
+
+func main() {
+	configPath := flag.String("config", "fservices.toml", "the TOML config file")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[args[0]+" "+args[1]]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*configPath, cmd, args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "fservices:", err)
+		os.Exit(1)
+	}
+}
+
+func run(configPath string, cmd command, args []string) error {
+	env, err := openEnv(configPath)
+	if err != nil {
+		return err
+	}
+	defer env.db.Close()
+
+	return cmd(env, args)
+}
@@ -0,0 +1,104 @@
+// Package config loads the TOML configuration of the fservices commands.
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dfreire/fservices/auth"
+	authhttp "github.com/dfreire/fservices/auth/http"
+	"github.com/dfreire/fservices/mailer"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Config has the AuthConfig keys at the top level, as in auth_test.toml,
+// and the [Database], [Smtp], [Server] and [Http] sections.
+type Config struct {
+	auth.AuthConfig
+	Database DatabaseConfig
+	Smtp     mailer.SmtpConfig
+	Server   ServerConfig
+	Http     authhttp.Config
+
+	// DisposableEmailDomainsFile, when set, has the DisposableEmailDomains,
+	// one per line, so that the list can be updated without a new build.
+	DisposableEmailDomainsFile string
+}
+
+type DatabaseConfig struct {
+	// Driver is "postgres", "mysql", "sqlite3" or "bolt". A MySQL
+	// DataSource must set parseTime=true, and the bolt one is the path of
+	// the file.
+	Driver     string
+	DataSource string
+}
+
+type ServerConfig struct {
+	// Addr defaults to ":8080".
+	Addr string
+	// TLSCertFile and TLSKeyFile, when set, make the server use TLS.
+	TLSCertFile string
+	TLSKeyFile  string
+	// ShutdownTimeout is how long the requests in flight get to finish on
+	// shutdown. The default is "10s".
+	ShutdownTimeout string
+}
+
+func Load(path string) (cfg Config, err error) {
+	if _, err = toml.DecodeFile(path, &cfg); err != nil {
+		return
+	}
+
+	if cfg.DisposableEmailDomainsFile != "" {
+		cfg.DisposableEmailDomains, err = readEmailDomains(cfg.DisposableEmailDomainsFile)
+	}
+	return
+}
+
+func readEmailDomains(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return auth.ReadEmailDomains(file)
+}
+
+func (self Config) OpenDatabase() (*sql.DB, error) {
+	if self.Database.Driver == "" {
+		return nil, errors.New("The database driver is empty.")
+	}
+	return sql.Open(self.Database.Driver, self.Database.DataSource)
+}
+
+// OpenStore opens the auth store of the [Database] section, and returns the
+// database to close when done.
+func (self Config) OpenStore() (auth.Store, io.Closer, error) {
+	if self.Database.Driver == "bolt" {
+		db, err := bolt.Open(self.Database.DataSource, 0600, &bolt.Options{Timeout: time.Second})
+		if err == bolt.ErrTimeout {
+			return nil, nil, fmt.Errorf("The bolt file %s is in use by another process.", self.Database.DataSource)
+		} else if err != nil {
+			return nil, nil, err
+		}
+		return auth.NewStoreBolt(db), db, nil
+	}
+
+	db, err := self.OpenDatabase()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	store, err := auth.NewStore(self.Database.Driver, db)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return store, db, nil
+}
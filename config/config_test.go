@@ -0,0 +1,48 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dfreire/fservices/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load("config_test.toml")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "ba5a5c16-840a-4a01-8817-3799d0492551", cfg.AdminKey)
+	assert.Equal(t, "720h", cfg.MaxUnconfirmedUsersAge)
+	assert.Equal(t, "Signup Confirmation", cfg.ConfirmationEmail["en_US"].Subject)
+	assert.Equal(t, "sqlite3", cfg.Database.Driver)
+	assert.Equal(t, 587, cfg.Smtp.Port)
+	assert.Equal(t, ":8443", cfg.Server.Addr)
+	assert.True(t, cfg.Http.CookieMode)
+	assert.Equal(t, []string{"mailinator.com", "example-throwaway.com"}, cfg.DisposableEmailDomains)
+
+	db, err := cfg.OpenDatabase()
+	assert.Nil(t, err)
+	assert.Nil(t, db.Ping())
+	db.Close()
+
+	_, err = Config{}.OpenDatabase()
+	assert.NotNil(t, err)
+}
+
+func TestOpenStore(t *testing.T) {
+	cfg := Config{Database: DatabaseConfig{Driver: "bolt", DataSource: filepath.Join(t.TempDir(), "auth.db")}}
+
+	store, db, err := cfg.OpenStore()
+	assert.Nil(t, err)
+	assert.Nil(t, auth.Migrate(store))
+
+	// The file is locked while it is open.
+	_, _, err = cfg.OpenStore()
+	assert.NotNil(t, err)
+	assert.Nil(t, db.Close())
+
+	cfg.Database.Driver = "oracle"
+	_, _, err = cfg.OpenStore()
+	assert.NotNil(t, err)
+}
@@ -2,15 +2,24 @@ package files
 
 import (
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode"
 
-	"github.com/Machiel/slugify"
+	authhttp "github.com/dfreire/fservices/auth/http"
 	"github.com/labstack/echo"
+	"golang.org/x/text/unicode/norm"
 )
 
+// Upload must be mounted behind authhttp.RequireSession; without a user in
+// the context it rejects the request.
 func Upload(c *echo.Context) error {
+	if _, ok := authhttp.GetUser(c); !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+
 	req := c.Request()
 	req.ParseMultipartForm(16 * 1024 * 1024)
 
@@ -41,6 +50,27 @@ func Upload(c *echo.Context) error {
 
 func slugifyFilename(filename string) string {
 	extension := filepath.Ext(filename)
-	name := slugify.Slugify(filename[0 : len(filename)-len(extension)])
+	name := slugify(filename[0 : len(filename)-len(extension)])
 	return strings.Join([]string{name, extension}, "")
 }
+
+// slugify lowercases s, drops its accents and joins its runs of letters and
+// digits with "-".
+func slugify(s string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(strings.ToLower(s)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	return slug.String()
+}
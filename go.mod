@@ -0,0 +1,44 @@
+module github.com/dfreire/fservices
+
+go 1.21
+
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/dgrijalva/jwt-go v2.7.0+incompatible
+	github.com/go-sql-driver/mysql v1.7.1
+	github.com/jordan-wright/email v4.0.1-0.20210109023952-943e75fe5223+incompatible
+	github.com/labstack/echo v1.4.4
+	github.com/lib/pq v1.0.0
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/renstrom/shortuuid v3.0.0+incompatible
+	github.com/satori/go.uuid v1.1.0
+	github.com/stretchr/testify v1.8.4
+	github.com/xeipuuv/gojsonschema v1.2.0
+	go.etcd.io/bbolt v1.3.10
+	golang.org/x/crypto v0.23.0
+	golang.org/x/net v0.21.0
+	golang.org/x/text v0.15.0
+	google.golang.org/grpc v1.56.3
+	google.golang.org/protobuf v1.30.0
+)
+
+require (
+	github.com/google/uuid v1.3.0 // indirect
+	github.com/mattn/go-colorable v0.1.2 // indirect
+	github.com/mattn/go-isatty v0.0.9 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasttemplate v1.0.1 // indirect
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/labstack/gommon v0.3.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/objx v0.5.0 // indirect
+	github.com/xeipuuv/gojsonpointer v0.0.0-20180127040702-4e3ac2762d5f // indirect
+	github.com/xeipuuv/gojsonreference v0.0.0-20180127040603-bd5ef7bd5415 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -1,6 +1,10 @@
 package mailer
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
+	netmail "net/mail"
 	"net/smtp"
 	"strconv"
 	"strings"
@@ -10,6 +14,8 @@ import (
 
 type Mailer interface {
 	Send(Mail) error
+	// SendContext gives up on the SMTP server when ctx is done.
+	SendContext(context.Context, Mail) error
 }
 
 type mailerImpl struct {
@@ -28,6 +34,10 @@ func NewMailer(cfg SmtpConfig) mailerImpl {
 }
 
 func (self mailerImpl) Send(mail Mail) error {
+	return self.SendContext(context.Background(), mail)
+}
+
+func (self mailerImpl) SendContext(ctx context.Context, mail Mail) error {
 	e := email.NewEmail()
 	if mail.From != "" {
 		e.From = mail.From
@@ -44,17 +54,101 @@ func (self mailerImpl) Send(mail Mail) error {
 		e.AttachFile(attachment)
 	}
 
+	msg, err := e.Bytes()
+	if err != nil {
+		return err
+	}
+
+	from, err := netmail.ParseAddress(e.From)
+	if err != nil {
+		return err
+	}
+
+	recipients := []string{}
+	for _, addresses := range [][]string{e.To, e.Cc, e.Bcc} {
+		for _, address := range addresses {
+			recipient, err := netmail.ParseAddress(address)
+			if err != nil {
+				return err
+			}
+			recipients = append(recipients, recipient.Address)
+		}
+	}
+
+	err = self.send(ctx, from.Address, recipients, msg)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// send is smtp.SendMail on a connection that is closed when ctx is done.
+func (self mailerImpl) send(ctx context.Context, from string, recipients []string, msg []byte) error {
 	hostAndPort := strings.Join([]string{
 		self.cfg.Host,
 		strconv.Itoa(self.cfg.Port),
 	}, ":")
 
-	plainAuth := smtp.PlainAuth(
-		"", // identity
-		self.cfg.Email,
-		self.cfg.Password,
-		self.cfg.Host,
-	)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", hostAndPort)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, self.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: self.cfg.Host}); err != nil {
+			return err
+		}
+	}
+
+	if ok, _ := client.Extension("AUTH"); ok && self.cfg.Email != "" {
+		plainAuth := smtp.PlainAuth(
+			"", // identity
+			self.cfg.Email,
+			self.cfg.Password,
+			self.cfg.Host,
+		)
+		if err = client.Auth(plainAuth); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err = client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
 
-	return e.Send(hostAndPort, plainAuth)
+	return client.Quit()
 }
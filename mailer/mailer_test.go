@@ -1,9 +1,13 @@
 package mailer
 
 import (
+	"context"
 	"log"
+	"net"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/renstrom/shortuuid"
@@ -30,13 +34,16 @@ type mailinatorEmail struct {
 func TestSend(t *testing.T) {
 	var cfg SmtpConfig
 	_, err := toml.DecodeFile("mailer_test.secret.toml", &cfg)
+	if os.IsNotExist(err) {
+		t.Skip("mailer_test.secret.toml has no SMTP server to send with")
+	}
 
 	if assert.Nil(t, err) {
 		mail := Mail{
 			From:    randomMailinatorAddress(),
 			To:      []string{randomMailinatorAddress()},
-			Subject: strings.Join([]string{"Test", shortuuid.UUID()}, "-"),
-			Body:    strings.Join([]string{"<h1>", shortuuid.UUID(), "</h1>"}, ""),
+			Subject: strings.Join([]string{"Test", shortuuid.New()}, "-"),
+			Body:    strings.Join([]string{"<h1>", shortuuid.New(), "</h1>"}, ""),
 		}
 		mailer := NewMailer(cfg)
 		err = mailer.Send(mail)
@@ -50,5 +57,30 @@ func TestSend(t *testing.T) {
 }
 
 func randomMailinatorAddress() string {
-	return strings.Join([]string{shortuuid.UUID(), "@mailinator.com"}, "")
+	return strings.Join([]string{shortuuid.New(), "@mailinator.com"}, "")
+}
+
+func TestSendContext(t *testing.T) {
+	// A server that accepts the connection and never greets.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	mailer := NewMailer(SmtpConfig{Host: "127.0.0.1", Port: addr.Port})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = mailer.SendContext(ctx, Mail{From: "from@example.com", To: []string{"to@example.com"}})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
 }
@@ -1,6 +1,8 @@
 package mock
 
 import (
+	"context"
+
 	"github.com/dfreire/fservices/mailer"
 	"github.com/stretchr/testify/mock"
 )
@@ -13,3 +15,8 @@ func (m *MailerMock) Send(mail mailer.Mail) error {
 	args := m.Called(mail)
 	return args.Error(0)
 }
+
+// SendContext is recorded as a call to Send.
+func (m *MailerMock) SendContext(ctx context.Context, mail mailer.Mail) error {
+	return m.Send(mail)
+}